@@ -47,6 +47,8 @@ func runExamples(eng *csvsql.Engine) {
 		{"Wildcard SELECT", example6},
 		{"Custom SELECT fields", example7},
 		{"Custom Join Condition", example8},
+		{"INTERSECT and EXCEPT operations", example9},
+		{"Window functions with ORDER BY and LIMIT", example10},
 	}
 
 	for _, ex := range examples {
@@ -187,6 +189,47 @@ func example8() (*csvsql.Query, error) {
 		Build()
 }
 
+// Example 9: INTERSECT and EXCEPT operations
+func example9() (*csvsql.Query, error) {
+	allUsers := csvsql.NewQuery().
+		Select("id").
+		From("users")
+
+	completedOrders := csvsql.NewQuery().
+		Select("user_id").
+		From("orders").
+		Where("status", "=", "completed")
+
+	processingOrders := csvsql.NewQuery().
+		Select("user_id").
+		From("orders").
+		Where("status", "=", "processing")
+
+	// Users with a completed order but no processing order
+	return allUsers.
+		Intersect(completedOrders).
+		Except(processingOrders).
+		Build()
+}
+
+// Example 10: Window functions with ORDER BY and LIMIT
+func example10() (*csvsql.Query, error) {
+	return csvsql.NewQuery().
+		Select("users.name", "orders.product", "orders.amount", "orders.order_date").
+		From("users").
+		InnerJoin("orders").
+		On("users", "id", "=", "orders", "user_id").
+		SelectWindow("recency", csvsql.RowNumber().
+			PartitionBy("users.id").
+			OrderBy("orders.order_date", csvsql.Desc)).
+		SelectWindow("running_total", csvsql.SumOver("orders.amount").
+			PartitionBy("users.id").
+			OrderBy("orders.order_date")).
+		OrderBy("running_total", csvsql.Desc).
+		Limit(5).
+		Build()
+}
+
 func printResults(results [][]string) {
 	if len(results) == 0 {
 		fmt.Println("No results found")
@@ -0,0 +1,106 @@
+package csvsql
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressionExts are the extensions of the supported compression formats.
+var compressionExts = []string{".gz", ".zst", ".bz2"}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	// A bzip2 stream starts with BZh, the block size and the magic of either
+	// a block or the end of the stream.
+	bzip2Magic      = []byte("BZh")
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// trimCompressionExt returns path without the extension of a compression
+// format, so that the format of the compressed file can be told by the
+// remaining extension.
+func trimCompressionExt(path string) string {
+	for _, ext := range compressionExts {
+		if strings.HasSuffix(strings.ToLower(path), ext) {
+			return path[:len(path)-len(ext)]
+		}
+	}
+	return path
+}
+
+func isBzip2(prefix []byte) bool {
+	if len(prefix) < 10 || !bytes.HasPrefix(prefix, bzip2Magic) || prefix[3] < '1' || prefix[3] > '9' {
+		return false
+	}
+	return bytes.Equal(prefix[4:10], bzip2BlockMagic) || bytes.Equal(prefix[4:10], bzip2EndMagic)
+}
+
+// openDecompressed opens the file at path and decompresses it while it is
+// read if it starts with the magic bytes of a compression format. It reports
+// whether the file was compressed. A file with the extension of a compression
+// format must be compressed.
+func openDecompressed(path string) (io.ReadCloser, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	r, compressed, err := decompressReader(file)
+	if err != nil {
+		file.Close()
+		return nil, false, err
+	}
+	if !compressed && trimCompressionExt(path) != path {
+		file.Close()
+		return nil, false, fmt.Errorf("file %s is not compressed as its extension suggests", path)
+	}
+	return &decompressedFile{ReadCloser: r, file: file}, compressed, nil
+}
+
+// decompressReader returns a reader decompressing r if it starts with the
+// magic bytes of a compression format, and reports whether it does. Closing
+// the returned reader does not close r.
+func decompressReader(r io.Reader) (io.ReadCloser, bool, error) {
+	buffered := bufio.NewReader(r)
+	prefix, _ := buffered.Peek(10)
+
+	switch {
+	case bytes.HasPrefix(prefix, gzipMagic):
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, false, fmt.Errorf("decompress error: %w", err)
+		}
+		return decompressed, true, nil
+	case bytes.HasPrefix(prefix, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, false, fmt.Errorf("decompress error: %w", err)
+		}
+		return decoder.IOReadCloser(), true, nil
+	case isBzip2(prefix):
+		return io.NopCloser(bzip2.NewReader(buffered)), true, nil
+	default:
+		return io.NopCloser(buffered), false, nil
+	}
+}
+
+// decompressedFile closes both the decompressor and the underlying file.
+type decompressedFile struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (f *decompressedFile) Close() error {
+	f.ReadCloser.Close()
+	return f.file.Close()
+}
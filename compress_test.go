@@ -0,0 +1,113 @@
+package csvsql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const compressTestCSV = "id,name\n1,alice\n"
+
+// compressTestBzip2 is compressTestCSV compressed by bzip2, which the standard
+// library can only decompress.
+const compressTestBzip2 = "425a6839314159265359e2c1de9300000659000010000420002e2720003100d34d034068684499a5a17228678bb9229c28487160ef4980"
+
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdData(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressedFiles(t *testing.T) {
+	bzip2Data, err := hex.DecodeString(compressTestBzip2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"users.csv.gz":  gzipData(t, compressTestCSV),
+		"users.csv.zst": zstdData(t, compressTestCSV),
+		"users.csv.bz2": bzip2Data,
+		"users.CSV.GZ":  gzipData(t, compressTestCSV),
+		// Compression is recognised by its magic bytes, not the extension.
+		"gzipped.csv": gzipData(t, compressTestCSV),
+	}
+
+	dir := t.TempDir()
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			e := NewEngine()
+			if err := e.CreateTable("users", path); err != nil {
+				t.Fatal(err)
+			}
+			assertColumn(t, mustQuery(t, e, mustBuild(t, NewQuery().Select("name").From("users"))), 0, []string{"alice"})
+		})
+	}
+}
+
+func TestUncompressedFileWithCompressionExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.csv.gz")
+	if err := os.WriteFile(path, []byte(compressTestCSV), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewEngine().CreateTable("users", path); err == nil || !strings.Contains(err.Error(), "not compressed") {
+		t.Errorf("err = %v, want a file that is not compressed", err)
+	}
+}
+
+func TestCompressedReaders(t *testing.T) {
+	tests := []struct {
+		format string
+		data   []byte
+	}{
+		{"csv.gz", gzipData(t, compressTestCSV)},
+		{"csv", zstdData(t, compressTestCSV)},
+		{"ndjson.gz", gzipData(t, `{"id": 1, "name": "alice"}`+"\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			e := NewEngine()
+			if err := e.CreateTableFromReader("users", bytes.NewReader(tt.data), tt.format, TableOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			assertColumn(t, mustQuery(t, e, mustBuild(t, NewQuery().Select("name").From("users"))), 0, []string{"alice"})
+		})
+	}
+
+	err := NewEngine().CreateTableFromReader("t", bytes.NewReader(gzipData(t, "PAR1")), "parquet", TableOptions{})
+	if err == nil || !strings.Contains(err.Error(), "compressed parquet") {
+		t.Errorf("err = %v, want compressed parquet to be rejected", err)
+	}
+}
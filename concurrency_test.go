@@ -0,0 +1,119 @@
+package csvsql
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestConcurrentEngineUse creates tables and indexes while other goroutines
+// query the engine. Run it with -race.
+func TestConcurrentEngineUse(t *testing.T) {
+	e := newTestEngine(t)
+	dir := t.TempDir()
+	const workers = 8
+
+	var wg sync.WaitGroup
+	var indexed int32
+	errs := make(chan error, 4*workers)
+	for i := 0; i < workers; i++ {
+		i := i
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			path := filepath.Join(dir, fmt.Sprintf("t%d.csv", i))
+			if err := os.WriteFile(path, []byte("id,name\n1,x\n2,y\n"), 0o644); err != nil {
+				errs <- err
+				return
+			}
+			if err := e.CreateTable(fmt.Sprintf("file%d", i), path); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("rows%d", i)
+			if err := e.CreateTableFromRows(name, []string{"id"}, [][]string{{"1"}, {"3"}}); err != nil {
+				errs <- err
+				return
+			}
+			if err := e.CreateIndex(name, "id"); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			// Only one of the workers creates the index, the others
+			// find it exists.
+			if err := e.CreateIndex("u", "id"); err == nil {
+				atomic.AddInt32(&indexed, 1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			q, err := NewQuery().Select("u.name", "v.name").From("u").
+				InnerJoin("v").On("u", "id", "=", "v", "id").
+				Where("u.id", "=", "3").
+				Build()
+			if err != nil {
+				errs <- err
+				return
+			}
+			for j := 0; j < 20; j++ {
+				results, err := e.ExecuteQuery(q)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(results) != 2 || results[1][0] != "carol" {
+					errs <- fmt.Errorf("unexpected results %v", results)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if indexed != 1 {
+		t.Errorf("index on u.id created %d times, want once", indexed)
+	}
+
+	for i := 0; i < workers; i++ {
+		q := mustBuild(t, NewQuery().Select("id").From(fmt.Sprintf("file%d", i)).
+			Intersect(NewQuery().Select("id").From(fmt.Sprintf("rows%d", i))))
+		assertColumn(t, mustQuery(t, e, q), 0, []string{"1"})
+	}
+}
+
+// TestConcurrentQueriesShareQuery runs one Query value from many goroutines,
+// which must not modify it.
+func TestConcurrentQueriesShareQuery(t *testing.T) {
+	e := newTestEngine(t, WithParallelism(4))
+	q := mustBuild(t, NewQuery().From("u").
+		Union(NewQuery().Select("id", "name", "zip").From("v")).
+		OrderBy("id", Desc).
+		Limit(3))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := e.ExecuteQuery(q)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got := column(results, 0); fmt.Sprint(got) != "[5 4 3]" {
+				t.Errorf("ids = %v, want [5 4 3]", got)
+			}
+		}()
+	}
+	wg.Wait()
+}
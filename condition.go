@@ -21,58 +21,117 @@ func (c *SimpleCondition) Type() string {
 }
 
 func (c *SimpleCondition) Evaluate(row map[string][]string, tables map[string]*Table) (bool, error) {
-	parts := strings.Split(c.Column, ".")
-	var tableName, colName string
-	var table *Table
-	var colIdx int
-
-	if len(parts) == 2 {
-		tableName, colName = parts[0], parts[1]
-		var ok bool
-		table, ok = tables[tableName]
-		if !ok {
-			return false, fmt.Errorf("table %s not found", tableName)
-		}
-		var err error
-		colIdx, err = table.GetColumnIndex(colName)
+	val, err := columnValue(c.Column, row, tables)
+	if err != nil {
+		return false, err
+	}
+	return c.Op.Evaluate(val, c.Value)
+}
+
+// resolveColumn finds the table and index of a possibly table-qualified
+// column. Unqualified names must match exactly one of the given tables.
+func resolveColumn(column string, tables map[string]*Table) (string, int, error) {
+	tableName, colName := splitColumn(column, tables)
+	if tableName != "" {
+		colIdx, err := tables[tableName].GetColumnIndex(colName)
 		if err != nil {
-			return false, fmt.Errorf("column error: %w", err)
+			return "", 0, fmt.Errorf("column error: %w", err)
 		}
-	} else if len(parts) == 1 {
-		colName = parts[0]
-		foundInTable := ""
-		var foundIdx int
-
-		for tName, t := range tables {
-			if idx, err := t.GetColumnIndex(colName); err == nil {
-				if foundInTable != "" {
-					return false, fmt.Errorf("ambiguous column name: %s exists in multiple tables", colName)
-				}
-				foundInTable = tName
-				foundIdx = idx
-				table = t
+		return tableName, colIdx, nil
+	}
+
+	foundInTable := ""
+	var foundIdx int
+	for tName, t := range tables {
+		if idx, err := t.GetColumnIndex(column); err == nil {
+			if foundInTable != "" {
+				return "", 0, fmt.Errorf("ambiguous column name: %s exists in multiple tables", column)
 			}
+			foundInTable = tName
+			foundIdx = idx
 		}
+	}
 
-		if foundInTable == "" {
-			return false, fmt.Errorf("column not found in any table: %s", colName)
+	if foundInTable == "" {
+		if prefix, _, ok := strings.Cut(column, "."); ok {
+			return "", 0, fmt.Errorf("table %s not found", prefix)
 		}
-		tableName = foundInTable
-		colIdx = foundIdx
-	} else {
-		return false, fmt.Errorf("invalid column name format: %s", c.Column)
+		return "", 0, fmt.Errorf("column not found in any table: %s", column)
+	}
+	return foundInTable, foundIdx, nil
+}
+
+// splitColumn separates the table qualifier from a column name. Columns
+// flattened from nested JSON objects, such as address.city, contain dots
+// themselves, so a qualifier is only split off when it names one of tables.
+func splitColumn(column string, tables map[string]*Table) (string, string) {
+	if tableName, colName, ok := strings.Cut(column, "."); ok {
+		if _, ok := tables[tableName]; ok {
+			return tableName, colName
+		}
+	}
+	return "", column
+}
+
+func columnValue(column string, row map[string][]string, tables map[string]*Table) (string, error) {
+	tableName, colIdx, err := resolveColumn(column, tables)
+	if err != nil {
+		return "", err
 	}
 
 	tableRow, ok := row[tableName]
 	if !ok {
-		return false, fmt.Errorf("table %s not found in row data", tableName)
+		return "", fmt.Errorf("table %s not found in row data", tableName)
 	}
 
 	if colIdx >= len(tableRow) {
-		return false, fmt.Errorf("column index %d out of range for table %s", colIdx, tableName)
+		return "", fmt.Errorf("column index %d out of range for table %s", colIdx, tableName)
+	}
+
+	return tableRow[colIdx], nil
+}
+
+type InCondition struct {
+	Column string
+	Values []string
+}
+
+func (c *InCondition) Type() string {
+	return "In"
+}
+
+func (c *InCondition) Evaluate(row map[string][]string, tables map[string]*Table) (bool, error) {
+	val, err := columnValue(c.Column, row, tables)
+	if err != nil {
+		return false, err
 	}
+	for _, v := range c.Values {
+		if val == v {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-	return c.Op.Evaluate(tableRow[colIdx], c.Value)
+// BetweenCondition matches values from Low to High inclusive. Like the
+// comparison operators, it compares values as text, so numbers of different
+// lengths only compare as expected when they are padded to the same width.
+type BetweenCondition struct {
+	Column string
+	Low    string
+	High   string
+}
+
+func (c *BetweenCondition) Type() string {
+	return "Between"
+}
+
+func (c *BetweenCondition) Evaluate(row map[string][]string, tables map[string]*Table) (bool, error) {
+	val, err := columnValue(c.Column, row, tables)
+	if err != nil {
+		return false, err
+	}
+	return val >= c.Low && val <= c.High, nil
 }
 
 type CustomCondition func(row map[string][]string, tables map[string]*Table) (bool, error)
@@ -169,3 +228,47 @@ func NewCompositeCondition(left, right Condition, operator string) (*CompositeCo
 		Operator: logicalOp,
 	}, nil
 }
+
+func NewInCondition(column string, values ...string) (*InCondition, error) {
+	if column == "" {
+		return nil, &ErrInvalidQuery{"column name cannot be empty"}
+	}
+	if len(values) == 0 {
+		return nil, &ErrInvalidQuery{"IN requires at least one value"}
+	}
+	return &InCondition{
+		Column: column,
+		Values: values,
+	}, nil
+}
+
+func NewBetweenCondition(column, low, high string) (*BetweenCondition, error) {
+	if column == "" {
+		return nil, &ErrInvalidQuery{"column name cannot be empty"}
+	}
+	return &BetweenCondition{
+		Column: column,
+		Low:    low,
+		High:   high,
+	}, nil
+}
+
+// splitConjuncts flattens a tree of AND conditions into its operands.
+func splitConjuncts(condition Condition) []Condition {
+	if composite, ok := condition.(*CompositeCondition); ok && composite.Operator == And {
+		return append(splitConjuncts(composite.Left), splitConjuncts(composite.Right)...)
+	}
+	return []Condition{condition}
+}
+
+// joinConjuncts is the inverse of splitConjuncts.
+func joinConjuncts(conditions []Condition) Condition {
+	if len(conditions) == 0 {
+		return nil
+	}
+	result := conditions[0]
+	for _, condition := range conditions[1:] {
+		result = &CompositeCondition{Left: result, Right: condition, Operator: And}
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package csvsql
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestStableOrderStopsWhenCancelled(t *testing.T) {
+	const n = 10 * sortChunkRows
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	comparisons := 0
+	_, err := stableOrder(ctx, n, func(i, j int) bool {
+		comparisons++
+		if comparisons == 1000 {
+			cancel()
+		}
+		return i > j
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("stableOrder error = %v, want context.Canceled", err)
+	}
+	// Sorting one chunk takes far fewer comparisons than sorting them all.
+	if comparisons > n {
+		t.Errorf("stableOrder made %d comparisons after cancellation", comparisons)
+	}
+}
+
+func TestStableOrderIsStable(t *testing.T) {
+	const n = 3*sortChunkRows + 17
+	keys := make([]int, n)
+	for i := range keys {
+		keys[i] = (i * 7919) % 10
+	}
+	order, err := stableOrder(context.Background(), n, func(i, j int) bool { return keys[i] < keys[j] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < n; i++ {
+		a, b := order[i-1], order[i]
+		if keys[a] > keys[b] || keys[a] == keys[b] && a > b {
+			t.Fatalf("positions %d and %d out of order", a, b)
+		}
+	}
+}
+
+// newLargeTestEngine registers a table t of n rows with a numeric id and a
+// group g of ten ids each.
+func newLargeTestEngine(t *testing.T, n int, opts ...EngineOption) *Engine {
+	t.Helper()
+	rows := make([][]string, n)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i), strconv.Itoa(i / 10)}
+	}
+	e := NewEngine(opts...)
+	if err := e.CreateTableFromRows("t", []string{"id", "g"}, rows); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestCancelDuringSort(t *testing.T) {
+	const n = 5000
+	e := newLargeTestEngine(t, n)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The custom column cancels the query while the last row is projected,
+	// so that only the sort can notice.
+	q := mustBuild(t, NewQuery().Select("id").From("t").
+		SelectCustom("x", func(row map[string][]string, tables map[string]*Table) (string, error) {
+			if row["t"][0] == strconv.Itoa(n-1) {
+				cancel()
+			}
+			return "", nil
+		}).
+		OrderBy("id", Desc))
+	if _, err := e.ExecuteQueryContext(ctx, q); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ExecuteQueryContext error = %v, want context.Canceled", err)
+	}
+}
+
+func TestCancelDuringWindow(t *testing.T) {
+	e := newLargeTestEngine(t, 1000)
+	q := mustBuild(t, NewQuery().Select("id").From("t").
+		SelectWindow("rn", RowNumber().PartitionBy("g").OrderBy("id", Desc)))
+
+	s := e.snapshot()
+	p, err := s.planQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joinedRows, err := s.initializeJoinedRows(context.Background(), p, s.tables["t"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.applyWindowFunctions(ctx, p.query, &joinedRows); !errors.Is(err, context.Canceled) {
+		t.Fatalf("applyWindowFunctions error = %v, want context.Canceled", err)
+	}
+	if err := s.applyWindowFunctions(context.Background(), p.query, &joinedRows); err != nil {
+		t.Fatal(err)
+	}
+	if got := joinedRows[0].windowValues["rn"]; got != "10" {
+		t.Errorf("row number of id 0 = %s, want 10", got)
+	}
+}
@@ -0,0 +1,303 @@
+package csvsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DriverName is the name the database/sql driver is registered under.
+const DriverName = "csvsql"
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+// Driver is a read-only database/sql driver running SELECT statements parsed
+// by ParseSQL. Its data source names list the tables to register, separated
+// by semicolons, each as an alias and a path accepted by CreateTable:
+//
+//	users=data/users.csv;orders=data/orders.xlsx#Sheet1
+//
+// A # in the path selects the sheet of an XLSX file. All connections of a
+// sql.DB share one Engine whose tables are loaded when the DB is opened.
+type Driver struct{}
+
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	e := NewEngine()
+	for _, entry := range strings.Split(dsn, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		alias, path, ok := strings.Cut(entry, "=")
+		alias, path = strings.TrimSpace(alias), strings.TrimSpace(path)
+		if !ok || alias == "" || path == "" {
+			return nil, fmt.Errorf("invalid data source entry %q: expected alias=path", entry)
+		}
+		var opts TableOptions
+		if i := strings.LastIndex(path, "#"); i >= 0 {
+			path, opts.Sheet = path[:i], path[i+1:]
+		}
+		if err := e.CreateTableWithOptions(alias, path, opts); err != nil {
+			return nil, err
+		}
+	}
+	return &connector{engine: e, driver: d}, nil
+}
+
+// NewConnector returns a connector running queries against the tables of e,
+// for use with sql.OpenDB when tables are registered in code rather than
+// listed in a data source name.
+func NewConnector(e *Engine) driver.Connector {
+	return &connector{engine: e, driver: &Driver{}}
+}
+
+type connector struct {
+	engine *Engine
+	driver *Driver
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{engine: c.engine}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+var (
+	errReadOnly       = errors.New("csvsql is read-only: only SELECT statements are supported")
+	errNoTransactions = errors.New("csvsql does not support transactions")
+)
+
+type conn struct {
+	engine *Engine
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	n, err := countSQLPlaceholders(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{conn: c, query: query, numInput: n}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errNoTransactions
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("named parameter %s is not supported: use ? placeholders", arg.Name)
+		}
+		values[i] = arg.Value
+	}
+
+	q, err := ParseSQL(query, values...)
+	if err != nil {
+		return nil, err
+	}
+	results, s, err := c.engine.executeSnapshot(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	// Columns are typed by the tables alone, not by the values a query
+	// happens to return, so that their types do not change between queries.
+	var types []ColumnType
+	if len(results) > 0 {
+		types, _ = s.declaredColumnTypes(q, len(results[0]))
+	}
+	return newRows(q, results, types), nil
+}
+
+type stmt struct {
+	conn     *conn
+	query    string
+	numInput int
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.numInput
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errReadOnly
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return s.QueryContext(context.Background(), named)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+// rows returns values of typed columns as int64, float64, bool and time.Time
+// values, and empty values of such columns as NULL. Values of string columns
+// are returned as strings, empty ones included.
+type rows struct {
+	columns []string
+	types   []ColumnType
+	data    [][]string
+	pos     int
+}
+
+func newRows(q *Query, results [][]string, types []ColumnType) *rows {
+	r := &rows{types: types}
+	if len(results) > 0 {
+		r.columns = resultColumnNames(q, results[0])
+		r.data = results[1:]
+	}
+	return r
+}
+
+// resultColumnNames strips the table from the qualified headers produced by
+// wildcards, such as users.id, unless another column has the same name, so
+// that columns can be mapped to struct fields by their plain names.
+func resultColumnNames(q *Query, headers []string) []string {
+	tables := make(map[string]bool)
+	if q.From != nil {
+		tables[q.From.Table] = true
+	}
+	for _, join := range q.Joins {
+		tables[join.Table] = true
+	}
+
+	names := make([]string, len(headers))
+	counts := make(map[string]int)
+	for i, header := range headers {
+		names[i] = header
+		if table, column, ok := strings.Cut(header, "."); ok && tables[table] {
+			names[i] = column
+		}
+		counts[names[i]]++
+	}
+	for i := range names {
+		if counts[names[i]] > 1 {
+			names[i] = headers[i]
+		}
+	}
+	return names
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.data) {
+		return io.EOF
+	}
+	row := r.data[r.pos]
+	r.pos++
+	for i := range dest {
+		var value string
+		if i < len(row) {
+			value = row[i]
+		}
+		dest[i] = driverValue(value, r.columnType(i))
+	}
+	return nil
+}
+
+func (r *rows) columnType(i int) ColumnType {
+	if i < len(r.types) {
+		return r.types[i]
+	}
+	return StringColumn
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(i int) string {
+	return r.columnType(i).String()
+}
+
+func (r *rows) ColumnTypeNullable(i int) (nullable, ok bool) {
+	return r.columnType(i) != StringColumn, true
+}
+
+func (r *rows) ColumnTypeScanType(i int) reflect.Type {
+	switch r.columnType(i) {
+	case IntegerColumn:
+		return reflect.TypeOf(sql.NullInt64{})
+	case FloatColumn:
+		return reflect.TypeOf(sql.NullFloat64{})
+	case BooleanColumn:
+		return reflect.TypeOf(sql.NullBool{})
+	case DateColumn, DateTimeColumn:
+		return reflect.TypeOf(sql.NullTime{})
+	default:
+		return reflect.TypeOf("")
+	}
+}
+
+// driverValue converts a value of a column of type typ to the value returned
+// to database/sql. Values that do not fit the type are returned as strings.
+func driverValue(value string, typ ColumnType) driver.Value {
+	if typ == StringColumn {
+		return value
+	}
+	if value == "" {
+		return nil
+	}
+	switch typ {
+	case IntegerColumn:
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case FloatColumn:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case BooleanColumn:
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	case DateColumn:
+		if v, err := time.Parse(DateFormat, value); err == nil {
+			return v
+		}
+	case DateTimeColumn:
+		if v, err := time.Parse(DateTimeFormat, value); err == nil {
+			return v
+		}
+	}
+	return value
+}
@@ -0,0 +1,186 @@
+package csvsql
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// queryDB runs query on db and returns the database type names of its
+// columns and its rows.
+func queryDB(t *testing.T, db *sql.DB, query string, args ...interface{}) ([]string, [][]interface{}) {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("Query(%q): %v", query, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		types[i] = ct.DatabaseTypeName()
+	}
+
+	var values [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, len(columnTypes))
+		ptrs := make([]interface{}, len(row))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return types, values
+}
+
+func TestDriverColumnTypes(t *testing.T) {
+	e := newTestEngine(t)
+	data := "{\"id\": 1, \"score\": 9.5, \"ok\": true}\n{\"id\": 2, \"score\": null, \"ok\": false}\n"
+	if err := e.CreateTableFromReader("j", strings.NewReader(data), "ndjson", TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(NewConnector(e))
+	defer db.Close()
+
+	tests := []struct {
+		name      string
+		query     string
+		args      []interface{}
+		wantTypes []string
+		want      [][]interface{}
+	}{
+		{
+			// Untyped columns stay strings whatever their values look like.
+			name:      "untyped column of one row",
+			query:     "SELECT id, zip FROM u WHERE id = ?",
+			args:      []interface{}{"2"},
+			wantTypes: []string{"STRING", "STRING"},
+			want:      [][]interface{}{{"2", "10001"}},
+		},
+		{
+			name:      "untyped column",
+			query:     "SELECT zip FROM u",
+			wantTypes: []string{"STRING"},
+			want:      [][]interface{}{{"02139"}, {"10001"}, {""}},
+		},
+		{
+			name:      "empty result",
+			query:     "SELECT id, zip FROM u WHERE id = '9'",
+			wantTypes: []string{"STRING", "STRING"},
+		},
+		{
+			name:      "typed columns",
+			query:     "SELECT id, score, ok FROM j ORDER BY id",
+			wantTypes: []string{"INTEGER", "FLOAT", "BOOLEAN"},
+			want:      [][]interface{}{{int64(1), 9.5, true}, {int64(2), nil, false}},
+		},
+		{
+			name:      "empty result of typed columns",
+			query:     "SELECT id, score FROM j WHERE id = '9'",
+			wantTypes: []string{"INTEGER", "FLOAT"},
+		},
+		{
+			name:      "union of typed and untyped columns",
+			query:     "SELECT id FROM j UNION SELECT id FROM u ORDER BY id",
+			wantTypes: []string{"STRING"},
+			want:      [][]interface{}{{"1"}, {"2"}, {"3"}},
+		},
+		{
+			name:      "union of typed columns",
+			query:     "SELECT id FROM j UNION ALL SELECT id FROM j ORDER BY id DESC LIMIT 1",
+			wantTypes: []string{"INTEGER"},
+			want:      [][]interface{}{{int64(2)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types, values := queryDB(t, db, tt.query, tt.args...)
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Errorf("types = %q, want %q", types, tt.wantTypes)
+			}
+			if !reflect.DeepEqual(values, tt.want) {
+				t.Errorf("rows = %v, want %v", values, tt.want)
+			}
+		})
+	}
+}
+
+func TestDriverDataSourceName(t *testing.T) {
+	dir := t.TempDir()
+	users := filepath.Join(dir, "users.csv")
+	orders := filepath.Join(dir, "orders.csv")
+	if err := os.WriteFile(users, []byte("id,name\n1,alice\n2,bob\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(orders, []byte("id,user_id,amount\n10,1,5\n11,2,7\n12,2,9\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open(DriverName, "users="+users+"; orders="+orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	stmt, err := db.Prepare("SELECT users.name, orders.amount FROM users JOIN orders ON users.id = orders.user_id WHERE orders.amount > ? ORDER BY orders.amount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query("6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var name, amount string
+		if err := rows.Scan(&name, &amount); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name+":"+amount)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bob:7", "bob:9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+
+	// Wildcard columns are named without their table where that is unique.
+	rows, err = db.Query("SELECT * FROM users JOIN orders ON users.id = orders.user_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"users.id", "name", "orders.id", "user_id", "amount"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("columns = %q, want %q", columns, want)
+	}
+
+	if _, err := db.Exec("SELECT id FROM users"); err == nil {
+		t.Error("Exec succeeded on a read-only driver")
+	}
+	if _, err := db.Begin(); err == nil {
+		t.Error("Begin succeeded without transaction support")
+	}
+	if _, err := sql.Open(DriverName, "users"); err == nil {
+		t.Error("data source entry without a path was accepted")
+	}
+}
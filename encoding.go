@@ -0,0 +1,206 @@
+package csvsql
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Encoding names the character encoding of a text file.
+type Encoding string
+
+const (
+	UTF8        Encoding = "utf-8"
+	UTF16LE     Encoding = "utf-16le"
+	UTF16BE     Encoding = "utf-16be"
+	Windows1252 Encoding = "windows-1252"
+	Latin1      Encoding = "iso-8859-1"
+)
+
+// EncodingErrorMode selects what happens to byte sequences that are invalid
+// in the encoding of a file.
+type EncodingErrorMode int
+
+const (
+	// ReplaceInvalid replaces invalid sequences with U+FFFD.
+	ReplaceInvalid EncodingErrorMode = iota
+	// RejectInvalid fails loading with an ErrInvalidEncoding.
+	RejectInvalid
+)
+
+// decodeReader returns a reader transcoding r from the encoding in opts to
+// UTF-8. A UTF-16 byte order mark selects UTF-16 unless another encoding is
+// set; it is removed, and the encoding used and whether a byte order mark was
+// found are returned. Without an encoding, input is read as UTF-8 unchanged.
+func decodeReader(r io.Reader, opts CSVOptions) (io.Reader, Encoding, bool, error) {
+	buffered := bufio.NewReader(r)
+	enc := Encoding(strings.ToLower(string(opts.Encoding)))
+	bom := false
+
+	prefix, _ := buffered.Peek(2)
+	if len(prefix) == 2 && (enc == "" || enc == UTF16LE || enc == UTF16BE) {
+		switch {
+		case prefix[0] == 0xFF && prefix[1] == 0xFE:
+			enc, bom = UTF16LE, true
+		case prefix[0] == 0xFE && prefix[1] == 0xFF:
+			enc, bom = UTF16BE, true
+		}
+		if bom {
+			buffered.Discard(2)
+		}
+	}
+
+	var decoder *encoding.Decoder
+	var validator transform.Transformer
+	switch enc {
+	case "":
+		return buffered, UTF8, bom, nil
+	case UTF8:
+		decoder = unicode.UTF8.NewDecoder()
+		validator = &utf8Validator{}
+	case UTF16LE:
+		decoder = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder()
+		validator = &utf16Validator{bigEndian: false}
+	case UTF16BE:
+		decoder = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder()
+		validator = &utf16Validator{bigEndian: true}
+	case Windows1252:
+		decoder = charmap.Windows1252.NewDecoder()
+		validator = &charmapValidator{charmap: charmap.Windows1252}
+	case Latin1:
+		decoder = charmap.ISO8859_1.NewDecoder()
+		validator = &charmapValidator{charmap: charmap.ISO8859_1}
+	default:
+		return nil, "", false, fmt.Errorf("unsupported encoding: %s", opts.Encoding)
+	}
+
+	var source io.Reader = buffered
+	if opts.EncodingErrors == RejectInvalid {
+		checker := &encodingChecker{validator: validator, encoding: enc}
+		if bom {
+			checker.offset = 2
+		}
+		source = transform.NewReader(source, checker)
+	}
+	return transform.NewReader(source, decoder), enc, bom, nil
+}
+
+// encodingChecker passes input through unchanged, failing with an
+// ErrInvalidEncoding at the first sequence validator rejects.
+type encodingChecker struct {
+	validator transform.Transformer
+	encoding  Encoding
+	offset    int64
+}
+
+func (c *encodingChecker) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	nDst, nSrc, err := c.validator.Transform(dst, src, atEOF)
+	c.offset += int64(nSrc)
+	if err == errInvalidSequence {
+		err = &ErrInvalidEncoding{Encoding: c.encoding, Offset: c.offset}
+	}
+	return nDst, nSrc, err
+}
+
+func (c *encodingChecker) Reset() {
+	c.validator.Reset()
+}
+
+var errInvalidSequence = errors.New("invalid sequence")
+
+// validPrefix copies src[:n] to dst, the valid prefix of src found by a
+// validator, and reports err unless dst is too small.
+func validPrefix(dst, src []byte, n int, err error) (int, int, error) {
+	if len(dst) < n {
+		n = copy(dst, src[:len(dst)])
+		return n, n, transform.ErrShortDst
+	}
+	copy(dst, src[:n])
+	return n, n, err
+}
+
+type utf8Validator struct{ transform.NopResetter }
+
+func (v *utf8Validator) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	for i := 0; i < len(src); {
+		if src[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(src[i:])
+		if r == utf8.RuneError && size <= 1 {
+			if !atEOF && !utf8.FullRune(src[i:]) {
+				return validPrefix(dst, src, i, transform.ErrShortSrc)
+			}
+			return validPrefix(dst, src, i, errInvalidSequence)
+		}
+		i += size
+	}
+	return validPrefix(dst, src, len(src), nil)
+}
+
+type utf16Validator struct {
+	transform.NopResetter
+	bigEndian bool
+}
+
+func (v *utf16Validator) unit(b []byte) rune {
+	if v.bigEndian {
+		return rune(b[0])<<8 | rune(b[1])
+	}
+	return rune(b[1])<<8 | rune(b[0])
+}
+
+func (v *utf16Validator) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	i := 0
+	for i+1 < len(src) {
+		unit := v.unit(src[i:])
+		if !utf16.IsSurrogate(unit) {
+			i += 2
+			continue
+		}
+		if unit >= 0xDC00 {
+			return validPrefix(dst, src, i, errInvalidSequence)
+		}
+		if i+3 >= len(src) {
+			if !atEOF {
+				return validPrefix(dst, src, i, transform.ErrShortSrc)
+			}
+			return validPrefix(dst, src, i, errInvalidSequence)
+		}
+		if low := v.unit(src[i+2:]); low < 0xDC00 || low > 0xDFFF {
+			return validPrefix(dst, src, i, errInvalidSequence)
+		}
+		i += 4
+	}
+	if i < len(src) {
+		if !atEOF {
+			return validPrefix(dst, src, i, transform.ErrShortSrc)
+		}
+		return validPrefix(dst, src, i, errInvalidSequence)
+	}
+	return validPrefix(dst, src, i, nil)
+}
+
+type charmapValidator struct {
+	transform.NopResetter
+	charmap *charmap.Charmap
+}
+
+func (v *charmapValidator) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	for i, b := range src {
+		if v.charmap.DecodeByte(b) == utf8.RuneError {
+			return validPrefix(dst, src, i, errInvalidSequence)
+		}
+	}
+	return validPrefix(dst, src, len(src), nil)
+}
@@ -0,0 +1,88 @@
+package csvsql
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encodeUTF16 encodes s as UTF-16 code units, little or big endian.
+func encodeUTF16(s string, bigEndian bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		hi, lo := byte(r>>8), byte(r)
+		if bigEndian {
+			b.WriteByte(hi)
+			b.WriteByte(lo)
+		} else {
+			b.WriteByte(lo)
+			b.WriteByte(hi)
+		}
+	}
+	return b.String()
+}
+
+func TestEncodings(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		opts CSVOptions
+		want [][]string
+	}{
+		{"utf-8 unchanged", "name\ncafé\n", CSVOptions{}, [][]string{{"café"}}},
+		{"windows-1252", "name\ncaf\xe9 \x80\n", CSVOptions{Encoding: Windows1252}, [][]string{{"café €"}}},
+		{"latin-1", "name\ncaf\xe9\n", CSVOptions{Encoding: Latin1}, [][]string{{"café"}}},
+		{"encoding names ignore case", "name\ncaf\xe9\n", CSVOptions{Encoding: "ISO-8859-1"}, [][]string{{"café"}}},
+		{"utf-16le byte order mark", "\xff\xfe" + encodeUTF16("name\ncafé\n", false), CSVOptions{}, [][]string{{"café"}}},
+		{"utf-16be byte order mark", "\xfe\xff" + encodeUTF16("name\ncafé\n", true), CSVOptions{}, [][]string{{"café"}}},
+		{"utf-16be without byte order mark", encodeUTF16("name\ncafé\n", true), CSVOptions{Encoding: UTF16BE}, [][]string{{"café"}}},
+		{"invalid utf-8 replaced", "name\nca\xfff\n", CSVOptions{Encoding: UTF8}, [][]string{{"ca�f"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := newTableFromCSVReader("t", strings.NewReader(tt.data), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(table.Headers, []string{"name"}) {
+				t.Errorf("headers = %q, want [name]", table.Headers)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.want) {
+				t.Errorf("rows = %q, want %q", table.Rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectInvalidEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		encoding Encoding
+		offset   int64
+	}{
+		{"utf-8", "name\nca\xfff\n", UTF8, 7},
+		// The offset counts the byte order mark.
+		{"utf-16le lone low surrogate", "\xff\xfe" + encodeUTF16("name\n", false) + "\x00\xdc", UTF16LE, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := CSVOptions{Encoding: tt.encoding, EncodingErrors: RejectInvalid}
+			_, err := newTableFromCSVReader("t", strings.NewReader(tt.data), opts)
+			var invalid *ErrInvalidEncoding
+			if !errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want an ErrInvalidEncoding", err)
+			}
+			if invalid.Encoding != tt.encoding || invalid.Offset != tt.offset {
+				t.Errorf("err = %+v, want %s at byte %d", invalid, tt.encoding, tt.offset)
+			}
+		})
+	}
+
+	if _, err := newTableFromCSVReader("t", strings.NewReader("name\n"), CSVOptions{Encoding: "ebcdic"}); err == nil {
+		t.Error("unsupported encoding was accepted")
+	}
+}
@@ -1,23 +1,97 @@
 package csvsql
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Engine is safe for concurrent use. Tables and indexes can be created while
+// queries run; every query sees the catalog as it was when the query started.
+// Queries are never modified by the engine, so one query can be executed by
+// several goroutines at once.
 type Engine struct {
-	tables map[string]*Table
+	mu      sync.RWMutex
+	tables  map[string]*Table
+	indexes map[string]map[int]*Index
+	config  engineConfig
+
+	// guard is only set on the snapshot running a query, and stats only
+	// when that query runs under ExplainAnalyze.
+	guard *queryGuard
+	stats *planStats
 }
 
-func NewEngine() *Engine {
-	return &Engine{
-		tables: make(map[string]*Table),
+// engineConfig holds the settings applied by EngineOptions. noOptimize turns
+// off predicate push-down and join reordering, so that the optimizer can be
+// checked against plain execution.
+type engineConfig struct {
+	parallelism    int
+	limits         ResourceLimits
+	spillDir       string
+	spillThreshold int64
+	noOptimize     bool
+}
+
+// EngineOption configures an Engine created by NewEngine.
+type EngineOption func(*Engine)
+
+func NewEngine(opts ...EngineOption) *Engine {
+	e := &Engine{
+		tables:  make(map[string]*Table),
+		indexes: make(map[string]map[int]*Index),
+		config:  engineConfig{parallelism: 1},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// TableOptions control how CreateTableWithOptions loads a file.
+type TableOptions struct {
+	// Sheet selects the worksheet of an XLSX file; the first sheet is used
+	// when it is empty. It is a shorthand for XLSX.Sheet.
+	Sheet string
+	// XLSX selects the cells of an XLSX file that make up the table.
+	XLSX XLSXOptions
+	// CSV controls parsing of .csv and .tsv files.
+	CSV CSVOptions
+	// SchemaDrift controls how the files matched by a glob pattern may
+	// differ in their columns.
+	SchemaDrift SchemaDrift
+	// FileColumn adds a _file column holding the path of the file each row
+	// of a glob pattern was read from.
+	FileColumn bool
+}
+
+func (opts TableOptions) xlsxOptions() XLSXOptions {
+	xlsx := opts.XLSX
+	if xlsx.Sheet == "" {
+		xlsx.Sheet = opts.Sheet
 	}
+	return xlsx
 }
 
 func (e *Engine) CreateTable(alias, filepath string, sheetName ...string) error {
+	var opts TableOptions
+	if len(sheetName) > 0 {
+		opts.Sheet = sheetName[0]
+	}
+	return e.CreateTableWithOptions(alias, filepath, opts)
+}
+
+// CreateTableWithOptions registers the file at filepath as table alias,
+// loaded according to opts. A filepath holding glob metacharacters, such as
+// orders/*.csv, registers the concatenation of all matching files, unless a
+// file of that exact name exists.
+func (e *Engine) CreateTableWithOptions(alias, filepath string, opts TableOptions) error {
 	if alias == "" {
 		return fmt.Errorf("table alias cannot be empty")
 	}
@@ -26,100 +100,455 @@ func (e *Engine) CreateTable(alias, filepath string, sheetName ...string) error
 		return fmt.Errorf("filepath cannot be empty")
 	}
 
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
+	_, err := os.Stat(filepath)
+	glob := err != nil && isGlobPattern(filepath)
+	if os.IsNotExist(err) && !glob {
 		return fmt.Errorf("file does not exist: %s", filepath)
 	}
 
-	if _, exists := e.tables[alias]; exists {
+	if e.hasTable(alias) {
 		return fmt.Errorf("table with alias '%s' already exists", alias)
 	}
 
+	load := e.loadFile
+	if glob {
+		load = e.loadFileSet
+	}
+	table, err := load(alias, filepath, opts)
+	if err != nil {
+		return err
+	}
+	return e.addTable(alias, table)
+}
+
+// loadFile loads the file at filepath as table alias without registering it.
+func (e *Engine) loadFile(alias, filepath string, opts TableOptions) (*Table, error) {
+	// Compressed files are recognised by the extension before the one of
+	// the compression format, as in orders.csv.gz.
+	name := strings.ToLower(trimCompressionExt(filepath))
 	switch {
-	case strings.HasSuffix(strings.ToLower(filepath), ".csv"):
-		return e.createTableFromCsv(alias, filepath)
-	case strings.HasSuffix(strings.ToLower(filepath), ".xlsx"):
-		return e.createTableFromXlsx(alias, filepath, sheetName...)
+	case strings.HasSuffix(name, ".csv"):
+		return e.loadCsv(alias, filepath, opts.CSV)
+	case strings.HasSuffix(name, ".tsv"):
+		return e.loadCsv(alias, filepath, tsvOptions(opts.CSV))
+	case strings.HasSuffix(name, ".xlsx"):
+		return e.loadXlsx(alias, filepath, opts.xlsxOptions())
+	case strings.HasSuffix(name, ".json"),
+		strings.HasSuffix(name, ".ndjson"),
+		strings.HasSuffix(name, ".jsonl"):
+		return e.loadJson(alias, filepath)
+	case strings.HasSuffix(name, ".parquet"):
+		return e.loadParquet(alias, filepath)
+	default:
+		return nil, fmt.Errorf("unsupported file format: file must be .csv, .tsv, .xlsx, .json, .ndjson, .jsonl or .parquet, optionally compressed as .gz, .zst or .bz2")
+	}
+}
+
+// CreateTableFromReader registers the data read from r as table alias. format
+// is the extension the data would have as a file, such as "csv" or
+// "json.gz"; compressed data is also recognised without the extension of its
+// compression format. All data is read before the function returns.
+func (e *Engine) CreateTableFromReader(alias string, r io.Reader, format string, opts TableOptions) error {
+	if alias == "" {
+		return fmt.Errorf("table alias cannot be empty")
+	}
+
+	if r == nil {
+		return fmt.Errorf("reader cannot be nil")
+	}
+
+	if e.hasTable(alias) {
+		return fmt.Errorf("table with alias '%s' already exists", alias)
+	}
+
+	decompressed, compressed, err := decompressReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to create table from reader: %w", err)
+	}
+	defer decompressed.Close()
+
+	var table *Table
+	format = strings.ToLower(trimCompressionExt(strings.TrimPrefix(format, ".")))
+	switch format {
+	case "csv", "tsv":
+		csvOpts := opts.CSV
+		if format == "tsv" {
+			csvOpts = tsvOptions(csvOpts)
+		}
+		table, err = newTableFromCSVReader(alias, decompressed, csvOpts)
+		if err != nil {
+			return fmt.Errorf("failed to create table from CSV: %w", err)
+		}
+	case "xlsx":
+		table, err = newTableFromXlsxReader(alias, decompressed, opts.xlsxOptions())
+		if err != nil {
+			return fmt.Errorf("failed to create table from XLSX: %w", err)
+		}
+	case "json", "ndjson", "jsonl":
+		table, err = newTableFromJSONReader(alias, decompressed)
+		if err != nil {
+			return fmt.Errorf("failed to create table from JSON: %w", err)
+		}
+	case "parquet":
+		if compressed {
+			return fmt.Errorf("compressed parquet files are not supported, as parquet compresses column chunks itself")
+		}
+		table, err = newParquetTableFromReader(alias, decompressed)
+		if err != nil {
+			return fmt.Errorf("failed to create table from Parquet: %w", err)
+		}
 	default:
-		return fmt.Errorf("unsupported file format: file must be .csv or .xlsx")
+		return fmt.Errorf("unsupported format %q: format must be csv, tsv, xlsx, json, ndjson, jsonl or parquet, optionally compressed as gz, zst or bz2", format)
+	}
+
+	if err := e.validateHeaders(table.Headers, fmt.Sprintf("input of table '%s'", alias)); err != nil {
+		return err
+	}
+
+	return e.addTable(alias, table)
+}
+
+// CreateTableFromRows registers headers and rows as table alias. Every row
+// must have one value per header. The rows are copied, so the caller may
+// reuse them.
+func (e *Engine) CreateTableFromRows(alias string, headers []string, rows [][]string) error {
+	if alias == "" {
+		return fmt.Errorf("table alias cannot be empty")
+	}
+
+	if e.hasTable(alias) {
+		return fmt.Errorf("table with alias '%s' already exists", alias)
+	}
+
+	table, err := NewTableFromRows(alias, headers, rows)
+	if err != nil {
+		return fmt.Errorf("failed to create table from rows: %w", err)
+	}
+
+	if err := e.validateHeaders(table.Headers, fmt.Sprintf("input of table '%s'", alias)); err != nil {
+		return err
+	}
+
+	return e.addTable(alias, table)
+}
+
+// CreateTableFromStructs registers a slice of structs, or of pointers to
+// structs, as table alias. See NewTableFromStructs for how fields become
+// columns.
+func (e *Engine) CreateTableFromStructs(alias string, records any) error {
+	if alias == "" {
+		return fmt.Errorf("table alias cannot be empty")
+	}
+
+	if e.hasTable(alias) {
+		return fmt.Errorf("table with alias '%s' already exists", alias)
+	}
+
+	table, err := NewTableFromStructs(alias, records)
+	if err != nil {
+		return fmt.Errorf("failed to create table from structs: %w", err)
+	}
+
+	if err := e.validateHeaders(table.Headers, fmt.Sprintf("input of table '%s'", alias)); err != nil {
+		return err
 	}
+
+	return e.addTable(alias, table)
 }
 
-func (e *Engine) validateHeaders(headers []string, filepath string) error {
+// validateHeaders checks the headers of a table loaded from origin, which
+// names the file or other input in error messages.
+func (e *Engine) validateHeaders(headers []string, origin string) error {
 	if len(headers) == 0 {
-		return fmt.Errorf("file '%s' has no headers", filepath)
+		return fmt.Errorf("%s has no headers", origin)
 	}
 
 	headerSet := make(map[string]bool)
 	for _, header := range headers {
 		if header == "" {
-			return fmt.Errorf("file '%s' contains empty header name", filepath)
+			return fmt.Errorf("%s contains empty header name", origin)
 		}
 		if headerSet[header] {
-			return fmt.Errorf("file '%s' contains duplicate header: %s", filepath, header)
+			return fmt.Errorf("%s contains duplicate header: %s", origin, header)
 		}
 		headerSet[header] = true
 	}
 	return nil
 }
 
-func (e *Engine) createTableFromCsv(alias, filepath string) error {
-	table, err := NewTableFromCSV(alias, filepath)
+func fileOrigin(filepath string) string {
+	return fmt.Sprintf("file '%s'", filepath)
+}
+
+func (e *Engine) loadCsv(alias, filepath string, opts CSVOptions) (*Table, error) {
+	table, err := NewTableFromCSVWithOptions(alias, filepath, opts)
 	if err != nil {
-		return fmt.Errorf("failed to create table from CSV: %w", err)
+		return nil, fmt.Errorf("failed to create table from CSV: %w", err)
 	}
 
-	if err := e.validateHeaders(table.Headers, filepath); err != nil {
-		return err
+	if err := e.validateHeaders(table.Headers, fileOrigin(filepath)); err != nil {
+		return nil, err
 	}
+	return table, nil
+}
 
-	e.tables[alias] = table
-	return nil
+// tsvOptions returns opts with tabs as the default delimiter.
+func tsvOptions(opts CSVOptions) CSVOptions {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = '\t'
+	}
+	return opts
 }
 
-func (e *Engine) createTableFromXlsx(alias, filepath string, sheetName ...string) error {
-	table, err := NewTableFromXlsx(alias, filepath, sheetName...)
+func (e *Engine) loadXlsx(alias, filepath string, opts XLSXOptions) (*Table, error) {
+	table, err := NewTableFromXlsxWithOptions(alias, filepath, opts)
 	if err != nil {
-		return fmt.Errorf("failed to create table from XLSX: %w", err)
+		return nil, fmt.Errorf("failed to create table from XLSX: %w", err)
 	}
 
-	if err := e.validateHeaders(table.Headers, filepath); err != nil {
-		return err
+	if err := e.validateHeaders(table.Headers, fileOrigin(filepath)); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+func (e *Engine) loadJson(alias, filepath string) (*Table, error) {
+	table, err := NewTableFromJSON(alias, filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table from JSON: %w", err)
 	}
 
+	if err := e.validateHeaders(table.Headers, fileOrigin(filepath)); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// loadParquet loads a Parquet file whose rows are read by every query, so
+// only the schema is loaded here.
+func (e *Engine) loadParquet(alias, filepath string) (*Table, error) {
+	table, err := newParquetTable(alias, filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table from Parquet: %w", err)
+	}
+
+	if err := e.validateHeaders(table.Headers, fileOrigin(filepath)); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+func (e *Engine) hasTable(alias string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, exists := e.tables[alias]
+	return exists
+}
+
+// addTable registers a loaded table. Files are loaded without holding the
+// lock, so the alias is checked again in case a concurrent CreateTable
+// registered it in the meantime.
+func (e *Engine) addTable(alias string, table *Table) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, exists := e.tables[alias]; exists {
+		return fmt.Errorf("table with alias '%s' already exists", alias)
+	}
 	e.tables[alias] = table
 	return nil
 }
 
+// addTables registers several loaded tables, named by their Name, at once:
+// if any alias is taken, none of them is registered.
+func (e *Engine) addTables(tables []*Table) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, table := range tables {
+		if _, exists := e.tables[table.Name]; exists {
+			return fmt.Errorf("table with alias '%s' already exists", table.Name)
+		}
+	}
+	for _, table := range tables {
+		e.tables[table.Name] = table
+	}
+	return nil
+}
+
+// snapshot returns an engine sharing the current tables and indexes. Tables
+// and indexes are never modified once created, so a query can run against the
+// snapshot without holding the lock.
+func (e *Engine) snapshot() *Engine {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	s := &Engine{
+		tables:  make(map[string]*Table, len(e.tables)),
+		indexes: make(map[string]map[int]*Index, len(e.indexes)),
+		config:  e.config,
+	}
+	for name, table := range e.tables {
+		s.tables[name] = table
+	}
+	for name, indexes := range e.indexes {
+		s.indexes[name] = make(map[int]*Index, len(indexes))
+		for colIdx, idx := range indexes {
+			s.indexes[name][colIdx] = idx
+		}
+	}
+	return s
+}
+
 func (e *Engine) ExecuteQuery(q *Query) ([][]string, error) {
-	results, err := e.executeQueryInternal(q)
+	return e.ExecuteQueryContext(context.Background(), q)
+}
+
+// ExecuteQueryContext is like ExecuteQuery but stops and returns ctx.Err() as
+// soon as ctx is done. Cancellation is checked while scanning, joining and
+// filtering rows, while computing window functions and sorting, before every
+// custom function call and between set operation operands.
+func (e *Engine) ExecuteQueryContext(ctx context.Context, q *Query) ([][]string, error) {
+	results, _, err := e.executeSnapshot(ctx, q)
+	return results, err
+}
+
+// ExecuteQueryWithTypes runs q like ExecuteQuery and also returns the type of
+// every result column, as the exports use them: columns read from typed table
+// columns keep their type when all their values fit it, and other columns are
+// typed by their values.
+func (e *Engine) ExecuteQueryWithTypes(q *Query) ([][]string, []ColumnType, error) {
+	return e.ExecuteQueryWithTypesContext(context.Background(), q)
+}
+
+// ExecuteQueryWithTypesContext is like ExecuteQueryWithTypes but stops once
+// ctx is done, like ExecuteQueryContext.
+func (e *Engine) ExecuteQueryWithTypesContext(ctx context.Context, q *Query) ([][]string, []ColumnType, error) {
+	results, s, err := e.executeSnapshot(ctx, q)
 	if err != nil {
+		return nil, nil, err
+	}
+	return results, s.resultColumnTypes(q, results), nil
+}
+
+// executeSnapshot runs q on a snapshot of the engine, which it returns along
+// with the results.
+func (e *Engine) executeSnapshot(ctx context.Context, q *Query) ([][]string, *Engine, error) {
+	s := e.snapshot()
+	if err := s.loadSources(ctx, q); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return nil, nil, ctxErr
+		}
+		return nil, nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	stmt, err := s.planStatement(q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query execution failed: %w", err)
+	}
+
+	results, err := s.execute(ctx, q, stmt)
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		return nil, nil, ctxErr
+	}
+	return results, s, err
+}
+
+// execute runs a planned statement on a snapshot, enforcing the stricter of
+// the engine's and the query's resource limits.
+func (e *Engine) execute(ctx context.Context, q *Query, stmt *statementPlan) ([][]string, error) {
+	limits := e.config.limits.merge(q.ResourceLimits)
+	e.guard = newQueryGuard(limits)
+	e.guard.result = stmt
+	if limits.MaxExecutionTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, e.guard.deadline)
+		defer cancel()
+	}
+
+	results, err := e.executeStatement(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.guard.checkResult(stmt.root.Type, len(results)-1); err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
 	}
+	return results, nil
+}
 
-	if q.Union != nil {
-		return e.handleUnionOperation(q, results)
+// checkContext returns ctx.Err() once ctx is done. It does not block and is
+// cheap enough to call for every row.
+func checkContext(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+func (e *Engine) executeStatement(ctx context.Context, stmt *statementPlan) ([][]string, error) {
+	results, err := e.executeQueryInternal(ctx, stmt.base)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+
+	if stmt.set != nil {
+		return e.handleUnionOperation(ctx, stmt, results)
 	}
 
 	return results, nil
 }
 
-func (e *Engine) executeQueryInternal(q *Query) ([][]string, error) {
-	if err := e.validateQuery(q); err != nil {
-		return nil, err
+func (e *Engine) executeQueryInternal(ctx context.Context, p *queryPlan) ([][]string, error) {
+	q := p.query
+
+	start := time.Now()
+	joinedRows, err := e.initializeJoinedRows(ctx, p, e.tables[q.From.Table])
+	if err == nil {
+		err = e.guard.checkRows(p.scan.Type, len(joinedRows), joinedRowBytes+tableRowBytes)
 	}
+	if err != nil {
+		return nil, e.guard.operatorError(p.scan.Type, err)
+	}
+	e.stats.record(p.scan, len(joinedRows), start)
 
-	mainTable := e.tables[q.From.Table]
-	joinedRows := e.initializeJoinedRows(mainTable)
+	for _, step := range p.joins {
+		start := time.Now()
+		ids, err := e.scanRows(ctx, step.table, step.access)
+		if err != nil {
+			return nil, e.guard.operatorError(step.scan.Type, err)
+		}
+		if ids != nil {
+			e.stats.record(step.scan, len(ids), start)
+		} else {
+			e.stats.record(step.scan, len(step.table.Rows), start)
+		}
 
-	if err := e.processJoins(q, &joinedRows); err != nil {
-		return nil, err
+		start = time.Now()
+		if err := e.performJoin(ctx, step, ids, &joinedRows); err != nil {
+			return nil, e.guard.operatorError(step.node.Type, err)
+		}
+		e.stats.record(step.node, countActiveRows(joinedRows), start)
+	}
+	if p.reordered {
+		restoreJoinOrder(joinedRows)
 	}
 
-	if err := e.applyWhereCondition(q, &joinedRows); err != nil {
-		return nil, err
+	start = time.Now()
+	if err := e.applyWhereCondition(ctx, p.residual, &joinedRows); err != nil {
+		return nil, e.guard.operatorError(FilterNode, err)
 	}
+	e.stats.record(p.filter, countActiveRows(joinedRows), start)
 
-	return e.projectColumns(q, joinedRows)
+	start = time.Now()
+	if err := e.applyWindowFunctions(ctx, q, &joinedRows); err != nil {
+		return nil, e.guard.operatorError(WindowNode, err)
+	}
+	e.stats.record(p.window, countActiveRows(joinedRows), start)
+
+	results, err := e.projectColumns(ctx, p, joinedRows)
+	if err != nil {
+		return nil, e.guard.operatorError(ProjectNode, err)
+	}
+	return results, nil
 }
 
 func (e *Engine) validateQuery(q *Query) error {
@@ -127,83 +556,234 @@ func (e *Engine) validateQuery(q *Query) error {
 		return fmt.Errorf("FROM clause is required")
 	}
 
-	mainTable, ok := e.tables[q.From.Table]
-	if !ok {
+	if _, ok := e.tables[q.From.Table]; !ok {
 		return fmt.Errorf("table %s not found", q.From.Table)
 	}
 
-	if q.Select == nil {
-		q.Select = &SelectComponent{Columns: mainTable.Headers}
-	}
-
 	return nil
 }
 
 type JoinedRow struct {
-	mainRow    []string
-	mainTable  string
-	joinedRows map[string][]string
-	isFiltered bool
+	mainRow      []string
+	mainTable    string
+	joinedRows   map[string][]string
+	windowValues map[string]string
+	rowIDs       []int
+	isFiltered   bool
 }
 
-func (e *Engine) initializeJoinedRows(mainTable *Table) []JoinedRow {
-	joinedRows := make([]JoinedRow, 0, len(mainTable.Rows))
-	for _, mainRow := range mainTable.Rows {
+// initializeJoinedRows scans the FROM table. rowIDs records the id of the row
+// taken from every table, indexed by the table's position in the query, so
+// that results of reordered joins can be put back in query order.
+func (e *Engine) initializeJoinedRows(ctx context.Context, p *queryPlan, mainTable *Table) ([]JoinedRow, error) {
+	ids, err := e.scanRows(ctx, mainTable, p.access[mainTable.Name])
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = make([]int, len(mainTable.Rows))
+		for i := range ids {
+			ids[i] = i
+		}
+	}
+
+	joinedRows := make([]JoinedRow, 0, len(ids))
+	for _, id := range ids {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		rowIDs := make([]int, len(p.query.Joins)+1)
+		rowIDs[0] = id
 		joinedRows = append(joinedRows, JoinedRow{
-			mainRow:    mainRow,
+			mainRow:    mainTable.Rows[id],
 			mainTable:  mainTable.Name,
 			joinedRows: make(map[string][]string),
+			rowIDs:     rowIDs,
 			isFiltered: false,
 		})
 	}
-	return joinedRows
+	return joinedRows, nil
 }
 
-func (e *Engine) processJoins(q *Query, joinedRows *[]JoinedRow) error {
-	for _, join := range q.Joins {
-		joinedTable, ok := e.tables[join.Table]
-		if !ok {
-			return fmt.Errorf("join table %s not found", join.Table)
+// restoreJoinOrder sorts joined rows back into the order the joins would have
+// produced them in when run as written, which is ascending by row id of each
+// table in query order.
+func restoreJoinOrder(joinedRows []JoinedRow) {
+	sort.SliceStable(joinedRows, func(i, j int) bool {
+		a, b := joinedRows[i].rowIDs, joinedRows[j].rowIDs
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+}
+
+func countActiveRows(joinedRows []JoinedRow) int {
+	count := 0
+	for _, jr := range joinedRows {
+		if !jr.isFiltered {
+			count++
 		}
+	}
+	return count
+}
+
+// performJoin joins the rows of step.table listed in ids, or all of them when
+// ids is nil, to joinedRows.
+func (e *Engine) performJoin(ctx context.Context, step *joinStep, ids []int, joinedRows *[]JoinedRow) error {
+	join, joinedTable := step.join, step.table
+	allowed := rowMask(ids, len(joinedTable.Rows))
+	padRight := join.JoinType == RightJoin || join.JoinType == FullJoin
+
+	// Equality joins without an index hash the joined table for this run
+	// only; the plan is left as it is.
+	probe := step.probe
+	if probe != nil && probe.index == nil {
+		hashed := *probe
+		hashed.index = newHashIndex(joinedTable, probe.column)
+		probe = &hashed
+	}
 
-		if err := e.performJoin(join, joinedTable, joinedRows); err != nil {
-			return err
+	// Every worker probes its own range of joined rows and records the
+	// joined-table rows it matched separately, so no state is shared.
+	counter := &rowCounter{
+		guard:    e.guard,
+		op:       step.node.Type,
+		rowBytes: joinedRowBytes + tableRowBytes*int64(len(step.previous)+1),
+	}
+	if partitions, ok := e.useGraceHashJoin(step, *joinedRows); ok {
+		return e.graceHashJoin(ctx, step, allowed, joinedRows, counter, partitions)
+	}
+	parts := e.partitions(len(*joinedRows))
+	results := make([][]JoinedRow, len(parts))
+	matches := make([][]bool, len(parts))
+	err := runPartitions(parts, func(i int, part partition) error {
+		if padRight {
+			matches[i] = make([]bool, len(joinedTable.Rows))
+		}
+		var err error
+		results[i], err = e.probeJoin(ctx, step, probe, (*joinedRows)[part.lo:part.hi], allowed, matches[i], counter)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var newJoinedRows []JoinedRow
+	for _, rows := range results {
+		newJoinedRows = append(newJoinedRows, rows...)
+	}
+
+	if padRight {
+		for rowIdx, joinRow := range joinedTable.Rows {
+			if allowed != nil && !allowed[rowIdx] {
+				continue
+			}
+			matched := false
+			for _, m := range matches {
+				matched = matched || m[rowIdx]
+			}
+			if !matched {
+				if err := counter.add(1); err != nil {
+					return err
+				}
+				newJoinedRows = append(newJoinedRows, e.createPaddedJoinedRow(step, joinRow, rowIdx))
+			}
 		}
 	}
+
+	*joinedRows = newJoinedRows
 	return nil
 }
 
-func (e *Engine) performJoin(join *JoinComponent, joinedTable *Table, joinedRows *[]JoinedRow) error {
+// probeJoin joins every active row of joinedRows with the matching rows of
+// the joined table, looked up through probe unless it is nil, counting the
+// rows it produces with counter. Matched joined-table rows are flagged in
+// matchedJoinRows when it is not nil.
+func (e *Engine) probeJoin(ctx context.Context, step *joinStep, probe *joinProbe, joinedRows []JoinedRow, allowed, matchedJoinRows []bool, counter *rowCounter) ([]JoinedRow, error) {
 	var newJoinedRows []JoinedRow
 
-	for _, jr := range *joinedRows {
+	join, joinedTable := step.join, step.table
+	allRows := make([]int, len(joinedTable.Rows))
+	for i := range allRows {
+		allRows[i] = i
+	}
+
+	for _, jr := range joinedRows {
 		if jr.isFiltered {
 			continue
 		}
 
+		candidates := allRows
+		if probe != nil {
+			if ids, ok := probe.candidates(jr); ok {
+				candidates = ids
+			}
+		}
+
 		matched := false
-		for _, joinRow := range joinedTable.Rows {
-			if match, err := e.evaluateJoinCondition(join, jr, joinRow, joinedTable); err != nil {
-				return err
+		for _, rowIdx := range candidates {
+			if allowed != nil && !allowed[rowIdx] {
+				continue
+			}
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			joinRow := joinedTable.Rows[rowIdx]
+			if match, err := e.evaluateJoinCondition(step, jr, joinRow); err != nil {
+				return nil, err
 			} else if match {
-				newJr := e.createNewJoinedRow(jr, join.Table, joinRow)
+				if err := counter.add(1); err != nil {
+					return nil, err
+				}
+				newJr := e.createNewJoinedRow(jr, step, joinRow, rowIdx)
 				newJoinedRows = append(newJoinedRows, newJr)
 				matched = true
+				if matchedJoinRows != nil {
+					matchedJoinRows[rowIdx] = true
+				}
 			}
 		}
 
-		if !matched && join.JoinType == InnerJoin {
-			jr.isFiltered = true
+		if !matched && (join.JoinType == LeftJoin || join.JoinType == FullJoin) {
+			if err := counter.add(1); err != nil {
+				return nil, err
+			}
+			newJoinedRows = append(newJoinedRows, e.createNewJoinedRow(jr, step, make([]string, len(joinedTable.Headers)), -1))
 		}
 	}
 
-	if len(newJoinedRows) > 0 {
-		*joinedRows = newJoinedRows
+	return newJoinedRows, nil
+}
+
+// createPaddedJoinedRow builds the row of an outer join for a joined-table
+// row that matched nothing, with empty values for all previous tables.
+func (e *Engine) createPaddedJoinedRow(step *joinStep, joinRow []string, rowIdx int) JoinedRow {
+	previous := step.previous
+	jr := JoinedRow{
+		mainRow:    make([]string, len(e.tables[previous[0]].Headers)),
+		mainTable:  previous[0],
+		joinedRows: make(map[string][]string),
+		rowIDs:     make([]int, step.width),
 	}
-	return nil
+	for i := range jr.rowIDs {
+		jr.rowIDs[i] = -1
+	}
+	for _, prev := range previous[1:] {
+		jr.joinedRows[prev] = make([]string, len(e.tables[prev].Headers))
+	}
+	jr.joinedRows[step.join.Table] = joinRow
+	jr.rowIDs[step.position] = rowIdx
+	return jr
 }
 
-func (e *Engine) evaluateJoinCondition(join *JoinComponent, jr JoinedRow, joinRow []string, joinedTable *Table) (bool, error) {
+// evaluateJoinCondition matches jr with a row of the joined table. Tables of
+// jr padded by an earlier outer join hold no values, so comparisons with
+// their columns never match, like comparisons with NULL in SQL.
+func (e *Engine) evaluateJoinCondition(step *joinStep, jr JoinedRow, joinRow []string) (bool, error) {
+	join, joinedTable := step.join, step.table
 	if join.Condition == nil {
 		return true, nil
 	}
@@ -222,20 +802,41 @@ func (e *Engine) evaluateJoinCondition(join *JoinComponent, jr JoinedRow, joinRo
 	rowMap[join.Table] = joinRow
 	tableMap[join.Table] = joinedTable
 
+	if padded := step.paddedTables(jr); padded != nil {
+		return evaluateJoinWithPadding(join.Condition, rowMap, tableMap, padded)
+	}
 	return join.Condition.EvaluateJoin(rowMap, tableMap)
 }
 
-func (e *Engine) createNewJoinedRow(jr JoinedRow, tableName string, joinRow []string) JoinedRow {
+// paddedTables returns the tables of jr that an outer join padded, or nil when
+// there are none.
+func (s *joinStep) paddedTables(jr JoinedRow) map[string]bool {
+	var padded map[string]bool
+	for i, name := range s.previous {
+		if jr.rowIDs[s.positions[i]] >= 0 {
+			continue
+		}
+		if padded == nil {
+			padded = make(map[string]bool)
+		}
+		padded[name] = true
+	}
+	return padded
+}
+
+func (e *Engine) createNewJoinedRow(jr JoinedRow, step *joinStep, joinRow []string, rowIdx int) JoinedRow {
 	newJr := JoinedRow{
 		mainRow:    jr.mainRow,
 		mainTable:  jr.mainTable,
 		joinedRows: make(map[string][]string),
+		rowIDs:     append([]int(nil), jr.rowIDs...),
 		isFiltered: false,
 	}
 	for k, v := range jr.joinedRows {
 		newJr.joinedRows[k] = v
 	}
-	newJr.joinedRows[tableName] = joinRow
+	newJr.joinedRows[step.join.Table] = joinRow
+	newJr.rowIDs[step.position] = rowIdx
 	return newJr
 }
 
@@ -259,28 +860,34 @@ func (e *Engine) findMainTable(row []string) *Table {
 	return nil
 }
 
-func (e *Engine) applyWhereCondition(q *Query, joinedRows *[]JoinedRow) error {
-	if q.Where == nil {
+func (e *Engine) applyWhereCondition(ctx context.Context, condition Condition, joinedRows *[]JoinedRow) error {
+	if condition == nil {
 		return nil
 	}
 
-	for i := range *joinedRows {
-		if (*joinedRows)[i].isFiltered {
-			continue
-		}
+	rows := *joinedRows
+	return runPartitions(e.partitions(len(rows)), func(_ int, part partition) error {
+		for i := part.lo; i < part.hi; i++ {
+			if rows[i].isFiltered {
+				continue
+			}
+			if err := checkContext(ctx); err != nil {
+				return err
+			}
 
-		tableData := e.createTableDataMap()
-		combinedRow := e.createCombinedRow((*joinedRows)[i])
+			tableData := e.createTableDataMap()
+			combinedRow := e.createCombinedRow(rows[i])
 
-		match, err := q.Where.Condition.Evaluate(combinedRow, tableData)
-		if err != nil {
-			return fmt.Errorf("where condition evaluation failed: %w", err)
-		}
-		if !match {
-			(*joinedRows)[i].isFiltered = true
+			match, err := condition.Evaluate(combinedRow, tableData)
+			if err != nil {
+				return fmt.Errorf("where condition evaluation failed: %w", err)
+			}
+			if !match {
+				rows[i].isFiltered = true
+			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func (e *Engine) createTableDataMap() map[string]*Table {
@@ -291,7 +898,9 @@ func (e *Engine) createTableDataMap() map[string]*Table {
 	return tableData
 }
 
-func (e *Engine) projectColumns(q *Query, joinedRows []JoinedRow) ([][]string, error) {
+// outputColumns returns the selected table columns with wildcards expanded,
+// and the full result header including custom and window columns.
+func (e *Engine) outputColumns(q *Query) ([]string, []string, error) {
 	var joinedTables []string
 	for _, join := range q.Joins {
 		joinedTables = append(joinedTables, join.Table)
@@ -300,29 +909,123 @@ func (e *Engine) projectColumns(q *Query, joinedRows []JoinedRow) ([][]string, e
 	// Get regular columns
 	expandedColumns, err := q.Select.expandWildcards(e.tables, q.From.Table, joinedTables)
 	if err != nil {
-		return nil, fmt.Errorf("failed to expand wildcards: %w", err)
+		return nil, nil, fmt.Errorf("failed to expand wildcards: %w", err)
 	}
 
-	headers := expandedColumns
+	headers := append([]string(nil), expandedColumns...)
 	for _, customCol := range q.Select.CustomColumns {
 		headers = append(headers, customCol.Name)
 	}
+	for _, windowCol := range q.Select.WindowColumns {
+		headers = append(headers, windowCol.Name)
+	}
 
-	results := [][]string{headers}
+	return expandedColumns, headers, nil
+}
 
-	for _, jr := range joinedRows {
-		if jr.isFiltered {
-			continue
-		}
+func (e *Engine) projectColumns(ctx context.Context, p *queryPlan, joinedRows []JoinedRow) ([][]string, error) {
+	q, headers := p.query, p.columns
 
-		resultRow, err := e.createResultRow(expandedColumns, jr, q)
-		if err != nil {
+	counter := e.guard.resultCounter(p, ProjectNode)
+	var order *sortOrder
+	var sortColumns []string
+	if q.OrderBy != nil {
+		var positions []int
+		positions, sortColumns = q.OrderBy.resolveSortKeys(headers)
+		order = newSortOrder(positions, q.OrderBy.Fields)
+	}
+
+	var rows [][]string
+	if order != nil && e.config.spillThreshold > 0 {
+		n := -1
+		if q.Limit != nil && q.Limit.Count >= 0 {
+			n = q.Limit.Offset + q.Limit.Count
+		}
+		var err error
+		if rows, err = e.sortWithSpill(ctx, p, joinedRows, sortColumns, order, n, counter); err != nil {
+			return nil, err
+		}
+	} else {
+		start := time.Now()
+		var err error
+		if rows, err = e.projectRows(ctx, p, joinedRows, sortColumns, counter); err != nil {
 			return nil, err
 		}
-		results = append(results, resultRow)
+		if err := e.guard.checkRows(ProjectNode, len(rows), resultRowBytes+cellBytes*int64(len(headers))); err != nil {
+			return nil, err
+		}
+		e.stats.record(p.project, len(rows), start)
+
+		if order != nil {
+			start := time.Now()
+			rowBytes := resultRowBytes + cellBytes*int64(len(headers)+len(sortColumns)) + sortRowBytes
+			if err := e.guard.checkRows(SortNode, len(rows), rowBytes); err != nil {
+				return nil, err
+			}
+			if err := order.sort(ctx, rows); err != nil {
+				return nil, e.guard.operatorError(SortNode, err)
+			}
+			e.stats.record(p.sort, len(rows), start)
+		}
 	}
 
-	return results, nil
+	if q.Limit != nil {
+		start := time.Now()
+		rows = q.Limit.apply(rows)
+		e.stats.record(p.limit, len(rows), start)
+	}
+	if len(sortColumns) > 0 {
+		for i := range rows {
+			rows[i] = rows[i][:len(headers)]
+		}
+	}
+
+	return append([][]string{headers}, rows...), nil
+}
+
+// projectRows builds the result rows of the active joined rows, followed by
+// the values of sortColumns, counting them with counter.
+func (e *Engine) projectRows(ctx context.Context, p *queryPlan, joinedRows []JoinedRow, sortColumns []string, counter *resultCounter) ([][]string, error) {
+	q := p.query
+	parts := e.partitions(len(joinedRows))
+	projected := make([][][]string, len(parts))
+	err := runPartitions(parts, func(i int, part partition) error {
+		for _, jr := range joinedRows[part.lo:part.hi] {
+			if jr.isFiltered {
+				continue
+			}
+			if err := checkContext(ctx); err != nil {
+				return err
+			}
+
+			resultRow, err := e.createResultRow(p.expanded, jr, q)
+			if err != nil {
+				return err
+			}
+
+			for _, col := range sortColumns {
+				val, err := e.getColumnValue(col, jr, e.tables[jr.mainTable])
+				if err != nil {
+					return fmt.Errorf("failed to get ORDER BY value: %w", err)
+				}
+				resultRow = append(resultRow, val)
+			}
+			if err := counter.add(1); err != nil {
+				return err
+			}
+			projected[i] = append(projected[i], resultRow)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, part := range projected {
+		rows = append(rows, part...)
+	}
+	return rows, nil
 }
 
 func (e *Engine) createResultRow(columns []string, jr JoinedRow, q *Query) ([]string, error) {
@@ -349,23 +1052,20 @@ func (e *Engine) createResultRow(columns []string, jr JoinedRow, q *Query) ([]st
 		}
 	}
 
+	for _, windowCol := range q.Select.WindowColumns {
+		resultRow = append(resultRow, jr.windowValues[windowCol.Name])
+	}
+
 	return resultRow, nil
 }
 
 func (e *Engine) getColumnValue(col string, jr JoinedRow, mainTable *Table) (string, error) {
-	parts := strings.Split(col, ".")
-	var tableName, colName string
-
-	if len(parts) == 2 {
-		tableName, colName = parts[0], parts[1]
-	} else if len(parts) == 1 {
-		colName = parts[0]
+	tableName, colName := splitColumn(col, e.tables)
+	if tableName == "" {
 		tableName = e.findTableForColumn(colName, jr.mainTable)
 		if tableName == "" {
 			return "", fmt.Errorf("column not found in any table: %s", colName)
 		}
-	} else {
-		return "", fmt.Errorf("invalid column name format: %s", col)
 	}
 
 	return e.extractColumnValue(tableName, colName, jr)
@@ -409,103 +1109,248 @@ func (e *Engine) extractColumnValue(tableName, colName string, jr JoinedRow) (st
 	return joinedRow[idx], nil
 }
 
-func (e *Engine) handleUnionOperation(q *Query, results [][]string) ([][]string, error) {
+func (e *Engine) handleUnionOperation(ctx context.Context, stmt *statementPlan, results [][]string) ([][]string, error) {
 	if len(results) == 0 {
 		return results, nil
 	}
 
-	headers := results[0]
-	strippedHeaders := make([]string, len(headers))
-	for i, header := range headers {
-		parts := strings.Split(header, ".")
-		if len(parts) == 2 {
-			strippedHeaders[i] = parts[1]
-		} else {
-			strippedHeaders[i] = header
+	results[0] = e.stripTablePrefixes(results[0])
+
+	stmt.baseLeaf.rows = results
+	results, err := e.evaluateSetOperation(ctx, stmt.set, "", len(results[0]))
+	if err != nil {
+		return nil, err
+	}
+	if stmt == e.guard.result {
+		if err := e.guard.checkResult(UnionNode, stmt.limit.keeps(len(results)-1)); err != nil {
+			return nil, err
 		}
 	}
-	results[0] = strippedHeaders
+	return e.sortSetResults(ctx, stmt, results)
+}
 
-	baseColumns := len(results[0])
-	for _, unionQuery := range q.Union.Queries {
-		unionResults, err := e.executeQueryInternal(unionQuery)
-		if err != nil {
-			return nil, fmt.Errorf("union query execution failed: %w", err)
+// sortSetResults applies the ORDER BY and LIMIT of a statement to the
+// combined result of its set operations.
+func (e *Engine) sortSetResults(ctx context.Context, stmt *statementPlan, results [][]string) ([][]string, error) {
+	rows := results[1:]
+	if stmt.orderBy != nil {
+		start := time.Now()
+		rowBytes := resultRowBytes + cellBytes*int64(len(results[0])) + sortRowBytes
+		if err := e.guard.checkRows(SortNode, len(rows), rowBytes); err != nil {
+			return nil, err
 		}
-		if len(unionResults) > 0 && len(unionResults[0]) != baseColumns {
-			return nil, fmt.Errorf("UNION queries must have the same number of columns")
+		if err := newSortOrder(stmt.sortPositions, stmt.orderBy.Fields).sort(ctx, rows); err != nil {
+			return nil, e.guard.operatorError(SortNode, err)
 		}
+		e.stats.record(stmt.sortNode, len(rows), start)
 	}
+	if stmt.limit != nil {
+		start := time.Now()
+		rows = stmt.limit.apply(rows)
+		e.stats.record(stmt.limitNode, len(rows), start)
+	}
+	return append([][]string{results[0]}, rows...), nil
+}
 
-	return e.mergeUnionResults(q, results)
+func (e *Engine) stripTablePrefixes(headers []string) []string {
+	strippedHeaders := make([]string, len(headers))
+	for i, header := range headers {
+		_, strippedHeaders[i] = splitColumn(header, e.tables)
+	}
+	return strippedHeaders
 }
 
-func (e *Engine) mergeUnionResults(q *Query, baseResults [][]string) ([][]string, error) {
-	finalResults := [][]string{baseResults[0]}
-	seen := make(map[string]bool)
+func (e *Engine) evaluateSetOperation(ctx context.Context, node *setOperationNode, kind UnionType, baseColumns int) ([][]string, error) {
+	if node.left == nil {
+		return e.evaluateSetOperand(ctx, node, kind, baseColumns)
+	}
 
-	processRow := func(row []string) {
-		if q.Union.UnionKind == UnionAll {
-			finalResults = append(finalResults, row)
-			return
+	var left, right [][]string
+	var leftErr, rightErr error
+	if e.config.parallelism > 1 {
+		// Both operands run under a context of their own, which is
+		// cancelled as soon as either of them fails.
+		operandCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			right, rightErr = e.evaluateSetOperation(operandCtx, node.right, node.kind, baseColumns)
+			if rightErr != nil {
+				cancel()
+			}
+		}()
+		left, leftErr = e.evaluateSetOperation(operandCtx, node.left, node.kind, baseColumns)
+		if leftErr != nil {
+			cancel()
+		}
+		wg.Wait()
+
+		// An operand stopped by the failure of the other one reports
+		// that failure rather than its own cancellation.
+		if ctx.Err() == nil {
+			if rightErr != nil && errors.Is(leftErr, context.Canceled) {
+				leftErr = nil
+			} else if leftErr != nil && errors.Is(rightErr, context.Canceled) {
+				rightErr = nil
+			}
 		}
+	} else {
+		left, leftErr = e.evaluateSetOperation(ctx, node.left, node.kind, baseColumns)
+		if leftErr == nil {
+			right, rightErr = e.evaluateSetOperation(ctx, node.right, node.kind, baseColumns)
+		}
+	}
+	if leftErr != nil {
+		return nil, leftErr
+	}
+	if rightErr != nil {
+		return nil, rightErr
+	}
 
-		key := createRowKey(row)
-		if !seen[key] {
-			seen[key] = true
-			finalResults = append(finalResults, row)
+	start := time.Now()
+	var results [][]string
+	if e.config.spillThreshold > 0 && node.kind != UnionAll {
+		var err error
+		if results, err = e.spillSetResults(ctx, node.kind, left, right); err != nil {
+			return nil, e.guard.operatorError(UnionNode, err)
 		}
+	} else {
+		results = combineSetResults(node.kind, left, right)
+	}
+	if err := e.guard.checkRows(UnionNode, len(results)-1, resultRowBytes+cellBytes*int64(baseColumns)); err != nil {
+		return nil, err
+	}
+	e.stats.record(node.node, len(results)-1, start)
+	return results, nil
+}
+
+func (e *Engine) evaluateSetOperand(ctx context.Context, node *setOperationNode, kind UnionType, baseColumns int) ([][]string, error) {
+	if node.rows != nil {
+		return node.rows, nil
+	}
+	if err := checkContext(ctx); err != nil {
+		return nil, e.guard.operatorError(UnionNode, err)
 	}
 
-	for _, row := range baseResults[1:] {
-		processRow(row)
+	results, err := e.executeQueryInternal(ctx, node.stmt.base)
+	if err != nil {
+		return nil, fmt.Errorf("%s query execution failed: %w", kind, err)
 	}
 
-	for _, unionQuery := range q.Union.Queries {
-		unionResults, err := e.executeQueryInternal(unionQuery)
+	// An operand carrying its own set operations behaves like a
+	// parenthesised subquery and is fully evaluated first.
+	if node.stmt.set != nil {
+		results, err = e.handleUnionOperation(ctx, node.stmt, results)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		for _, row := range unionResults[1:] {
-			processRow(row)
-		}
+	if len(results) > 0 && len(results[0]) != baseColumns {
+		return nil, fmt.Errorf("%s queries must have the same number of columns", kind)
 	}
 
-	return finalResults, nil
+	return results, nil
 }
 
-func createRowKey(row []string) string {
-	var key strings.Builder
-	for i, val := range row {
-		if i > 0 {
-			key.WriteString("|")
-		}
-		key.WriteString(strings.TrimSpace(val))
+func combineSetResults(kind UnionType, left, right [][]string) [][]string {
+	finalResults := [][]string{left[0]}
+
+	if kind == UnionAll {
+		finalResults = append(finalResults, left[1:]...)
+		return append(finalResults, right[1:]...)
 	}
-	return key.String()
+
+	leftRows := make([]setRow, len(left)-1)
+	for i, row := range left[1:] {
+		leftRows[i] = setRow{pos: i, row: row}
+	}
+	rightRows := make([]setRow, len(right)-1)
+	for i, row := range right[1:] {
+		rightRows[i] = setRow{pos: len(left) + i, row: row}
+	}
+
+	for _, r := range combineSetRows(kind, leftRows, rightRows) {
+		finalResults = append(finalResults, r.row)
+	}
+	return finalResults
 }
 
-func (e *Engine) ExportToCSV(q *Query, filepath string) error {
-	results, err := e.ExecuteQuery(q)
-	if err != nil {
-		return fmt.Errorf("failed to execute query: %w", err)
+// setRow is a row of a set operation operand. pos orders rows across both
+// operands, left rows first.
+type setRow struct {
+	pos int
+	row []string
+}
+
+// combineSetRows applies a deduplicating or counting set operation. Its
+// output keeps input order, and only rows with equal keys affect each other,
+// so rows can be combined in partitions of equal keys.
+func combineSetRows(kind UnionType, left, right []setRow) []setRow {
+	var finalResults []setRow
+
+	if kind == Union {
+		seen := make(map[string]bool)
+		for _, rows := range [][]setRow{left, right} {
+			for _, r := range rows {
+				key := createRowKey(r.row)
+				if !seen[key] {
+					seen[key] = true
+					finalResults = append(finalResults, r)
+				}
+			}
+		}
+		return finalResults
 	}
 
-	file, err := os.Create(filepath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+	rightCounts := make(map[string]int)
+	for _, r := range right {
+		rightCounts[createRowKey(r.row)]++
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	emitted := make(map[string]bool)
+	for _, r := range left {
+		key := createRowKey(r.row)
+		inRight := rightCounts[key] > 0
 
-	for _, row := range results {
-		if err := writer.Write(row); err != nil {
-			return fmt.Errorf("failed to write row: %w", err)
+		switch kind {
+		case IntersectAll:
+			if inRight {
+				rightCounts[key]--
+				finalResults = append(finalResults, r)
+			}
+		case ExceptAll:
+			if inRight {
+				rightCounts[key]--
+			} else {
+				finalResults = append(finalResults, r)
+			}
+		case Intersect:
+			if inRight && !emitted[key] {
+				emitted[key] = true
+				finalResults = append(finalResults, r)
+			}
+		case Except:
+			if !inRight && !emitted[key] {
+				emitted[key] = true
+				finalResults = append(finalResults, r)
+			}
 		}
 	}
 
-	return nil
+	return finalResults
+}
+
+func createRowKey(row []string) string {
+	var key strings.Builder
+	for i, val := range row {
+		if i > 0 {
+			key.WriteString("|")
+		}
+		key.WriteString(strings.TrimSpace(val))
+	}
+	return key.String()
 }
@@ -0,0 +1,125 @@
+package csvsql
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// newTestEngine returns an engine with two small tables: u holds ids 1 to 3
+// and v ids 3 to 5, so that set operations over their ids overlap in one row.
+func newTestEngine(t *testing.T, opts ...EngineOption) *Engine {
+	t.Helper()
+	e := NewEngine(opts...)
+	tables := []struct {
+		name    string
+		headers []string
+		rows    [][]string
+	}{
+		{"u", []string{"id", "name", "zip"}, [][]string{
+			{"1", "alice", "02139"},
+			{"2", "bob", "10001"},
+			{"3", "carol", ""},
+		}},
+		{"v", []string{"id", "name", "zip"}, [][]string{
+			{"3", "carol", "94105"},
+			{"4", "dave", "60601"},
+			{"5", "erin", "10001"},
+		}},
+	}
+	for _, tt := range tables {
+		if err := e.CreateTableFromRows(tt.name, tt.headers, tt.rows); err != nil {
+			t.Fatalf("CreateTableFromRows(%s): %v", tt.name, err)
+		}
+	}
+	return e
+}
+
+func mustBuild(t *testing.T, qb *QueryBuilder) *Query {
+	t.Helper()
+	q, err := qb.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return q
+}
+
+func mustQuery(t *testing.T, e *Engine, q *Query) [][]string {
+	t.Helper()
+	results, err := e.ExecuteQuery(q)
+	if err != nil {
+		t.Fatalf("ExecuteQuery: %v", err)
+	}
+	return results
+}
+
+// column returns the values of column i of results, without the header.
+func column(results [][]string, i int) []string {
+	values := []string{}
+	for _, row := range results[1:] {
+		values = append(values, row[i])
+	}
+	return values
+}
+
+func assertColumn(t *testing.T, results [][]string, i int, want []string) {
+	t.Helper()
+	if got := column(results, i); !reflect.DeepEqual(got, want) {
+		t.Errorf("column %d = %v, want %v", i, got, want)
+	}
+}
+
+func TestCreateTableFromReader(t *testing.T) {
+	f := excelize.NewFile()
+	for i, row := range [][]any{{"id", "name"}, {1, "alice"}} {
+		if err := f.SetSheetRow("Sheet1", fmt.Sprintf("A%d", i+1), &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	workbook, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parquetData, err := os.ReadFile(writeParquetTestFile(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format string
+		data   []byte
+		column string
+		want   string
+	}{
+		{"csv", []byte("id,name\n1,alice\n"), "name", "alice"},
+		{".CSV", []byte("id,name\n1,alice\n"), "name", "alice"},
+		{"tsv", []byte("id\tname\n1\talice\n"), "name", "alice"},
+		{"json", []byte(`[{"id": 1, "name": "alice"}]`), "name", "alice"},
+		{"ndjson", []byte(`{"id": 1, "name": "alice"}`), "name", "alice"},
+		{"jsonl", []byte(`{"id": 1, "name": "alice"}`), "name", "alice"},
+		{"xlsx", workbook.Bytes(), "name", "alice"},
+		{"parquet", parquetData, "name", "n0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			e := NewEngine()
+			if err := e.CreateTableFromReader("t", bytes.NewReader(tt.data), tt.format, TableOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			assertColumn(t, mustQuery(t, e, mustBuild(t, NewQuery().Select(tt.column).From("t"))), 0, []string{tt.want})
+		})
+	}
+
+	e := NewEngine()
+	if err := e.CreateTableFromReader("t", strings.NewReader("a\n1\n"), "txt", TableOptions{}); err == nil {
+		t.Error("unsupported format was accepted")
+	}
+	if err := e.CreateTableFromReader("t", nil, "csv", TableOptions{}); err == nil {
+		t.Error("nil reader was accepted")
+	}
+}
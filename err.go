@@ -1,5 +1,7 @@
 package csvsql
 
+import "fmt"
+
 type ErrInvalidQuery struct {
 	Message string
 }
@@ -7,3 +9,36 @@ type ErrInvalidQuery struct {
 func (e *ErrInvalidQuery) Error() string {
 	return e.Message
 }
+
+type LimitKind string
+
+const (
+	IntermediateRowsLimit LimitKind = "intermediate rows"
+	ResultRowsLimit       LimitKind = "result rows"
+	MemoryLimit           LimitKind = "memory"
+	ExecutionTimeLimit    LimitKind = "execution time"
+)
+
+// ErrLimitExceeded is returned when a query exceeds one of its
+// ResourceLimits. Operator is the plan operator that exceeded it.
+type ErrLimitExceeded struct {
+	Kind     LimitKind
+	Operator PlanNodeType
+	Limit    string
+}
+
+func (e *ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("%s limit of %s exceeded by %s", e.Kind, e.Limit, e.Operator)
+}
+
+// ErrInvalidEncoding is returned when a file read with RejectInvalid contains
+// a byte sequence that is invalid in its encoding. Offset is the position of
+// the sequence in bytes from the start of the file.
+type ErrInvalidEncoding struct {
+	Encoding Encoding
+	Offset   int64
+}
+
+func (e *ErrInvalidEncoding) Error() string {
+	return fmt.Sprintf("invalid %s input at byte %d", e.Encoding, e.Offset)
+}
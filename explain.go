@@ -0,0 +1,134 @@
+package csvsql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PlanNodeType string
+
+const (
+	ScanNode           PlanNodeType = "Scan"
+	IndexScanNode      PlanNodeType = "IndexScan"
+	FilterNode         PlanNodeType = "Filter"
+	HashJoinNode       PlanNodeType = "HashJoin"
+	NestedLoopJoinNode PlanNodeType = "NestedLoopJoin"
+	WindowNode         PlanNodeType = "Window"
+	ProjectNode        PlanNodeType = "Project"
+	SortNode           PlanNodeType = "Sort"
+	LimitNode          PlanNodeType = "Limit"
+	UnionNode          PlanNodeType = "Union"
+)
+
+// PlanNode is one operator of a query plan. ActualRows and Duration are only
+// filled in by ExplainAnalyze; Duration excludes the time spent in children.
+type PlanNode struct {
+	Type          PlanNodeType
+	Detail        string
+	EstimatedRows int
+	ActualRows    int
+	Duration      time.Duration
+	Children      []*PlanNode
+}
+
+type Plan struct {
+	Root     *PlanNode
+	Analyzed bool
+}
+
+// Explain returns the plan the engine would use to run q, without running it.
+func (e *Engine) Explain(q *Query) (*Plan, error) {
+	stmt, err := e.snapshot().planStatement(q)
+	if err != nil {
+		return nil, fmt.Errorf("query planning failed: %w", err)
+	}
+	return &Plan{Root: stmt.root}, nil
+}
+
+// ExplainAnalyze runs q and returns its plan annotated with the actual number
+// of rows produced by and the time spent in every node.
+func (e *Engine) ExplainAnalyze(q *Query) (*Plan, error) {
+	s := e.snapshot()
+	if err := s.loadSources(context.Background(), q); err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	stmt, err := s.planStatement(q)
+	if err != nil {
+		return nil, fmt.Errorf("query planning failed: %w", err)
+	}
+	s.stats = &planStats{nodes: make(map[*PlanNode]nodeStats)}
+	if _, err := s.execute(context.Background(), q, stmt); err != nil {
+		return nil, err
+	}
+	return &Plan{Root: s.stats.annotate(stmt.root), Analyzed: true}, nil
+}
+
+func (p *Plan) String() string {
+	var sb strings.Builder
+	p.writeNode(&sb, p.Root, "", "")
+	return sb.String()
+}
+
+func (p *Plan) writeNode(sb *strings.Builder, node *PlanNode, prefix, childPrefix string) {
+	sb.WriteString(prefix)
+	sb.WriteString(string(node.Type))
+	if node.Detail != "" {
+		sb.WriteString(" [" + node.Detail + "]")
+	}
+	fmt.Fprintf(sb, " (est. rows=%d", node.EstimatedRows)
+	if p.Analyzed {
+		fmt.Fprintf(sb, ", actual rows=%d, time=%s", node.ActualRows, node.Duration)
+	}
+	sb.WriteString(")\n")
+
+	for i, child := range node.Children {
+		if i == len(node.Children)-1 {
+			p.writeNode(sb, child, childPrefix+"└─ ", childPrefix+"   ")
+		} else {
+			p.writeNode(sb, child, childPrefix+"├─ ", childPrefix+"│  ")
+		}
+	}
+}
+
+// planStats holds the actual row counts and timings of the plan nodes of a
+// statement run by ExplainAnalyze. Set operands may run concurrently, so
+// access is synchronized.
+type planStats struct {
+	mu    sync.Mutex
+	nodes map[*PlanNode]nodeStats
+}
+
+type nodeStats struct {
+	rows     int
+	duration time.Duration
+}
+
+// record sets the rows produced by node and adds the time since start to the
+// time spent in it. It does nothing unless the statement is being analyzed.
+func (s *planStats) record(node *PlanNode, rows int, start time.Time) {
+	if s == nil || node == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.nodes[node]
+	stats.rows = rows
+	stats.duration += time.Since(start)
+	s.nodes[node] = stats
+}
+
+// annotate returns a copy of the plan tree below node with the recorded
+// actual rows and durations filled in.
+func (s *planStats) annotate(node *PlanNode) *PlanNode {
+	annotated := *node
+	stats := s.nodes[node]
+	annotated.ActualRows, annotated.Duration = stats.rows, stats.duration
+	annotated.Children = make([]*PlanNode, len(node.Children))
+	for i, child := range node.Children {
+		annotated.Children[i] = s.annotate(child)
+	}
+	return &annotated
+}
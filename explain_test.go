@@ -0,0 +1,109 @@
+package csvsql
+
+import (
+	"strings"
+	"testing"
+)
+
+func findPlanNode(node *PlanNode, typ PlanNodeType) *PlanNode {
+	if node.Type == typ {
+		return node
+	}
+	for _, child := range node.Children {
+		if found := findPlanNode(child, typ); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestExplainJoinMethods(t *testing.T) {
+	e := newJoinTestEngine(t)
+	if err := e.CreateIndex("orders", "user_id"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		op     string
+		want   PlanNodeType
+		detail string
+	}{
+		{"=", HashJoinNode, "using index orders.user_id"},
+		{"<", NestedLoopJoinNode, "using index orders.user_id"},
+		{"!=", NestedLoopJoinNode, "ON users.id != orders.user_id"},
+	}
+	for _, tt := range tests {
+		q := mustBuild(t, NewQuery().
+			Select("users.name", "orders.oid").
+			From("users").
+			InnerJoin("orders").
+			On("users", "id", tt.op, "orders", "user_id"))
+		plan, err := e.Explain(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		join := findPlanNode(plan.Root, tt.want)
+		if join == nil || !strings.Contains(join.Detail, tt.detail) {
+			t.Errorf("%s: plan = %s, want %s [... %s]", tt.op, plan, tt.want, tt.detail)
+		}
+	}
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	e := newJoinTestEngine(t)
+	q := mustBuild(t, NewQuery().
+		Select("users.name", "orders.oid").
+		From("users").
+		InnerJoin("orders").
+		On("users", "id", "=", "orders", "user_id").
+		OrderBy("orders.oid", Desc).
+		Limit(1))
+
+	plan, err := e.ExplainAnalyze(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Analyzed {
+		t.Fatal("plan is not analyzed")
+	}
+	want := map[PlanNodeType]int{ScanNode: 3, HashJoinNode: 2, ProjectNode: 2, SortNode: 2, LimitNode: 1}
+	for typ, rows := range want {
+		if node := findPlanNode(plan.Root, typ); node == nil || node.ActualRows != rows {
+			t.Errorf("%s actual rows = %v, want %d\n%s", typ, node, rows, plan)
+		}
+	}
+
+	// Analyzing annotates a copy: the plan itself is left untouched, so
+	// running the same query again reports the same numbers.
+	again, err := e.ExplainAnalyze(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := findPlanNode(again.Root, HashJoinNode).ActualRows; got != 2 {
+		t.Errorf("second run HashJoin actual rows = %d, want 2", got)
+	}
+	explained, err := e.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node := findPlanNode(explained.Root, HashJoinNode); node.ActualRows != 0 || node.Duration != 0 {
+		t.Errorf("Explain reports actuals: %+v", node)
+	}
+}
+
+func TestExplainAnalyzeSetOperation(t *testing.T) {
+	e := newTestEngine(t, WithParallelism(4))
+	q := mustBuild(t, NewQuery().Select("id").From("u").
+		Union(NewQuery().Select("id").From("v")).
+		OrderBy("id", Desc).
+		Limit(2))
+	plan, err := e.ExplainAnalyze(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for typ, rows := range map[PlanNodeType]int{LimitNode: 2, SortNode: 5, UnionNode: 5} {
+		if node := findPlanNode(plan.Root, typ); node == nil || node.ActualRows != rows {
+			t.Errorf("%s actual rows = %v, want %d\n%s", typ, node, rows, plan)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package csvsql
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// CSVExportOptions control ExportToCSVWithOptions. The zero value writes
+// comma-separated values with a header row and \n line endings.
+type CSVExportOptions struct {
+	// Delimiter separates fields. It defaults to ','.
+	Delimiter rune
+	// Quoting selects which fields are quoted.
+	Quoting CSVQuoting
+	// CRLF ends lines with \r\n instead of \n.
+	CRLF bool
+	// BOM starts the file with a UTF-8 byte order mark so that Excel reads
+	// it as UTF-8.
+	BOM bool
+	// NoHeader leaves out the header row.
+	NoHeader bool
+	// Gzip compresses the file with gzip.
+	Gzip bool
+}
+
+func (e *Engine) ExportToCSV(q *Query, filepath string) error {
+	return e.ExportToCSVContext(context.Background(), q, filepath)
+}
+
+// ExportToCSVContext is like ExportToCSV but stops once ctx is done, both
+// while running the query and while writing the file.
+func (e *Engine) ExportToCSVContext(ctx context.Context, q *Query, filepath string) error {
+	return e.ExportToCSVWithOptionsContext(ctx, q, filepath, CSVExportOptions{})
+}
+
+// ExportToCSVWithOptions writes the results of q to a delimited text file at
+// path formatted according to opts. The file is written next to path under a
+// temporary name and renamed to path once complete, so that a failed export
+// leaves any existing file at path untouched rather than truncated.
+func (e *Engine) ExportToCSVWithOptions(q *Query, path string, opts CSVExportOptions) error {
+	return e.ExportToCSVWithOptionsContext(context.Background(), q, path, opts)
+}
+
+// ExportToCSVWithOptionsContext is like ExportToCSVWithOptions but stops once
+// ctx is done, both while running the query and while writing the file.
+func (e *Engine) ExportToCSVWithOptionsContext(ctx context.Context, q *Query, path string, opts CSVExportOptions) error {
+	writer := CSVWriter{
+		Delimiter: opts.Delimiter,
+		Quoting:   opts.Quoting,
+		CRLF:      opts.CRLF,
+		BOM:       opts.BOM,
+		NoHeader:  opts.NoHeader,
+	}
+	if writer.Delimiter != 0 && !validCSVDelimiter(writer.Delimiter) {
+		return fmt.Errorf("invalid delimiter %q", writer.Delimiter)
+	}
+
+	results, types, err := e.ExecuteQueryWithTypesContext(ctx, q)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	var headers []string
+	var rows [][]string
+	if len(results) > 0 {
+		headers, rows = results[0], results[1:]
+	}
+
+	return writeFileAtomic(path, func(w io.Writer) error {
+		if !opts.Gzip {
+			return writer.writeResults(ctx, w, headers, rows, types)
+		}
+		gz := gzip.NewWriter(w)
+		if err := writer.writeResults(ctx, gz, headers, rows, types); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+}
+
+// writeFileAtomic creates or replaces the file at path with the output of
+// write. The output goes to a temporary file in the same directory, which is
+// renamed to path only once write and all flushing succeeded; on failure the
+// temporary file is removed and path is left as it was.
+func writeFileAtomic(path string, write func(w io.Writer) error) (err error) {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := createTempFile(dir, name)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	// A file being replaced keeps its mode.
+	if info, statErr := os.Stat(path); statErr == nil {
+		if err := file.Chmod(info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+	}
+
+	buffered := bufio.NewWriter(file)
+	if err := write(buffered); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// createTempFile creates a new file in dir with a name derived from name, like
+// os.CreateTemp, but with the mode os.Create uses: 0666 before the umask
+// rather than 0600, so that the renamed file gets the mode of a new file.
+func createTempFile(dir, name string) (*os.File, error) {
+	for try := 0; ; try++ {
+		path := filepath.Join(dir, "."+name+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return file, err
+	}
+}
+
+// XLSXExportOptions control ExportToXLSX.
+type XLSXExportOptions struct {
+	// Sheet names the sheet holding the results of the exported query;
+	// Sheet1 is used when it is empty.
+	Sheet string
+	// Sheets adds the results of further queries to the workbook, each in a
+	// sheet of its own following the first one.
+	Sheets []XLSXSheet
+}
+
+// XLSXSheet is a query exported to a named sheet.
+type XLSXSheet struct {
+	Name  string
+	Query *Query
+}
+
+const (
+	defaultXLSXSheet = "Sheet1"
+	// Column widths are counted in characters, like Excel does.
+	minXLSXColumnWidth = 8
+	maxXLSXColumnWidth = 60
+)
+
+// ExportToXLSX writes the results of q to an XLSX workbook at filepath. The
+// header row is bold and frozen, columns are as wide as their longest value,
+// and numbers, dates and booleans are written as typed cells. Rows are
+// streamed to the file, so large results need little memory besides the
+// results themselves.
+func (e *Engine) ExportToXLSX(q *Query, filepath string, opts XLSXExportOptions) error {
+	return e.ExportToXLSXContext(context.Background(), q, filepath, opts)
+}
+
+// ExportToXLSXContext is like ExportToXLSX but stops once ctx is done, both
+// while running the queries and while writing the file.
+func (e *Engine) ExportToXLSXContext(ctx context.Context, q *Query, filepath string, opts XLSXExportOptions) error {
+	sheet := opts.Sheet
+	if sheet == "" {
+		sheet = defaultXLSXSheet
+	}
+	sheets := append([]XLSXSheet{{Name: sheet, Query: q}}, opts.Sheets...)
+
+	// Excel treats sheet names case-insensitively.
+	for i, s := range sheets {
+		if s.Query == nil {
+			return fmt.Errorf("sheet %s has no query", s.Name)
+		}
+		for _, other := range sheets[:i] {
+			if strings.EqualFold(s.Name, other.Name) {
+				return fmt.Errorf("duplicate sheet name: %s", s.Name)
+			}
+		}
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	styles, err := newXLSXStyles(f)
+	if err != nil {
+		return fmt.Errorf("failed to create styles: %w", err)
+	}
+
+	for i, s := range sheets {
+		results, types, err := e.ExecuteQueryWithTypesContext(ctx, s.Query)
+		if err != nil {
+			return fmt.Errorf("failed to execute query for sheet %s: %w", s.Name, err)
+		}
+
+		if i == 0 {
+			err = f.SetSheetName(defaultXLSXSheet, s.Name)
+		} else {
+			_, err = f.NewSheet(s.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create sheet %s: %w", s.Name, err)
+		}
+
+		if err := writeXLSXSheet(ctx, f, styles, s.Name, results, types); err != nil {
+			return err
+		}
+	}
+
+	if err := f.SaveAs(filepath); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return nil
+}
+
+func writeXLSXSheet(ctx context.Context, f *excelize.File, styles *xlsxStyles, sheet string, results [][]string, types []ColumnType) error {
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to write sheet %s: %w", sheet, err)
+	}
+
+	// The stream writer requires panes and widths before the first row.
+	if err := sw.SetPanes(&excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return fmt.Errorf("failed to write sheet %s: %w", sheet, err)
+	}
+	for col, width := range xlsxColumnWidths(results) {
+		if err := sw.SetColWidth(col+1, col+1, width); err != nil {
+			return fmt.Errorf("failed to write sheet %s: %w", sheet, err)
+		}
+	}
+
+	for i, row := range results {
+		if err := checkContext(ctx); err != nil {
+			return err
+		}
+
+		values := make([]interface{}, len(row))
+		for col, value := range row {
+			if i == 0 {
+				values[col] = excelize.Cell{StyleID: styles.header, Value: value}
+				continue
+			}
+			values[col] = styles.cell(value, types[col])
+		}
+
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+		if err := sw.SetRow(cell, values); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+	}
+
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("failed to write sheet %s: %w", sheet, err)
+	}
+	return nil
+}
+
+// xlsxStyles are the styles of the header and of typed cells.
+type xlsxStyles struct {
+	header, date, dateTime int
+}
+
+func newXLSXStyles(f *excelize.File) (*xlsxStyles, error) {
+	var styles xlsxStyles
+	var err error
+	if styles.header, err = f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}}); err != nil {
+		return nil, err
+	}
+	dateFormat, dateTimeFormat := "yyyy-mm-dd", "yyyy-mm-dd hh:mm:ss"
+	if styles.date, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat}); err != nil {
+		return nil, err
+	}
+	if styles.dateTime, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateTimeFormat}); err != nil {
+		return nil, err
+	}
+	return &styles, nil
+}
+
+// cell converts a value of a column of type typ to the value of a typed
+// cell. Empty values leave the cell empty.
+func (s *xlsxStyles) cell(value string, typ ColumnType) interface{} {
+	if value == "" {
+		return nil
+	}
+	switch typ {
+	case IntegerColumn:
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case FloatColumn:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case BooleanColumn:
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	case DateColumn:
+		if v, err := time.Parse(DateFormat, value); err == nil {
+			return excelize.Cell{StyleID: s.date, Value: v}
+		}
+	case DateTimeColumn:
+		if v, err := time.Parse(DateTimeFormat, value); err == nil {
+			return excelize.Cell{StyleID: s.dateTime, Value: v}
+		}
+	}
+	return value
+}
+
+// xlsxColumnWidths fits the width of every column to its longest value,
+// within limits that keep long text from producing unusably wide columns.
+func xlsxColumnWidths(results [][]string) []float64 {
+	if len(results) == 0 {
+		return nil
+	}
+	widths := make([]float64, len(results[0]))
+	for col := range widths {
+		longest := 0
+		for _, row := range results {
+			if col < len(row) {
+				if n := utf8.RuneCountInString(row[col]); n > longest {
+					longest = n
+				}
+			}
+		}
+
+		// Leave room for the bold header and the cell padding.
+		width := float64(longest) + 2
+		if width < minXLSXColumnWidth {
+			width = minXLSXColumnWidth
+		}
+		if width > maxXLSXColumnWidth {
+			width = maxXLSXColumnWidth
+		}
+		widths[col] = width
+	}
+	return widths
+}
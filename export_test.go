@@ -0,0 +1,237 @@
+package csvsql
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExportToXLSX(t *testing.T) {
+	e := NewEngine()
+	data := "{\"id\": 1, \"score\": 9.5, \"ok\": true, \"code\": \"007\"}\n{\"id\": 2, \"score\": 10, \"ok\": false, \"code\": \"012\"}\n"
+	if err := e.CreateTableFromReader("t", strings.NewReader(data), "ndjson", TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.xlsx")
+	q := mustBuild(t, NewQuery().Select("id", "score", "ok", "code").From("t"))
+	ids := mustBuild(t, NewQuery().Select("id").From("t").Where("id", "=", "2"))
+	err := e.ExportToXLSX(q, path, XLSXExportOptions{Sheet: "all", Sheets: []XLSXSheet{{Name: "second", Query: ids}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got := f.GetSheetList(); !reflect.DeepEqual(got, []string{"all", "second"}) {
+		t.Errorf("sheets = %q", got)
+	}
+	rows, err := f.GetRows("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"id", "score", "ok", "code"}, {"1", "9.5", "TRUE", "007"}, {"2", "10", "FALSE", "012"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+
+	// Numbers and booleans are typed cells; strings such as codes are not.
+	// Number cells are written without a type attribute.
+	cells := map[string]excelize.CellType{
+		"A2": excelize.CellTypeUnset,
+		"B2": excelize.CellTypeUnset,
+		"C2": excelize.CellTypeBool,
+		"D2": excelize.CellTypeInlineString,
+	}
+	for cell, want := range cells {
+		got, err := f.GetCellType("all", cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want && !(want == excelize.CellTypeInlineString && got == excelize.CellTypeSharedString) {
+			t.Errorf("type of %s = %v, want %v", cell, got, want)
+		}
+	}
+}
+
+func TestExportToXLSXDuplicateSheetNames(t *testing.T) {
+	e := newTestEngine(t)
+	q := mustBuild(t, NewQuery().Select("id").From("u"))
+	path := filepath.Join(t.TempDir(), "out.xlsx")
+
+	for _, name := range []string{"Sheet1", "sheet1", "SHEET1"} {
+		err := e.ExportToXLSX(q, path, XLSXExportOptions{Sheets: []XLSXSheet{{Name: name, Query: q}}})
+		if err == nil || !strings.Contains(err.Error(), "duplicate sheet name") {
+			t.Errorf("sheet %s: error = %v, want a duplicate sheet name", name, err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file was written despite the error: %v", err)
+	}
+}
+
+func TestExportToCSVQuoting(t *testing.T) {
+	e := NewEngine()
+	data := "{\"n\": 1, \"s\": \"a,b\"}\n{\"n\": 2.5, \"s\": \" x\"}\n{\"n\": null, \"s\": \"say \\\"hi\\\"\"}\n{\"n\": 3, \"s\": \"\"}\n"
+	if err := e.CreateTableFromReader("t", strings.NewReader(data), "ndjson", TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	q := mustBuild(t, NewQuery().Select("n", "s").From("t"))
+	plain := mustBuild(t, NewQuery().Select("n", "s").From("t").Where("s", "=", ""))
+
+	tests := []struct {
+		name    string
+		q       *Query
+		opts    CSVExportOptions
+		want    string
+		wantErr string
+	}{
+		{
+			name: "minimal",
+			q:    q,
+			want: "n,s\n1,\"a,b\"\n2.5,\" x\"\n,\"say \"\"hi\"\"\"\n3,\n",
+		},
+		{
+			name: "all",
+			q:    q,
+			opts: CSVExportOptions{Quoting: QuoteAll},
+			want: "\"n\",\"s\"\n\"1\",\"a,b\"\n\"2.5\",\" x\"\n\"\",\"say \"\"hi\"\"\"\n\"3\",\"\"\n",
+		},
+		{
+			name: "non-numeric",
+			q:    q,
+			opts: CSVExportOptions{Quoting: QuoteNonNumeric},
+			want: "\"n\",\"s\"\n1,\"a,b\"\n2.5,\" x\"\n,\"say \"\"hi\"\"\"\n3,\"\"\n",
+		},
+		{
+			name: "none",
+			q:    plain,
+			opts: CSVExportOptions{Quoting: QuoteNone, Delimiter: ';', CRLF: true},
+			want: "n;s\r\n3;\r\n",
+		},
+		{
+			name:    "none needing quotes",
+			q:       q,
+			opts:    CSVExportOptions{Quoting: QuoteNone},
+			wantErr: "needs quotes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.csv")
+			err := e.ExportToCSVWithOptions(tt.q, path, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("file = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportToCSVReplacesFileAtomically(t *testing.T) {
+	e := newTestEngine(t)
+	q := mustBuild(t, NewQuery().Select("id").From("u"))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.csv")
+
+	// A new file gets the mode of files created with os.Create, which
+	// depends on the umask.
+	reference := filepath.Join(dir, "reference")
+	if err := os.WriteFile(reference, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ExportToCSV(q, path); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.Stat(reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode() != want.Mode() {
+		t.Errorf("mode of new file = %v, want %v", got.Mode(), want.Mode())
+	}
+	os.Remove(reference)
+
+	// A replaced file keeps its mode.
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ExportToCSVWithOptions(q, path, CSVExportOptions{NoHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.Stat(path); err != nil || got.Mode().Perm() != 0600 {
+		t.Errorf("mode of replaced file = %v, %v, want 0600", got.Mode(), err)
+	}
+	assertFile(t, path, "1\n2\n3\n")
+
+	// A failed export leaves the file as it was. With 3 as the delimiter,
+	// the id of carol needs quotes, which QuoteNone rejects.
+	failing := mustBuild(t, NewQuery().Select("id").From("u").Where("name", "=", "carol"))
+	if err := e.ExportToCSVWithOptions(failing, path, CSVExportOptions{Delimiter: '3', Quoting: QuoteNone}); err == nil {
+		t.Fatal("export of a field needing quotes with QuoteNone succeeded")
+	}
+	assertFile(t, path, "1\n2\n3\n")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		for _, entry := range entries {
+			t.Errorf("file %s left in directory", entry.Name())
+		}
+	}
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestExportWithWriterReportsFlushError(t *testing.T) {
+	e := newTestEngine(t)
+	q := mustBuild(t, NewQuery().Select("id").From("u"))
+
+	// The results fit the buffer, so the writer fails only when flushed.
+	errFull := errors.New("disk full")
+	for _, format := range []string{"csv", "json", "markdown"} {
+		err := e.Export(q, failingWriter{errFull}, format)
+		if !errors.Is(err, errFull) {
+			t.Errorf("%s: error = %v, want %v", format, err, errFull)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package csvsql
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestExportToCSVHonorsUmask(t *testing.T) {
+	e := newTestEngine(t)
+	q := mustBuild(t, NewQuery().Select("id").From("u"))
+
+	old := syscall.Umask(027)
+	defer syscall.Umask(old)
+
+	path := filepath.Join(t.TempDir(), "out.csv")
+	if err := e.ExportToCSV(q, path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0640 {
+		t.Errorf("mode = %v, want %v", got, os.FileMode(0640))
+	}
+}
@@ -0,0 +1,504 @@
+package csvsql
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SchemaDrift controls how the files of a table created from a glob pattern
+// may differ in their columns.
+type SchemaDrift int
+
+const (
+	// SchemaDriftError rejects files whose columns differ from those of the
+	// first file. Columns may appear in a different order.
+	SchemaDriftError SchemaDrift = iota
+	// SchemaDriftUnion gives the table the columns of all files in order of
+	// first appearance, leaving the columns a file lacks empty.
+	SchemaDriftUnion
+)
+
+// FileColumnName is the name of the column added by TableOptions.FileColumn.
+const FileColumnName = "_file"
+
+// hiveDefaultPartition is the directory value Hive writes for a partition
+// whose value is null.
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+func isGlobPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// fileSetSource reads the rows of a table made of several files. Every file
+// is read by the queries that do not prune it, so pruned files are never
+// read after the table is created.
+type fileSetSource struct {
+	files []*setFile
+	// fixed marks the partition columns and the _file column, whose values
+	// are the same for all rows of a file.
+	fixed []bool
+}
+
+// setFile is one file of a fileSetSource, whose table reads its rows from
+// the file. columns maps every column of the table to the column of the file
+// holding it, or to -1 when the value is taken from values instead.
+type setFile struct {
+	path    string
+	table   *Table
+	columns []int
+	values  []string
+}
+
+// loadFileSet loads the files matching pattern as one table. Directory names
+// of the form key=value, as in orders/dt=2023-03-01/region=eu/part.csv,
+// become partition columns following the columns of the files.
+func (e *Engine) loadFileSet(alias, pattern string, opts TableOptions) (*Table, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %s: %w", pattern, err)
+	}
+	var paths []string
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match pattern %s", pattern)
+	}
+
+	var headers []string
+	var types []ColumnType
+	typed := false
+	headerMap := make(map[string]int)
+	var partitionKeys []string
+	src := &fileSetSource{}
+	base := globBase(pattern)
+
+	for i, path := range paths {
+		table, err := e.loadSetFile(path, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, values := hivePartitions(path, base)
+		if i == 0 {
+			partitionKeys = keys
+		} else if strings.Join(keys, "/") != strings.Join(partitionKeys, "/") {
+			return nil, fmt.Errorf("file '%s' has partition columns %v, expected %v", path, keys, partitionKeys)
+		}
+
+		if i > 0 && opts.SchemaDrift == SchemaDriftError {
+			if err := matchHeaders(headers, table, path, paths[0]); err != nil {
+				return nil, err
+			}
+		}
+
+		file := &setFile{path: path, table: table, values: values}
+		for col, header := range table.Headers {
+			typ := StringColumn
+			if table.Types != nil {
+				typ = table.Types[col]
+				typed = true
+			}
+
+			idx, ok := headerMap[strings.ToLower(header)]
+			if !ok {
+				idx = len(headers)
+				headerMap[strings.ToLower(header)] = idx
+				headers = append(headers, header)
+				types = append(types, typ)
+			} else if types[idx] != typ {
+				types[idx] = StringColumn
+			}
+			for len(file.columns) <= idx {
+				file.columns = append(file.columns, -1)
+			}
+			file.columns[idx] = col
+		}
+		src.files = append(src.files, file)
+	}
+
+	fixed := append([]string(nil), partitionKeys...)
+	if opts.FileColumn {
+		fixed = append(fixed, FileColumnName)
+	}
+	for _, name := range fixed {
+		if _, ok := headerMap[strings.ToLower(name)]; ok {
+			return nil, fmt.Errorf("partition or file column %s conflicts with a column of the files matching %s", name, pattern)
+		}
+		headerMap[strings.ToLower(name)] = len(headers)
+		headers = append(headers, name)
+		types = append(types, StringColumn)
+	}
+
+	width := len(headers) - len(fixed)
+	src.fixed = make([]bool, len(headers))
+	for i := width; i < len(headers); i++ {
+		src.fixed[i] = true
+	}
+	for _, file := range src.files {
+		for len(file.columns) < width {
+			file.columns = append(file.columns, -1)
+		}
+		row := make([]string, len(headers))
+		copy(row[width:], file.values)
+		if opts.FileColumn {
+			row[len(headers)-1] = file.path
+		}
+		for i := width; i < len(headers); i++ {
+			file.columns = append(file.columns, -1)
+		}
+		file.values = row
+	}
+
+	if !typed && len(fixed) == 0 {
+		types = nil
+	}
+
+	return &Table{
+		Name:      alias,
+		Headers:   headers,
+		HeaderMap: headerMap,
+		Types:     types,
+		source:    src,
+	}, nil
+}
+
+// csvSampleRows is the number of rows read from every CSV file of a
+// multi-file table when the table is created, to estimate its row count.
+const csvSampleRows = 64
+
+// loadSetFile returns a table with the columns of the file at path whose rows
+// are read from the file by every query. Only the schema of a Parquet file and
+// the start of a CSV file are read here; JSON and XLSX files are read whole
+// to learn their columns, and their rows dropped.
+func (e *Engine) loadSetFile(path string, opts TableOptions) (*Table, error) {
+	name := strings.ToLower(trimCompressionExt(path))
+	if strings.HasSuffix(name, ".parquet") {
+		return e.loadParquet(path, path)
+	}
+
+	var table *Table
+	var rows int
+	var err error
+	switch {
+	case strings.HasSuffix(name, ".csv"):
+		table, rows, err = e.sampleCsv(path, opts.CSV)
+	case strings.HasSuffix(name, ".tsv"):
+		table, rows, err = e.sampleCsv(path, tsvOptions(opts.CSV))
+	default:
+		table, err = e.loadFile(path, path, opts)
+		if table != nil {
+			rows = len(table.Rows)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Table{
+		Name:      table.Name,
+		Headers:   table.Headers,
+		HeaderMap: table.HeaderMap,
+		Types:     table.Types,
+		source: &fileSource{
+			path:    path,
+			headers: table.Headers,
+			rows:    rows,
+			read:    func() (*Table, error) { return e.loadFile(path, path, opts) },
+		},
+	}, nil
+}
+
+// sampleCsv reads the header and the first csvSampleRows rows of a CSV file.
+// Its number of rows is extrapolated from the size of the file when it has
+// more rows than that; for compressed files this underestimates it.
+func (e *Engine) sampleCsv(path string, opts CSVOptions) (*Table, int, error) {
+	file, _, err := openDecompressed(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create table from CSV: open file error: %w", err)
+	}
+	defer file.Close()
+
+	var progress csvProgress
+	table, err := readCSV(path, file, opts, csvSampleRows, &progress)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create table from CSV: %w", err)
+	}
+	if err := e.validateHeaders(table.Headers, fileOrigin(path)); err != nil {
+		return nil, 0, err
+	}
+
+	rows := len(table.Rows)
+	if !progress.complete && progress.bytes > 0 {
+		if info, err := os.Stat(path); err == nil {
+			estimate := (info.Size() - progress.headerBytes) * int64(rows) / progress.bytes
+			rows = maxInt(rows, int(estimate))
+		}
+	}
+	return table, rows, nil
+}
+
+// fileSource reads the rows of one file of a multi-file table. headers are
+// the columns the file had when the table was created, and rows its
+// estimated number of rows.
+type fileSource struct {
+	path    string
+	headers []string
+	rows    int
+	read    func() (*Table, error)
+}
+
+func (s *fileSource) rowCount() int {
+	return s.rows
+}
+
+func (s *fileSource) load(ctx context.Context, columns []int, keep func(row []string) bool) ([][]string, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	table, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	changed := len(table.Headers) != len(s.headers)
+	for i := 0; !changed && i < len(s.headers); i++ {
+		changed = table.Headers[i] != s.headers[i]
+	}
+	if changed {
+		return nil, fmt.Errorf("the columns of file '%s' changed after the table was created", s.path)
+	}
+	if keep == nil {
+		return table.Rows, nil
+	}
+	var rows [][]string
+	for _, row := range table.Rows {
+		if keep(row) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// matchHeaders checks that table has the same columns as the first file,
+// whose headers are given.
+func matchHeaders(headers []string, table *Table, path, first string) error {
+	if len(headers) != len(table.Headers) {
+		return fmt.Errorf("file '%s' has %d columns, but '%s' has %d", path, len(table.Headers), first, len(headers))
+	}
+	for _, header := range headers {
+		if _, err := table.GetColumnIndex(header); err != nil {
+			return fmt.Errorf("file '%s' lacks column %s of '%s'", path, header, first)
+		}
+	}
+	return nil
+}
+
+// globBase returns the directory of pattern above its first glob part, which
+// every match of pattern lies in.
+func globBase(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for isGlobPattern(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// hivePartitions returns the keys and values of the key=value directory
+// names of path below base, the directory of the pattern path matched
+// before its first glob part. Directories named in the pattern itself are
+// the same for all files and are not partitions.
+func hivePartitions(path, base string) ([]string, []string) {
+	if rel, err := filepath.Rel(base, path); err == nil {
+		path = rel
+	}
+	var keys, values []string
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		key, value, ok := strings.Cut(dir, "=")
+		if !ok || key == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		if value == hiveDefaultPartition {
+			value = ""
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values
+}
+
+func (s *fileSetSource) rowCount() int {
+	rows := 0
+	for _, file := range s.files {
+		rows += file.table.numRows()
+	}
+	return rows
+}
+
+func (s *fileSetSource) load(ctx context.Context, columns []int, keep func(row []string) bool) ([][]string, error) {
+	if columns == nil {
+		columns = make([]int, len(s.fixed))
+		for i := range columns {
+			columns[i] = i
+		}
+	}
+
+	var rows [][]string
+	if keep == nil {
+		rows = make([][]string, 0, s.rowCount())
+	}
+	for _, file := range s.files {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
+		fileColumns := []int{}
+		for _, col := range columns {
+			if file.columns[col] >= 0 {
+				fileColumns = append(fileColumns, file.columns[col])
+			}
+		}
+		sort.Ints(fileColumns)
+		var keepFile func(fileRow []string) bool
+		if keep != nil {
+			keepFile = func(fileRow []string) bool { return keep(file.row(fileRow, columns)) }
+		}
+		table, err := file.table.withRows(ctx, fileColumns, keepFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fileRow := range table.Rows {
+			rows = append(rows, file.row(fileRow, columns))
+		}
+	}
+	return rows, nil
+}
+
+// row returns the row of the table holding the given columns of a row of
+// the file.
+func (f *setFile) row(fileRow []string, columns []int) []string {
+	row := append([]string(nil), f.values...)
+	for _, col := range columns {
+		if idx := f.columns[col]; idx >= 0 {
+			row[col] = fileRow[idx]
+		}
+	}
+	return row
+}
+
+// prunePartitions replaces the multi-file tables q reads with copies holding
+// only the files whose partition values and paths can satisfy the WHERE
+// conjuncts on them, so that the other files are never read. Tables read more
+// than once by the statement, or with indexes over their rows, are kept whole.
+func (e *Engine) prunePartitions(q *Query) {
+	uses := make(map[string]int)
+	countTableUses(q, uses)
+	e.prunePartitionsOf(q, uses)
+}
+
+func countTableUses(q *Query, uses map[string]int) {
+	if q.From == nil {
+		return
+	}
+	uses[q.From.Table]++
+	for _, join := range q.Joins {
+		uses[join.Table]++
+	}
+	if q.Union != nil {
+		for _, op := range q.Union.operations() {
+			countTableUses(op.Query, uses)
+		}
+	}
+}
+
+func (e *Engine) prunePartitionsOf(q *Query, uses map[string]int) {
+	if q.From == nil {
+		return
+	}
+	if q.Union != nil {
+		for _, op := range q.Union.operations() {
+			e.prunePartitionsOf(op.Query, uses)
+		}
+	}
+	if q.Where == nil {
+		return
+	}
+
+	tableData := e.createTableDataMap()
+	for name := range e.indexEligibleTables(q) {
+		table, ok := e.tables[name]
+		if !ok || uses[name] != 1 || len(e.indexes[name]) > 0 {
+			continue
+		}
+		src, ok := table.source.(*fileSetSource)
+		if !ok {
+			continue
+		}
+
+		var filters []Condition
+		for _, condition := range splitConjuncts(q.Where.Condition) {
+			if src.filtersFiles(condition, name, tableData) {
+				filters = append(filters, condition)
+			}
+		}
+		if len(filters) == 0 {
+			continue
+		}
+
+		pruned := &fileSetSource{fixed: src.fixed}
+		for _, file := range src.files {
+			if fileMatches(file, filters, name, tableData) {
+				pruned.files = append(pruned.files, file)
+			}
+		}
+		if len(pruned.files) < len(src.files) {
+			copied := *table
+			copied.source = pruned
+			e.tables[name] = &copied
+		}
+	}
+}
+
+// filtersFiles reports whether condition only reads partition or file
+// columns of the table, so that it has the same result for all rows of a
+// file.
+func (s *fileSetSource) filtersFiles(condition Condition, name string, tableData map[string]*Table) bool {
+	tables, ok := conditionTables(condition, tableData)
+	if !ok || len(tables) != 1 || !tables[name] {
+		return false
+	}
+	var columns []string
+	if !conditionColumns(condition, &columns) {
+		return false
+	}
+	for _, column := range columns {
+		tableName, colIdx, err := resolveColumn(column, tableData)
+		if err != nil || tableName != name || !s.fixed[colIdx] {
+			return false
+		}
+	}
+	return true
+}
+
+// fileMatches evaluates filters on a row holding the partition and file
+// values of file. A filter that fails to evaluate keeps the file, leaving the
+// error to the query.
+func fileMatches(file *setFile, filters []Condition, name string, tableData map[string]*Table) bool {
+	row := map[string][]string{name: file.values}
+	for _, filter := range filters {
+		if ok, err := filter.Evaluate(row, tableData); err == nil && !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package csvsql
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles writes files, keyed by their path relative to a new
+// temporary directory, and returns the directory.
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFileSet(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"orders/2023-03-01.csv": "id,amount\n1,10\n2,20\n",
+		"orders/2023-03-02.csv": "amount,id\n30,3\n",
+		"orders/notes.txt":      "not matched",
+	})
+	e := NewEngine()
+	err := e.CreateTableWithOptions("orders", filepath.Join(dir, "orders", "*.csv"), TableOptions{FileColumn: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := mustBuild(t, NewQuery().Select("id", "amount", "_file").From("orders"))
+	results := mustQuery(t, e, q)
+	assertColumn(t, results, 0, []string{"1", "2", "3"})
+	assertColumn(t, results, 1, []string{"10", "20", "30"})
+	if !strings.HasSuffix(results[3][2], "2023-03-02.csv") {
+		t.Errorf("_file = %q, want the path of the second file", results[3][2])
+	}
+}
+
+func TestFileSetSchemaDrift(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"a.csv": "id,name\n1,alice\n",
+		"b.csv": "id,city\n2,paris\n",
+	})
+	pattern := filepath.Join(dir, "*.csv")
+
+	if err := NewEngine().CreateTable("t", pattern); err == nil || !strings.Contains(err.Error(), "lacks column") {
+		t.Errorf("CreateTable error = %v, want a missing column", err)
+	}
+
+	e := NewEngine()
+	if err := e.CreateTableWithOptions("t", pattern, TableOptions{SchemaDrift: SchemaDriftUnion}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"t.id", "t.name", "t.city"}, {"1", "alice", ""}, {"2", "", "paris"}}
+	if got := mustQuery(t, e, mustBuild(t, NewQuery().Select("*").From("t"))); !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %q, want %q", got, want)
+	}
+}
+
+func TestHivePartitions(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		keys    []string
+		values  []string
+	}{
+		{"orders/*/*/*.csv", "orders/dt=2023-03-01/region=eu/part-0.csv", []string{"dt", "region"}, []string{"2023-03-01", "eu"}},
+		{"orders/*/*.csv", "orders/city=New%20York/part-0.csv", []string{"city"}, []string{"New York"}},
+		{"orders/*/*.csv", "orders/region=" + hiveDefaultPartition + "/part-0.csv", []string{"region"}, []string{""}},
+		{"orders/*/*/*.csv", "orders/2023/=x/part-0.csv", nil, nil},
+		{"data/env=prod/orders/*/*.csv", "data/env=prod/orders/dt=2023-03-01/part-0.csv", []string{"dt"}, []string{"2023-03-01"}},
+		{"data/env=prod/*.csv", "data/env=prod/part-0.csv", nil, nil},
+		{"./data/env=prod/*/*.csv", "data/env=prod/dt=1/part-0.csv", []string{"dt"}, []string{"1"}},
+	}
+	for _, tt := range tests {
+		keys, values := hivePartitions(filepath.FromSlash(tt.path), globBase(filepath.FromSlash(tt.pattern)))
+		if !reflect.DeepEqual(keys, tt.keys) || !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("hivePartitions(%s) of %s = %q, %q, want %q, %q", tt.path, tt.pattern, keys, values, tt.keys, tt.values)
+		}
+	}
+
+	// Directories of the pattern above its glob parts are not partitions,
+	// so files may have columns of the same name.
+	dir := writeTestFiles(t, map[string]string{
+		"env=prod/orders/a.csv": "id,env\n1,eu-prod\n",
+		"env=prod/orders/b.csv": "id,env\n2,us-prod\n",
+	})
+	e := NewEngine()
+	if err := e.CreateTable("orders", filepath.Join(dir, "env=prod", "orders", "*.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.tables["orders"].Headers; !reflect.DeepEqual(got, []string{"id", "env"}) {
+		t.Errorf("headers = %q, want the columns of the files", got)
+	}
+	assertColumn(t, mustQuery(t, e, mustBuild(t, NewQuery().Select("env").From("orders"))), 0, []string{"eu-prod", "us-prod"})
+}
+
+func TestFileSetPartitionPruning(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"dt=2023-03-01/region=eu/part.csv": "id\n1\n",
+		"dt=2023-03-01/region=us/part.csv": "id\n2\n",
+		"dt=2023-03-02/region=eu/part.csv": "id\n3\n",
+	})
+	e := NewEngine()
+	if err := e.CreateTable("orders", filepath.Join(dir, "*", "*", "*.csv")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files are read by queries, so removing one only breaks the queries
+	// that do not prune it.
+	if err := os.Remove(filepath.Join(dir, "dt=2023-03-01", "region=us", "part.csv")); err != nil {
+		t.Fatal(err)
+	}
+	q := mustBuild(t, NewQuery().Select("id", "dt").From("orders").Where("region", "=", "eu"))
+	results := mustQuery(t, e, q)
+	assertColumn(t, results, 0, []string{"1", "3"})
+	assertColumn(t, results, 1, []string{"2023-03-01", "2023-03-02"})
+
+	if _, err := e.ExecuteQuery(mustBuild(t, NewQuery().Select("id").From("orders"))); err == nil {
+		t.Error("query reading the removed file succeeded")
+	}
+
+	other := writeTestFiles(t, map[string]string{
+		"region=eu/part.csv":     "id\n1\n",
+		"dt=2023-03-01/part.csv": "id\n2\n",
+	})
+	if err := NewEngine().CreateTable("t", filepath.Join(other, "*", "*.csv")); err == nil {
+		t.Error("CreateTable succeeded for files with different partition columns")
+	}
+}
+
+func TestFileSetReadsFilesWhenQueried(t *testing.T) {
+	// Rows past the sampled start of the file are only read by queries.
+	var data strings.Builder
+	data.WriteString("id,name\n")
+	for i := 0; i < 10*csvSampleRows; i++ {
+		fmt.Fprintf(&data, "%d,name%d\n", i, i)
+	}
+	data.WriteString("bad,\"unterminated\n")
+	dir := writeTestFiles(t, map[string]string{"a.csv": data.String()})
+
+	e := NewEngine()
+	if err := e.CreateTable("t", filepath.Join(dir, "*.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if rows := e.tables["t"].numRows(); rows < 5*csvSampleRows || rows > 20*csvSampleRows {
+		t.Errorf("estimated %d rows, want about %d", rows, 10*csvSampleRows)
+	}
+	if _, err := e.ExecuteQuery(mustBuild(t, NewQuery().Select("id").From("t"))); err == nil {
+		t.Error("query succeeded on a malformed file")
+	}
+}
+
+func TestGlobCharactersInFileName(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"sales[2023].csv": "id\n1\n2\n"})
+	e := NewEngine()
+	if err := e.CreateTable("sales", filepath.Join(dir, "sales[2023].csv")); err != nil {
+		t.Fatal(err)
+	}
+	assertColumn(t, mustQuery(t, e, mustBuild(t, NewQuery().Select("id").From("sales"))), 0, []string{"1", "2"})
+}
+
+func TestFileSetRowsChangedUnderIndex(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"a.csv": "id\n1\n2\n3\n",
+		"b.csv": "id\n4\n5\n",
+	})
+	e := NewEngine()
+	if err := e.CreateTable("t", filepath.Join(dir, "*.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateIndex("t", "id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.csv"), []byte("id\n1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	q := mustBuild(t, NewQuery().Select("id").From("t").Where("id", "=", "5"))
+	if _, err := e.ExecuteQuery(q); err == nil || !strings.Contains(err.Error(), "when the index") {
+		t.Errorf("query error = %v, want the changed row count", err)
+	}
+}
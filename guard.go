@@ -0,0 +1,179 @@
+package csvsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ResourceLimits bound the resources a query may use. Zero values mean no
+// limit. MaxMemoryBytes is compared against an estimate of the memory held by
+// the rows an operator produces, not against actual allocations.
+type ResourceLimits struct {
+	MaxIntermediateRows int
+	MaxResultRows       int
+	MaxMemoryBytes      int64
+	MaxExecutionTime    time.Duration
+}
+
+func (l *ResourceLimits) Type() string {
+	return "LIMITS"
+}
+
+func (l *ResourceLimits) Validate() error {
+	if l.MaxIntermediateRows < 0 || l.MaxResultRows < 0 || l.MaxMemoryBytes < 0 || l.MaxExecutionTime < 0 {
+		return &ErrInvalidQuery{"resource limits cannot be negative"}
+	}
+	return nil
+}
+
+// merge returns the limits applying when both l and other are in effect,
+// which is the stricter value of every limit.
+func (l ResourceLimits) merge(other *ResourceLimits) ResourceLimits {
+	if other == nil {
+		return l
+	}
+	l.MaxIntermediateRows = int(stricter(int64(l.MaxIntermediateRows), int64(other.MaxIntermediateRows)))
+	l.MaxResultRows = int(stricter(int64(l.MaxResultRows), int64(other.MaxResultRows)))
+	l.MaxMemoryBytes = stricter(l.MaxMemoryBytes, other.MaxMemoryBytes)
+	l.MaxExecutionTime = time.Duration(stricter(int64(l.MaxExecutionTime), int64(other.MaxExecutionTime)))
+	return l
+}
+
+func stricter(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// WithResourceLimits applies limits to every query run by the engine. Limits
+// set on a query with QueryBuilder.WithResourceLimits can only tighten them.
+func WithResourceLimits(limits ResourceLimits) EngineOption {
+	return func(e *Engine) {
+		e.config.limits = limits
+	}
+}
+
+// WithResourceLimits sets limits for this query. The stricter of these and
+// the engine's limits applies; limits of set operation operands are ignored.
+func (qb *QueryBuilder) WithResourceLimits(limits ResourceLimits) *QueryBuilder {
+	if qb.err != nil {
+		return qb
+	}
+	if err := limits.Validate(); err != nil {
+		qb.err = err
+		return qb
+	}
+	qb.query.ResourceLimits = &limits
+	return qb
+}
+
+// Rough sizes used to estimate the memory held by intermediate rows. Values
+// are shared with the loaded tables, so only the bookkeeping is counted.
+const (
+	joinedRowBytes = 96
+	tableRowBytes  = 64
+	resultRowBytes = 24
+	cellBytes      = 16
+	// sortRowBytes covers the positions and the reordered row slice a sort
+	// allocates per row, on top of the rows it holds.
+	sortRowBytes = 40
+)
+
+// queryGuard enforces the resource limits of one query execution. result is
+// the statement whose rows make up the query result.
+type queryGuard struct {
+	limits   ResourceLimits
+	deadline time.Time
+	result   *statementPlan
+}
+
+func newQueryGuard(limits ResourceLimits) *queryGuard {
+	g := &queryGuard{limits: limits}
+	if limits.MaxExecutionTime > 0 {
+		g.deadline = time.Now().Add(limits.MaxExecutionTime)
+	}
+	return g
+}
+
+// checkRows verifies that rows produced by op, each estimated to take
+// rowBytes of memory, fit within the intermediate row and memory limits.
+func (g *queryGuard) checkRows(op PlanNodeType, rows int, rowBytes int64) error {
+	if g == nil {
+		return nil
+	}
+	if limit := g.limits.MaxIntermediateRows; limit > 0 && rows > limit {
+		return &ErrLimitExceeded{Kind: IntermediateRowsLimit, Operator: op, Limit: fmt.Sprint(limit)}
+	}
+	if limit := g.limits.MaxMemoryBytes; limit > 0 && int64(rows)*rowBytes > limit {
+		return &ErrLimitExceeded{Kind: MemoryLimit, Operator: op, Limit: fmt.Sprintf("%d bytes", limit)}
+	}
+	return nil
+}
+
+// rowCounter counts the rows an operator produces across worker goroutines
+// and checks them against the limits as they grow.
+type rowCounter struct {
+	rows     int64
+	guard    *queryGuard
+	op       PlanNodeType
+	rowBytes int64
+}
+
+func (c *rowCounter) add(n int) error {
+	if c.guard == nil {
+		return nil
+	}
+	return c.guard.checkRows(c.op, int(atomic.AddInt64(&c.rows, int64(n))), c.rowBytes)
+}
+
+// resultCounter counts the rows produced for the query result across worker
+// goroutines, failing as soon as they are known to make the result exceed
+// MaxResultRows. Only the rows that limit keeps count towards the result.
+type resultCounter struct {
+	rows  int64
+	guard *queryGuard
+	op    PlanNodeType
+	limit *LimitComponent
+}
+
+// resultCounter returns a counter for the rows op produces for p, or nil when
+// p does not produce the query result or there is no result row limit.
+func (g *queryGuard) resultCounter(p *queryPlan, op PlanNodeType) *resultCounter {
+	if g == nil || g.limits.MaxResultRows <= 0 || g.result == nil || g.result.set != nil || g.result.base != p {
+		return nil
+	}
+	return &resultCounter{guard: g, op: op, limit: p.query.Limit}
+}
+
+func (c *resultCounter) add(n int) error {
+	if c == nil {
+		return nil
+	}
+	return c.guard.checkResult(c.op, c.limit.keeps(int(atomic.AddInt64(&c.rows, int64(n)))))
+}
+
+func (g *queryGuard) checkResult(op PlanNodeType, rows int) error {
+	if g == nil {
+		return nil
+	}
+	if limit := g.limits.MaxResultRows; limit > 0 && rows > limit {
+		return &ErrLimitExceeded{Kind: ResultRowsLimit, Operator: op, Limit: fmt.Sprint(limit)}
+	}
+	return nil
+}
+
+// operatorError turns the context error caused by the execution time limit
+// into an ErrLimitExceeded naming op, the operator that was running.
+func (g *queryGuard) operatorError(op PlanNodeType, err error) error {
+	if g == nil || g.deadline.IsZero() || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if time.Now().Before(g.deadline) {
+		return err
+	}
+	return &ErrLimitExceeded{Kind: ExecutionTimeLimit, Operator: op, Limit: g.limits.MaxExecutionTime.String()}
+}
@@ -0,0 +1,108 @@
+package csvsql
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func assertLimitExceeded(t *testing.T, err error, kind LimitKind, op PlanNodeType) {
+	t.Helper()
+	var limitErr *ErrLimitExceeded
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("error = %v, want ErrLimitExceeded", err)
+	}
+	if limitErr.Kind != kind || limitErr.Operator != op {
+		t.Errorf("limit exceeded = %s in %s, want %s in %s", limitErr.Kind, limitErr.Operator, kind, op)
+	}
+}
+
+func TestResultRowsLimit(t *testing.T) {
+	const n = 1000
+	e := newLargeTestEngine(t, n, WithResourceLimits(ResourceLimits{MaxResultRows: 10}))
+
+	// The projection stops right after the eleventh row.
+	var projected int
+	q := mustBuild(t, NewQuery().Select("id").From("t").
+		SelectCustom("x", func(row map[string][]string, tables map[string]*Table) (string, error) {
+			projected++
+			return "", nil
+		}))
+	_, err := e.ExecuteQuery(q)
+	assertLimitExceeded(t, err, ResultRowsLimit, ProjectNode)
+	if projected != 11 {
+		t.Errorf("projected %d rows, want 11", projected)
+	}
+
+	// Rows dropped by LIMIT and OFFSET do not count.
+	q = mustBuild(t, NewQuery().Select("id").From("t").OrderBy("id", Desc).Limit(10).Offset(500))
+	assertColumn(t, mustQuery(t, e, q), 0, []string{"499", "498", "497", "496", "495", "494", "493", "492", "491", "490"})
+	q = mustBuild(t, NewQuery().Select("id").From("t").Offset(n-10))
+	if results := mustQuery(t, e, q); len(results) != 11 {
+		t.Errorf("got %d rows, want 10", len(results)-1)
+	}
+
+	// A stricter query limit applies too.
+	q = mustBuild(t, NewQuery().Select("id").From("t").Limit(5).WithResourceLimits(ResourceLimits{MaxResultRows: 4}))
+	_, err = e.ExecuteQuery(q)
+	assertLimitExceeded(t, err, ResultRowsLimit, ProjectNode)
+}
+
+func TestResultRowsLimitOfSetOperation(t *testing.T) {
+	e := newTestEngine(t, WithResourceLimits(ResourceLimits{MaxResultRows: 4}))
+	ids := func(table string) *QueryBuilder { return NewQuery().Select("id").From(table) }
+
+	_, err := e.ExecuteQuery(mustBuild(t, ids("u").Union(ids("v"))))
+	assertLimitExceeded(t, err, ResultRowsLimit, UnionNode)
+
+	// Operands are not results: each may be larger than the limit as long
+	// as the combined result is not.
+	assertColumn(t, mustQuery(t, e, mustBuild(t, ids("u").Union(ids("v")).Limit(4))), 0, []string{"1", "2", "3", "4"})
+	assertColumn(t, mustQuery(t, e, mustBuild(t, ids("u").Intersect(ids("v")))), 0, []string{"3"})
+}
+
+func TestIntermediateRowsLimit(t *testing.T) {
+	e := newJoinTestEngine(t, WithResourceLimits(ResourceLimits{MaxIntermediateRows: 5}))
+	q := mustBuild(t, NewQuery().Select("users.name", "orders.oid").From("users").
+		InnerJoin("orders").On("users", "id", "!=", "orders", "user_id"))
+	_, err := e.ExecuteQuery(q)
+	assertLimitExceeded(t, err, IntermediateRowsLimit, NestedLoopJoinNode)
+}
+
+func TestMemoryLimitOfSortAndWindow(t *testing.T) {
+	// A scan of n rows fits within the limit. The window holds the scanned
+	// rows along with its values, and sorting the projection of eight columns
+	// takes more than scanning them.
+	const n = 100
+	columns := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	rows := make([][]string, n)
+	for i := range rows {
+		rows[i] = make([]string, len(columns))
+		for j := range columns {
+			rows[i][j] = strconv.Itoa(i * j)
+		}
+	}
+	e := NewEngine(WithResourceLimits(ResourceLimits{MaxMemoryBytes: n * (joinedRowBytes + tableRowBytes)}))
+	if err := e.CreateTableFromRows("w", columns, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	mustQuery(t, e, mustBuild(t, NewQuery().Select("*").From("w")))
+	_, err := e.ExecuteQuery(mustBuild(t, NewQuery().Select("*").From("w").OrderBy("b", Desc)))
+	assertLimitExceeded(t, err, MemoryLimit, SortNode)
+	_, err = e.ExecuteQuery(mustBuild(t, NewQuery().Select("a").From("w").SelectWindow("rn", RowNumber().OrderBy("b"))))
+	assertLimitExceeded(t, err, MemoryLimit, WindowNode)
+}
+
+func TestExecutionTimeLimit(t *testing.T) {
+	e := newLargeTestEngine(t, 100, WithResourceLimits(ResourceLimits{MaxExecutionTime: 10 * time.Millisecond}))
+	q := mustBuild(t, NewQuery().Select("id").From("t").
+		WhereFunc(func(row map[string][]string, tables map[string]*Table) (bool, error) {
+			time.Sleep(time.Millisecond)
+			return true, nil
+		}))
+	_, err := e.ExecuteQueryContext(context.Background(), q)
+	assertLimitExceeded(t, err, ExecutionTimeLimit, FilterNode)
+}
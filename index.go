@@ -0,0 +1,479 @@
+package csvsql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Index is a secondary index over one column of a registered table. It keeps
+// a hash of values to row ids for equality lookups and the row ids ordered by
+// value for range lookups. Values are compared as strings, exactly like the
+// comparison operators do, so an index lookup always returns the same rows
+// as a full scan. Only the values of the column are kept, so an index on a
+// Parquet table does not hold on to the rows loaded to build it.
+type Index struct {
+	Table  string
+	Column string
+	values []string
+	hash   map[string][]int
+	sorted []int
+}
+
+// CreateIndex builds an index on a column of a registered table. The index is
+// built without holding the engine lock, so queries keep running meanwhile.
+func (e *Engine) CreateIndex(table, column string) error {
+	e.mu.RLock()
+	t, ok := e.tables[table]
+	e.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("table %s not found", table)
+	}
+
+	colIdx, err := t.GetColumnIndex(column)
+	if err != nil {
+		return err
+	}
+
+	if e.hasIndex(table, colIdx) {
+		return fmt.Errorf("index on %s.%s already exists", table, column)
+	}
+
+	if t.source != nil {
+		if t, err = t.withRows(context.Background(), []int{colIdx}, nil); err != nil {
+			return err
+		}
+	}
+	idx := newIndex(t, t.Headers[colIdx], colIdx)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, exists := e.indexes[table][colIdx]; exists {
+		return fmt.Errorf("index on %s.%s already exists", table, column)
+	}
+	if e.indexes[table] == nil {
+		e.indexes[table] = make(map[int]*Index)
+	}
+	e.indexes[table][colIdx] = idx
+	return nil
+}
+
+func (e *Engine) hasIndex(table string, colIdx int) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, exists := e.indexes[table][colIdx]
+	return exists
+}
+
+func newIndex(t *Table, column string, colIdx int) *Index {
+	idx := &Index{
+		Table:  t.Name,
+		Column: column,
+		values: make([]string, len(t.Rows)),
+		hash:   make(map[string][]int),
+		sorted: make([]int, len(t.Rows)),
+	}
+
+	for i, row := range t.Rows {
+		idx.values[i] = row[colIdx]
+		idx.hash[row[colIdx]] = append(idx.hash[row[colIdx]], i)
+		idx.sorted[i] = i
+	}
+
+	sort.SliceStable(idx.sorted, func(i, j int) bool {
+		return idx.value(idx.sorted[i]) < idx.value(idx.sorted[j])
+	})
+
+	return idx
+}
+
+// newHashIndex builds an index that only answers equality lookups.
+func newHashIndex(t *Table, colIdx int) *Index {
+	idx := &Index{
+		Table:  t.Name,
+		Column: t.Headers[colIdx],
+		hash:   make(map[string][]int),
+	}
+	for i, row := range t.Rows {
+		idx.hash[row[colIdx]] = append(idx.hash[row[colIdx]], i)
+	}
+	return idx
+}
+
+func (idx *Index) value(rowID int) string {
+	return idx.values[rowID]
+}
+
+func (idx *Index) String() string {
+	return idx.Table + "." + idx.Column
+}
+
+// lowerBound returns the first position in sorted order whose value is >= v.
+func (idx *Index) lowerBound(v string) int {
+	return sort.Search(len(idx.sorted), func(i int) bool {
+		return idx.value(idx.sorted[i]) >= v
+	})
+}
+
+// upperBound returns the first position in sorted order whose value is > v.
+func (idx *Index) upperBound(v string) int {
+	return sort.Search(len(idx.sorted), func(i int) bool {
+		return idx.value(idx.sorted[i]) > v
+	})
+}
+
+// rangeIDs returns the row ids between two sorted positions in table order.
+func (idx *Index) rangeIDs(from, to int) []int {
+	if from >= to {
+		return []int{}
+	}
+	ids := append([]int(nil), idx.sorted[from:to]...)
+	sort.Ints(ids)
+	return ids
+}
+
+// lookupOp returns the ids of rows whose value satisfies `value op operand`,
+// or false when op cannot be answered by the index.
+func (idx *Index) lookupOp(op Operator, operand string) ([]int, bool) {
+	cmp, ok := op.(ComparisonOperator)
+	if !ok {
+		return nil, false
+	}
+
+	switch cmp {
+	case Equal:
+		return append([]int{}, idx.hash[operand]...), true
+	case GreaterThan:
+		return idx.rangeIDs(idx.upperBound(operand), len(idx.sorted)), true
+	case GreaterThanEqual:
+		return idx.rangeIDs(idx.lowerBound(operand), len(idx.sorted)), true
+	case LessThan:
+		return idx.rangeIDs(0, idx.lowerBound(operand)), true
+	case LessThanEqual:
+		return idx.rangeIDs(0, idx.upperBound(operand)), true
+	default:
+		return nil, false
+	}
+}
+
+// lookup returns the ids of rows matching condition in table order, or false
+// when the condition cannot be answered by the index.
+func (idx *Index) lookup(condition Condition) ([]int, bool) {
+	switch c := condition.(type) {
+	case *SimpleCondition:
+		return idx.lookupOp(c.Op, c.Value)
+	case *InCondition:
+		seen := make(map[string]bool)
+		ids := []int{}
+		for _, v := range c.Values {
+			if !seen[v] {
+				seen[v] = true
+				ids = append(ids, idx.hash[v]...)
+			}
+		}
+		sort.Ints(ids)
+		return ids, true
+	case *BetweenCondition:
+		return idx.rangeIDs(idx.lowerBound(c.Low), idx.upperBound(c.High)), true
+	default:
+		return nil, false
+	}
+}
+
+// indexScan records a WHERE conjunct that was answered by an index.
+type indexScan struct {
+	index     *Index
+	condition Condition
+}
+
+// accessPath describes which rows of a table are read by a query. A nil rows
+// slice means the whole table. filters are WHERE conjuncts pushed down to the
+// table, evaluated against each row as it is scanned.
+type accessPath struct {
+	scans   []indexScan
+	rows    []int
+	filters []Condition
+}
+
+// scanRows returns the ids of the rows of table selected by path, or nil when
+// every row is selected.
+func (e *Engine) scanRows(ctx context.Context, table *Table, path *accessPath) ([]int, error) {
+	if path == nil {
+		return nil, nil
+	}
+	if len(path.filters) == 0 {
+		return path.rows, nil
+	}
+
+	candidates := path.rows
+	if candidates == nil {
+		candidates = make([]int, len(table.Rows))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
+
+	tableData := e.createTableDataMap()
+	parts := e.partitions(len(candidates))
+	selected := make([][]int, len(parts))
+	err := runPartitions(parts, func(i int, part partition) error {
+		for _, id := range candidates[part.lo:part.hi] {
+			if err := checkContext(ctx); err != nil {
+				return err
+			}
+			row := map[string][]string{table.Name: table.Rows[id]}
+			match := true
+			for _, filter := range path.filters {
+				ok, err := filter.Evaluate(row, tableData)
+				if err != nil {
+					return fmt.Errorf("where condition evaluation failed: %w", err)
+				}
+				if !ok {
+					match = false
+					break
+				}
+			}
+			if match {
+				selected[i] = append(selected[i], id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(candidates))
+	for _, part := range selected {
+		ids = append(ids, part...)
+	}
+	return ids, nil
+}
+
+func rowMask(ids []int, n int) []bool {
+	if ids == nil {
+		return nil
+	}
+	allowed := make([]bool, n)
+	for _, id := range ids {
+		allowed[id] = true
+	}
+	return allowed
+}
+
+func indexedColumn(condition Condition) (string, bool) {
+	switch c := condition.(type) {
+	case *SimpleCondition:
+		return c.Column, true
+	case *InCondition:
+		return c.Column, true
+	case *BetweenCondition:
+		return c.Column, true
+	default:
+		return "", false
+	}
+}
+
+// planIndexAccess answers the WHERE conjuncts it can from indexes and returns
+// the resulting access paths per table together with the conjuncts that
+// still have to be evaluated row by row.
+func (e *Engine) planIndexAccess(q *Query) (map[string]*accessPath, Condition) {
+	access := make(map[string]*accessPath)
+	if q.Where == nil {
+		return access, nil
+	}
+
+	eligible := e.indexEligibleTables(q)
+	tableData := e.createTableDataMap()
+
+	var residual []Condition
+	for _, condition := range splitConjuncts(q.Where.Condition) {
+		if !e.answerFromIndex(condition, eligible, tableData, access) {
+			residual = append(residual, condition)
+		}
+	}
+
+	return access, joinConjuncts(residual)
+}
+
+// indexEligibleTables returns the tables whose rows are never padded by an
+// outer join, so filtering them before joining gives the same result as
+// filtering the joined rows.
+func (e *Engine) indexEligibleTables(q *Query) map[string]bool {
+	eligible := map[string]bool{q.From.Table: true}
+	for _, join := range q.Joins {
+		switch join.JoinType {
+		case InnerJoin:
+			eligible[join.Table] = true
+		case RightJoin, FullJoin:
+			return map[string]bool{}
+		}
+	}
+	for _, join := range q.Joins {
+		if join.JoinType == LeftJoin {
+			delete(eligible, join.Table)
+		}
+	}
+	return eligible
+}
+
+func (e *Engine) answerFromIndex(condition Condition, eligible map[string]bool, tableData map[string]*Table, access map[string]*accessPath) bool {
+	column, ok := indexedColumn(condition)
+	if !ok {
+		return false
+	}
+
+	tableName, colIdx, err := resolveColumn(column, tableData)
+	if err != nil || !eligible[tableName] {
+		return false
+	}
+
+	idx, ok := e.indexes[tableName][colIdx]
+	if !ok {
+		return false
+	}
+
+	ids, ok := idx.lookup(condition)
+	if !ok {
+		return false
+	}
+
+	path, ok := access[tableName]
+	if !ok {
+		path = &accessPath{}
+		access[tableName] = path
+	}
+	path.scans = append(path.scans, indexScan{index: idx, condition: condition})
+	if path.rows == nil {
+		path.rows = ids
+	} else {
+		path.rows = intersectSorted(path.rows, ids)
+	}
+	return true
+}
+
+func intersectSorted(a, b []int) []int {
+	result := []int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// joinProbe looks up matching rows of the joined table by the value from the
+// other side of a join condition. index is nil for an equality join without
+// a secondary index, in which case a hash index is built when the join runs.
+type joinProbe struct {
+	index      *Index
+	column     int
+	op         ComparisonOperator
+	otherTable string
+	otherCol   int
+}
+
+func (e *Engine) planJoinProbe(join *JoinComponent) *joinProbe {
+	return e.findJoinProbe(join.Condition, join.Table)
+}
+
+func (e *Engine) findJoinProbe(condition JoinConditionEvaluator, table string) *joinProbe {
+	switch c := condition.(type) {
+	case *JoinCondition:
+		op, ok := c.Op.(ComparisonOperator)
+		if !ok || op == NotEqual || c.LeftTable == c.RightTable {
+			return nil
+		}
+
+		indexedCol, otherTable, otherCol := c.LeftCol, c.RightTable, c.RightCol
+		if c.RightTable == table {
+			indexedCol, otherTable, otherCol = c.RightCol, c.LeftTable, c.LeftCol
+			op = flipOperator(op)
+		} else if c.LeftTable != table {
+			return nil
+		}
+
+		joined, ok := e.tables[table]
+		if !ok {
+			return nil
+		}
+		indexedIdx, err := joined.GetColumnIndex(indexedCol)
+		if err != nil {
+			return nil
+		}
+
+		other, ok := e.tables[otherTable]
+		if !ok {
+			return nil
+		}
+		otherIdx, err := other.GetColumnIndex(otherCol)
+		if err != nil {
+			return nil
+		}
+
+		return &joinProbe{
+			index:      e.indexes[table][indexedIdx],
+			column:     indexedIdx,
+			op:         op,
+			otherTable: otherTable,
+			otherCol:   otherIdx,
+		}
+	case *CompositeJoinCondition:
+		if c.Operator != And {
+			return nil
+		}
+		if probe := e.findJoinProbe(c.Left, table); probe != nil {
+			return probe
+		}
+		return e.findJoinProbe(c.Right, table)
+	default:
+		return nil
+	}
+}
+
+// candidates returns the ids of joined-table rows that may match jr, or false
+// when the probe value is not available and every row must be examined.
+func (p *joinProbe) candidates(jr JoinedRow) ([]int, bool) {
+	key, ok := p.key(jr)
+	if !ok {
+		return nil, false
+	}
+	return p.index.lookupOp(p.op, key)
+}
+
+// key returns the value of a joined row that is compared with the joined
+// table's column.
+func (p *joinProbe) key(jr JoinedRow) (string, bool) {
+	otherRow, ok := jr.joinedRows[p.otherTable]
+	if p.otherTable == jr.mainTable {
+		otherRow, ok = jr.mainRow, true
+	}
+	if !ok || p.otherCol >= len(otherRow) {
+		return "", false
+	}
+	return otherRow[p.otherCol], true
+}
+
+// flipOperator returns the operator that gives the same result with its
+// operands swapped.
+func flipOperator(op ComparisonOperator) ComparisonOperator {
+	switch op {
+	case GreaterThan:
+		return LessThan
+	case GreaterThanEqual:
+		return LessThanEqual
+	case LessThan:
+		return GreaterThan
+	case LessThanEqual:
+		return GreaterThanEqual
+	default:
+		return op
+	}
+}
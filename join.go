@@ -109,6 +109,31 @@ func (c *CompositeJoinCondition) EvaluateJoin(row map[string][]string, tables ma
 	return result, nil
 }
 
+// evaluateJoinWithPadding evaluates condition with the comparisons that read a
+// column of a padded table taken as false. Custom conditions are evaluated
+// as they are and see the padded row's empty values.
+func evaluateJoinWithPadding(condition JoinConditionEvaluator, row map[string][]string, tables map[string]*Table, padded map[string]bool) (bool, error) {
+	switch c := condition.(type) {
+	case *JoinCondition:
+		if padded[c.LeftTable] || padded[c.RightTable] {
+			return false, nil
+		}
+		return c.EvaluateJoin(row, tables)
+	case *CompositeJoinCondition:
+		leftResult, err := evaluateJoinWithPadding(c.Left, row, tables, padded)
+		if err != nil {
+			return false, err
+		}
+		rightResult, err := evaluateJoinWithPadding(c.Right, row, tables, padded)
+		if err != nil {
+			return false, err
+		}
+		return c.Operator.Evaluate(strconv.FormatBool(leftResult), strconv.FormatBool(rightResult))
+	default:
+		return condition.EvaluateJoin(row, tables)
+	}
+}
+
 type CustomJoinCondition func(row map[string][]string, tables map[string]*Table) (bool, error)
 
 func (fn CustomJoinCondition) EvaluateJoin(row map[string][]string, tables map[string]*Table) (bool, error) {
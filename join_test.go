@@ -0,0 +1,168 @@
+package csvsql
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newJoinTestEngine registers users 1 to 3 and orders of users 1, 1 and 4,
+// so every join has matched and unmatched rows on both sides.
+func newJoinTestEngine(t *testing.T, opts ...EngineOption) *Engine {
+	t.Helper()
+	e := NewEngine(opts...)
+	if err := e.CreateTableFromRows("users", []string{"id", "name"}, [][]string{
+		{"1", "alice"}, {"2", "bob"}, {"3", "carol"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateTableFromRows("orders", []string{"oid", "user_id"}, [][]string{
+		{"10", "1"}, {"11", "1"}, {"12", "4"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestOuterJoins(t *testing.T) {
+	tests := []struct {
+		name     string
+		joinType JoinType
+		want     [][]string
+	}{
+		{"inner", InnerJoin, [][]string{{"alice", "10"}, {"alice", "11"}}},
+		{"left", LeftJoin, [][]string{{"alice", "10"}, {"alice", "11"}, {"bob", ""}, {"carol", ""}}},
+		{"right", RightJoin, [][]string{{"alice", "10"}, {"alice", "11"}, {"", "12"}}},
+		{"full", FullJoin, [][]string{{"alice", "10"}, {"alice", "11"}, {"bob", ""}, {"carol", ""}, {"", "12"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, indexed := range []bool{false, true} {
+				e := newJoinTestEngine(t)
+				if indexed {
+					if err := e.CreateIndex("orders", "user_id"); err != nil {
+						t.Fatal(err)
+					}
+				}
+				q := mustBuild(t, NewQuery().
+					Select("users.name", "orders.oid").
+					From("users").
+					InnerJoin("orders").
+					On("users", "id", "=", "orders", "user_id"))
+				q.Joins[0].JoinType = tt.joinType
+
+				if got := mustQuery(t, e, q)[1:]; !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("indexed=%v: rows = %v, want %v", indexed, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOuterJoinWithoutMatches(t *testing.T) {
+	e := newJoinTestEngine(t)
+	q := mustBuild(t, NewQuery().
+		Select("users.name", "orders.oid").
+		From("users").
+		LeftJoin("orders").
+		On("users", "id", ">", "orders", "user_id").
+		Where("users.id", "=", "1"))
+	want := [][]string{{"alice", ""}}
+	if got := mustQuery(t, e, q)[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+func TestPaddedRowsDoNotMatchLaterJoins(t *testing.T) {
+	tests := []struct {
+		name     string
+		joinType JoinType
+		want     [][]string
+	}{
+		{"left", LeftJoin, [][]string{{"alice", "first"}, {"alice", ""}, {"bob", ""}, {"carol", ""}}},
+		{"inner", InnerJoin, [][]string{{"alice", "first"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, indexed := range []bool{false, true} {
+				e := newJoinTestEngine(t)
+				if err := e.CreateTableFromRows("notes", []string{"order_id", "text"}, [][]string{
+					{"", "orphan"}, {"10", "first"},
+				}); err != nil {
+					t.Fatal(err)
+				}
+				if indexed {
+					if err := e.CreateIndex("notes", "order_id"); err != nil {
+						t.Fatal(err)
+					}
+				}
+				q := mustBuild(t, NewQuery().
+					Select("users.name", "notes.text").
+					From("users").
+					LeftJoin("orders").
+					On("users", "id", "=", "orders", "user_id").
+					LeftJoin("notes").
+					On("orders", "oid", "=", "notes", "order_id"))
+				q.Joins[1].JoinType = tt.joinType
+
+				if got := mustQuery(t, e, q)[1:]; !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("indexed=%v: rows = %v, want %v", indexed, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBetweenComparesText(t *testing.T) {
+	e := NewEngine()
+	if err := e.CreateTableFromRows("t", []string{"v"}, [][]string{{"9"}, {"10"}, {"2023-03-15"}}); err != nil {
+		t.Fatal(err)
+	}
+	results := mustQuery(t, e, mustBuild(t, NewQuery().Select("v").From("t").WhereBetween("v", "9", "10")))
+	assertColumn(t, results, 0, []string{})
+
+	results = mustQuery(t, e, mustBuild(t, NewQuery().Select("v").From("t").WhereBetween("v", "10", "9")))
+	assertColumn(t, results, 0, []string{"9", "10", "2023-03-15"})
+
+	results = mustQuery(t, e, mustBuild(t, NewQuery().Select("v").From("t").WhereBetween("v", "2023-03-01", "2023-04-30")))
+	assertColumn(t, results, 0, []string{"2023-03-15"})
+}
+
+func TestHashJoinMatchesNestedLoop(t *testing.T) {
+	e := newJoinTestEngine(t)
+	if err := e.CreateTableFromRows("payments", []string{"user_id", "amount"}, [][]string{
+		{"1", "5"}, {"", "7"}, {"3", "9"}, {"1", "11"}, {"", "13"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateTableFromRows("accounts", []string{"id"}, [][]string{{"1"}, {""}, {"2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, joinType := range []JoinType{InnerJoin, LeftJoin, RightJoin, FullJoin} {
+		hashed := mustBuild(t, NewQuery().
+			Select("accounts.id", "payments.amount").
+			From("accounts").
+			InnerJoin("payments").
+			On("accounts", "id", "=", "payments", "user_id"))
+		looped := mustBuild(t, NewQuery().
+			Select("accounts.id", "payments.amount").
+			From("accounts").
+			InnerJoin("payments").
+			OnFunc(func(row map[string][]string, tables map[string]*Table) (bool, error) {
+				return row["accounts"][0] == row["payments"][0], nil
+			}))
+		hashed.Joins[0].JoinType = joinType
+		looped.Joins[0].JoinType = joinType
+
+		plan, err := e.Explain(hashed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if findPlanNode(plan.Root, HashJoinNode) == nil {
+			t.Fatalf("join type %d: plan = %s, want a HashJoin", joinType, plan)
+		}
+		if got, want := mustQuery(t, e, hashed), mustQuery(t, e, looped); !reflect.DeepEqual(got, want) {
+			t.Errorf("join type %d: hash join = %v, nested loop join = %v", joinType, got, want)
+		}
+	}
+}
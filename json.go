@@ -0,0 +1,253 @@
+package csvsql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NewTableFromJSON loads a JSON file holding an array of objects, or a
+// newline-delimited JSON file holding one object per line. Columns are the
+// union of the objects' keys in order of first appearance, with nested
+// objects flattened into dotted names such as address.city. Missing keys and
+// nulls become empty values, and arrays are kept as JSON text. Column types
+// are derived from the JSON types of the values; they describe the columns
+// but do not change how conditions compare them, which is as text. A nested
+// field whose dotted name is also a key of the object is an error.
+func NewTableFromJSON(name, filepath string) (*Table, error) {
+	file, _, err := openDecompressed(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("open file error: %w", err)
+	}
+	defer file.Close()
+
+	return newTableFromJSONReader(name, file)
+}
+
+func newTableFromJSONReader(name string, r io.Reader) (*Table, error) {
+	buffered := bufio.NewReader(r)
+	skipBOM(buffered)
+
+	decoder := json.NewDecoder(buffered)
+	builder := &jsonTableBuilder{index: make(map[string]int)}
+
+	first, err := firstNonSpace(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("read json error: %w", err)
+	}
+	array := first == '['
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return nil, fmt.Errorf("read json error: %w", err)
+		}
+	}
+
+	for n := 1; ; n++ {
+		if array && !decoder.More() {
+			if _, err := decoder.Token(); err != nil {
+				return nil, fmt.Errorf("read json error: %w", err)
+			}
+			break
+		}
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF && !array {
+				break
+			}
+			return nil, fmt.Errorf("read json object %d error: %w", n, err)
+		}
+		if err := builder.addObject(raw); err != nil {
+			return nil, fmt.Errorf("read json object %d error: %w", n, err)
+		}
+	}
+
+	return builder.table(name), nil
+}
+
+// firstNonSpace returns the first byte of r that is not white space without
+// consuming it, or 0 for empty input.
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// jsonKind is the JSON type of the values of a column.
+type jsonKind int
+
+const (
+	jsonNull jsonKind = iota
+	jsonBool
+	jsonInteger
+	jsonFloat
+	jsonString
+)
+
+func mergeJSONKinds(a, b jsonKind) jsonKind {
+	switch {
+	case a == b || b == jsonNull:
+		return a
+	case a == jsonNull:
+		return b
+	case (a == jsonInteger && b == jsonFloat) || (a == jsonFloat && b == jsonInteger):
+		return jsonFloat
+	default:
+		return jsonString
+	}
+}
+
+func (k jsonKind) columnType() ColumnType {
+	switch k {
+	case jsonBool:
+		return BooleanColumn
+	case jsonInteger:
+		return IntegerColumn
+	case jsonFloat:
+		return FloatColumn
+	default:
+		return StringColumn
+	}
+}
+
+type jsonTableBuilder struct {
+	headers []string
+	index   map[string]int
+	kinds   []jsonKind
+	rows    [][]string
+}
+
+func (b *jsonTableBuilder) addObject(raw json.RawMessage) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '{' {
+		return fmt.Errorf("value is not an object")
+	}
+	row := make([]string, len(b.headers))
+	if err := b.flatten("", raw, &row, make(map[string]string)); err != nil {
+		return err
+	}
+	b.rows = append(b.rows, row)
+	return nil
+}
+
+// flatten stores the fields of the object raw in row, naming the fields of
+// nested objects by their path from the top-level object. seen records the
+// prefix of the object each name set in row came from, so that a nested field
+// and a key containing a dot, such as {"a": {"b": 1}, "a.b": 2}, cannot
+// silently overwrite each other. A repeated key keeps its last value, as with
+// encoding/json.
+func (b *jsonTableBuilder) flatten(prefix string, raw json.RawMessage, row *[]string, seen map[string]string) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := prefix + token.(string)
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		if value[0] == '{' {
+			if err := b.flatten(key+".", value, row, seen); err != nil {
+				return err
+			}
+			continue
+		}
+
+		text, kind, err := jsonValue(value)
+		if err != nil {
+			return err
+		}
+		if object, ok := seen[key]; ok && object != prefix {
+			return fmt.Errorf("field %s is set both by a key and by a nested object", key)
+		}
+		seen[key] = prefix
+		idx, ok := b.index[key]
+		if !ok {
+			idx = len(b.headers)
+			b.index[key] = idx
+			b.headers = append(b.headers, key)
+			b.kinds = append(b.kinds, jsonNull)
+		}
+		for len(*row) <= idx {
+			*row = append(*row, "")
+		}
+		(*row)[idx] = text
+		b.kinds[idx] = mergeJSONKinds(b.kinds[idx], kind)
+	}
+	return nil
+}
+
+// jsonValue converts a scalar or array to its cell value and kind.
+func jsonValue(raw json.RawMessage) (string, jsonKind, error) {
+	switch raw[0] {
+	case 'n':
+		return "", jsonNull, nil
+	case 't', 'f':
+		return string(raw), jsonBool, nil
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", jsonNull, err
+		}
+		return s, jsonString, nil
+	case '[':
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return "", jsonNull, err
+		}
+		return compact.String(), jsonString, nil
+	default:
+		if bytes.ContainsAny(raw, ".eE") {
+			return string(raw), jsonFloat, nil
+		}
+		return string(raw), jsonInteger, nil
+	}
+}
+
+func (b *jsonTableBuilder) table(name string) *Table {
+	headerMap := make(map[string]int)
+	for i, header := range b.headers {
+		headerMap[strings.ToLower(header)] = i
+	}
+
+	for i, row := range b.rows {
+		if len(row) < len(b.headers) {
+			padded := make([]string, len(b.headers))
+			copy(padded, row)
+			b.rows[i] = padded
+		}
+	}
+
+	types := make([]ColumnType, len(b.kinds))
+	for i, kind := range b.kinds {
+		types[i] = kind.columnType()
+	}
+
+	return &Table{
+		Name:      name,
+		Headers:   b.headers,
+		Rows:      b.rows,
+		HeaderMap: headerMap,
+		Types:     types,
+	}
+}
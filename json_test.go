@@ -0,0 +1,128 @@
+package csvsql
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONTable(t *testing.T) {
+	data := `[
+		{"id": 1, "score": 9.5, "ok": true, "tags": ["a", "b"], "address": {"city": "Paris"}},
+		{"id": 10, "score": 10, "ok": null, "name": "bob", "address": {"city": "Lyon", "zip": "69001"}}
+	]`
+	table, err := newTableFromJSONReader("t", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := []string{"id", "score", "ok", "tags", "address.city", "name", "address.zip"}
+	if !reflect.DeepEqual(table.Headers, headers) {
+		t.Errorf("headers = %q, want %q", table.Headers, headers)
+	}
+	types := []ColumnType{IntegerColumn, FloatColumn, BooleanColumn, StringColumn, StringColumn, StringColumn, StringColumn}
+	if !reflect.DeepEqual(table.Types, types) {
+		t.Errorf("types = %v, want %v", table.Types, types)
+	}
+	rows := [][]string{
+		{"1", "9.5", "true", `["a","b"]`, "Paris", "", ""},
+		{"10", "10", "", "", "Lyon", "bob", "69001"},
+	}
+	if !reflect.DeepEqual(table.Rows, rows) {
+		t.Errorf("rows = %q, want %q", table.Rows, rows)
+	}
+}
+
+func TestJSONTableComparesAsText(t *testing.T) {
+	e := NewEngine()
+	data := "{\"id\": 9}\n{\"id\": 10}\n"
+	if err := e.CreateTableFromReader("t", strings.NewReader(data), "ndjson", TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// The column is typed as integers, but "10" sorts before "9" as text.
+	q := mustBuild(t, NewQuery().Select("id").From("t").Where("id", "<", "9"))
+	assertColumn(t, mustQuery(t, e, q), 0, []string{"10"})
+}
+
+func TestJSONFlattenedKeyCollision(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"key after nested field", `{"a": {"b": 1}, "a.b": 2}`, false},
+		{"key before nested field", `{"a.b": 1, "a": {"b": 2}}`, false},
+		{"deeper nesting", `{"a": {"b.c": 1, "b": {"c": 2}}}`, false},
+		{"repeated key", `{"a": 1, "a": 2}`, true},
+		{"same name in different objects", "{\"a\": {\"b\": 1}}\n{\"a.b\": 2}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTableFromJSONReader("t", strings.NewReader(tt.data))
+			if tt.ok && err != nil {
+				t.Errorf("error = %v, want none", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("loading succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestJSONFiles(t *testing.T) {
+	files := map[string]string{
+		"users.json": `[
+			{"id": 1, "address": {"city": "Paris"}},
+			{"id": 2, "address": {"city": "Lyon"}}
+		]`,
+		"users.jsonl":  "{\"id\": 1, \"address\": {\"city\": \"Paris\"}}\n{\"id\": 2, \"address\": {\"city\": \"Lyon\"}}\n",
+		"users.ndjson": "{\"id\": 1, \"address\": {\"city\": \"Paris\"}}\n\n{\"id\": 2, \"address\": {\"city\": \"Lyon\"}}",
+	}
+
+	dir := t.TempDir()
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			e := NewEngine()
+			if err := e.CreateTable("t", path); err != nil {
+				t.Fatal(err)
+			}
+			q := mustBuild(t, NewQuery().Select("id", "address.city").From("t"))
+			assertColumn(t, mustQuery(t, e, q), 1, []string{"Paris", "Lyon"})
+		})
+	}
+}
+
+func TestJSONFlattenedColumnsInQueries(t *testing.T) {
+	e := NewEngine()
+	data := `[
+		{"id": 1, "address": {"city": "Paris"}},
+		{"id": 2, "address": {"city": "Lyon"}},
+		{"id": 3, "address": {"city": "Paris"}}
+	]`
+	if err := e.CreateTableFromReader("t", strings.NewReader(data), "json", TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query *QueryBuilder
+		want  []string
+	}{
+		{"select", NewQuery().Select("address.city").From("t"), []string{"Paris", "Lyon", "Paris"}},
+		{"select qualified", NewQuery().Select("t.address.city").From("t"), []string{"Paris", "Lyon", "Paris"}},
+		{"filter", NewQuery().Select("address.city").From("t").Where("address.city", "=", "Lyon"), []string{"Lyon"}},
+		{"filter qualified", NewQuery().Select("t.address.city").From("t").Where("t.address.city", "=", "Paris"), []string{"Paris", "Paris"}},
+		{"order by", NewQuery().Select("address.city").From("t").OrderBy("address.city"), []string{"Lyon", "Paris", "Paris"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertColumn(t, mustQuery(t, e, mustBuild(t, tt.query)), 0, tt.want)
+		})
+	}
+}
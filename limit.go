@@ -0,0 +1,75 @@
+package csvsql
+
+type LimitComponent struct {
+	// Count is the maximum number of rows to return, or -1 for no limit.
+	Count  int
+	Offset int
+}
+
+func (l *LimitComponent) Type() string {
+	return "LIMIT"
+}
+
+func (l *LimitComponent) Validate() error {
+	if l.Count < -1 {
+		return &ErrInvalidQuery{"LIMIT cannot be negative"}
+	}
+	if l.Offset < 0 {
+		return &ErrInvalidQuery{"OFFSET cannot be negative"}
+	}
+	return nil
+}
+
+func (qb *QueryBuilder) Limit(count int) *QueryBuilder {
+	if qb.err != nil {
+		return qb
+	}
+	if count < 0 {
+		qb.err = &ErrInvalidQuery{"LIMIT cannot be negative"}
+		return qb
+	}
+	if qb.query.Limit == nil {
+		qb.query.Limit = &LimitComponent{}
+	}
+	qb.query.Limit.Count = count
+	return qb
+}
+
+func (qb *QueryBuilder) Offset(offset int) *QueryBuilder {
+	if qb.err != nil {
+		return qb
+	}
+	if offset < 0 {
+		qb.err = &ErrInvalidQuery{"OFFSET cannot be negative"}
+		return qb
+	}
+	if qb.query.Limit == nil {
+		qb.query.Limit = &LimitComponent{Count: -1}
+	}
+	qb.query.Limit.Offset = offset
+	return qb
+}
+
+func (l *LimitComponent) apply(rows [][]string) [][]string {
+	if l.Offset >= len(rows) {
+		return rows[:0]
+	}
+	rows = rows[l.Offset:]
+	if l.Count >= 0 && l.Count < len(rows) {
+		rows = rows[:l.Count]
+	}
+	return rows
+}
+
+// keeps returns the number of rows apply keeps of n rows. A nil limit keeps
+// them all.
+func (l *LimitComponent) keeps(n int) int {
+	if l == nil {
+		return n
+	}
+	n = maxInt(n-l.Offset, 0)
+	if l.Count >= 0 {
+		n = minInt(n, l.Count)
+	}
+	return n
+}
@@ -0,0 +1,334 @@
+package csvsql
+
+import (
+	"sort"
+	"strings"
+)
+
+// conditionTables returns the tables a WHERE condition reads from, or false
+// when they cannot be determined, as for custom functions.
+func conditionTables(condition Condition, tables map[string]*Table) (map[string]bool, bool) {
+	switch c := condition.(type) {
+	case *CompositeCondition:
+		left, ok := conditionTables(c.Left, tables)
+		if !ok {
+			return nil, false
+		}
+		right, ok := conditionTables(c.Right, tables)
+		if !ok {
+			return nil, false
+		}
+		for table := range right {
+			left[table] = true
+		}
+		return left, true
+	default:
+		column, ok := indexedColumn(condition)
+		if !ok {
+			return nil, false
+		}
+		tableName, _, err := resolveColumn(column, tables)
+		if err != nil {
+			return nil, false
+		}
+		return map[string]bool{tableName: true}, true
+	}
+}
+
+// joinConditionTables returns the tables a join condition reads from, or
+// false when they cannot be determined.
+func joinConditionTables(condition JoinConditionEvaluator) (map[string]bool, bool) {
+	switch c := condition.(type) {
+	case *JoinCondition:
+		return map[string]bool{c.LeftTable: true, c.RightTable: true}, true
+	case *CompositeJoinCondition:
+		left, ok := joinConditionTables(c.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := joinConditionTables(c.Right)
+		if !ok {
+			return nil, false
+		}
+		for table := range right {
+			left[table] = true
+		}
+		return left, true
+	default:
+		return nil, false
+	}
+}
+
+// pushDownPredicates moves the conjuncts of residual that read a single table
+// into that table's access path, so they are evaluated while scanning it
+// instead of on the joined rows. Only tables that are never padded by an
+// outer join qualify. The conjuncts that remain are returned.
+func (e *Engine) pushDownPredicates(q *Query, access map[string]*accessPath, residual Condition) Condition {
+	if residual == nil {
+		return nil
+	}
+
+	eligible := e.indexEligibleTables(q)
+	tableData := e.createTableDataMap()
+
+	var remaining []Condition
+	for _, condition := range splitConjuncts(residual) {
+		tables, ok := conditionTables(condition, tableData)
+		if !ok || len(tables) != 1 {
+			remaining = append(remaining, condition)
+			continue
+		}
+
+		var tableName string
+		for tableName = range tables {
+		}
+		if !eligible[tableName] {
+			remaining = append(remaining, condition)
+			continue
+		}
+
+		path, ok := access[tableName]
+		if !ok {
+			path = &accessPath{}
+			access[tableName] = path
+		}
+		path.filters = append(path.filters, condition)
+	}
+
+	return joinConjuncts(remaining)
+}
+
+// orderJoins returns the positions of q.Joins in the order they should run.
+// Inner joins are reordered greedily so that the join with the smallest
+// estimated result runs next, preferring the smaller input on ties, as long as
+// its condition only reads tables that are already joined. Queries with outer
+// or custom joins keep their order.
+func (e *Engine) orderJoins(q *Query, access map[string]*accessPath) []int {
+	order := make([]int, len(q.Joins))
+	for i := range order {
+		order[i] = i
+	}
+	if len(q.Joins) < 2 {
+		return order
+	}
+
+	available := map[string]bool{q.From.Table: true}
+	conditionTables := make([]map[string]bool, len(q.Joins))
+	for i, join := range q.Joins {
+		if join.JoinType != InnerJoin || join.Condition == nil {
+			return order
+		}
+		if _, ok := e.tables[join.Table]; !ok {
+			return order
+		}
+		tables, ok := joinConditionTables(join.Condition)
+		if !ok {
+			return order
+		}
+		available[join.Table] = true
+		for table := range tables {
+			if !available[table] {
+				return order
+			}
+		}
+		conditionTables[i] = tables
+	}
+
+	mainTable := e.tables[q.From.Table]
+	current := estimateScanRows(mainTable, access[q.From.Table])
+	joined := map[string]bool{q.From.Table: true}
+	used := make([]bool, len(q.Joins))
+	order = order[:0]
+
+	for len(order) < len(q.Joins) {
+		best, bestRows, bestInput := -1, 0, 0
+		for i, join := range q.Joins {
+			if used[i] || !joinReady(conditionTables[i], joined, join.Table) {
+				continue
+			}
+			step := &joinStep{join: join, probe: e.planJoinProbe(join)}
+			if step.probe != nil && step.probe.index == nil && step.probe.op != Equal {
+				step.probe = nil
+			}
+			right := estimateScanRows(e.tables[join.Table], access[join.Table])
+			rows := estimateJoinRows(step, current, right)
+			if best == -1 || rows < bestRows || (rows == bestRows && right < bestInput) {
+				best, bestRows, bestInput = i, rows, right
+			}
+		}
+
+		used[best] = true
+		joined[q.Joins[best].Table] = true
+		order = append(order, best)
+		current = bestRows
+	}
+
+	return order
+}
+
+func joinReady(tables map[string]bool, joined map[string]bool, table string) bool {
+	for t := range tables {
+		if t != table && !joined[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func estimateScanRows(table *Table, path *accessPath) int {
+	rows := table.numRows()
+	if path == nil {
+		return rows
+	}
+	if path.rows != nil {
+		rows = len(path.rows)
+	}
+	for _, filter := range path.filters {
+		rows = int(float64(rows) * estimateSelectivity(filter))
+	}
+	return rows
+}
+
+// referencedColumns returns, per table, the columns a query reads. Tables
+// missing from the result are read in full, which is the case for every table
+// once a custom function is involved since it may read any column. Only
+// sources loaded per query, such as Parquet files, skip the other columns;
+// tables held in memory are scanned whole and the columns merely show up in
+// the plan.
+func (e *Engine) referencedColumns(q *Query) map[string][]string {
+	if len(q.Select.CustomColumns) > 0 {
+		return nil
+	}
+	for _, join := range q.Joins {
+		if _, ok := joinConditionTables(join.Condition); !ok && join.Condition != nil {
+			return nil
+		}
+	}
+
+	tableData := e.createTableDataMap()
+	queried := map[string]bool{q.From.Table: true}
+	for _, join := range q.Joins {
+		queried[join.Table] = true
+	}
+
+	used := make(map[string]map[int]bool)
+	for table := range queried {
+		used[table] = make(map[int]bool)
+	}
+	markAll := func(table string) {
+		if t, ok := e.tables[table]; ok && used[table] != nil {
+			for i := range t.Headers {
+				used[table][i] = true
+			}
+		}
+	}
+	mark := func(column string) bool {
+		tableName, colIdx, err := resolveColumn(column, tableData)
+		if err != nil || used[tableName] == nil {
+			return false
+		}
+		used[tableName][colIdx] = true
+		return true
+	}
+
+	var columns []string
+	for _, col := range q.Select.Columns {
+		switch {
+		case col == "*":
+			for table := range queried {
+				markAll(table)
+			}
+		case strings.HasSuffix(col, ".*"):
+			markAll(strings.TrimSuffix(col, ".*"))
+		default:
+			columns = append(columns, col)
+		}
+	}
+	for _, wc := range q.Select.WindowColumns {
+		if wc.Window.Column != "*" && wc.Window.Column != "" {
+			columns = append(columns, wc.Window.Column)
+		}
+		columns = append(columns, wc.Window.Partition...)
+		for _, field := range wc.Window.Order {
+			columns = append(columns, field.Column)
+		}
+	}
+	if q.OrderBy != nil {
+		for _, field := range q.OrderBy.Fields {
+			if !selectsName(q.Select, field.Column) {
+				columns = append(columns, field.Column)
+			}
+		}
+	}
+	if q.Where != nil {
+		if !conditionColumns(q.Where.Condition, &columns) {
+			return nil
+		}
+	}
+	for _, join := range q.Joins {
+		joinColumns(join.Condition, &columns)
+	}
+
+	for _, col := range columns {
+		if !mark(col) {
+			// Unresolvable names fail at execution; reading everything keeps
+			// the error behaviour unchanged.
+			return nil
+		}
+	}
+
+	result := make(map[string][]string)
+	for table, cols := range used {
+		t := e.tables[table]
+		if t == nil {
+			continue
+		}
+		indexes := make([]int, 0, len(cols))
+		for idx := range cols {
+			indexes = append(indexes, idx)
+		}
+		sort.Ints(indexes)
+		names := make([]string, len(indexes))
+		for i, idx := range indexes {
+			names[i] = t.Headers[idx]
+		}
+		result[table] = names
+	}
+	return result
+}
+
+func selectsName(s *SelectComponent, name string) bool {
+	for _, cc := range s.CustomColumns {
+		if strings.EqualFold(cc.Name, name) {
+			return true
+		}
+	}
+	for _, wc := range s.WindowColumns {
+		if strings.EqualFold(wc.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func conditionColumns(condition Condition, columns *[]string) bool {
+	if composite, ok := condition.(*CompositeCondition); ok {
+		return conditionColumns(composite.Left, columns) && conditionColumns(composite.Right, columns)
+	}
+	column, ok := indexedColumn(condition)
+	if !ok {
+		return false
+	}
+	*columns = append(*columns, column)
+	return true
+}
+
+func joinColumns(condition JoinConditionEvaluator, columns *[]string) {
+	switch c := condition.(type) {
+	case *JoinCondition:
+		*columns = append(*columns, c.LeftTable+"."+c.LeftCol, c.RightTable+"."+c.RightCol)
+	case *CompositeJoinCondition:
+		joinColumns(c.Left, columns)
+		joinColumns(c.Right, columns)
+	}
+}
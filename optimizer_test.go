@@ -0,0 +1,102 @@
+package csvsql
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// newOptimizerTestEngines returns two engines over the same random tables,
+// the second one with the optimizer turned off. a is large, b medium and c
+// small, so reordering the joins of a query written as a, b, c pays off.
+func newOptimizerTestEngines(t *testing.T) (*Engine, *Engine) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	value := func(n int) string {
+		if rng.Intn(10) == 0 {
+			return ""
+		}
+		return strconv.Itoa(rng.Intn(n))
+	}
+	tables := []struct {
+		name    string
+		headers []string
+		rows    int
+	}{
+		{"a", []string{"id", "x", "grp"}, 200},
+		{"b", []string{"id", "a_id", "y"}, 80},
+		{"c", []string{"id", "b_id", "z"}, 10},
+	}
+
+	optimized, plain := NewEngine(), NewEngine()
+	plain.config.noOptimize = true
+	for _, tt := range tables {
+		rows := make([][]string, tt.rows)
+		for i := range rows {
+			rows[i] = []string{strconv.Itoa(i), value(tt.rows), value(5)}
+		}
+		for _, e := range []*Engine{optimized, plain} {
+			if err := e.CreateTableFromRows(tt.name, tt.headers, rows); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return optimized, plain
+}
+
+func TestOptimizerPreservesResults(t *testing.T) {
+	optimized, plain := newOptimizerTestEngines(t)
+
+	queries := []string{
+		"SELECT a.id, b.id, c.id FROM a JOIN b ON a.id = b.a_id JOIN c ON b.id = c.b_id",
+		"SELECT a.id, b.id, c.id FROM a JOIN b ON a.id = b.a_id JOIN c ON a.x = c.b_id",
+		"SELECT * FROM a JOIN b ON a.id = b.a_id JOIN c ON b.id = c.b_id WHERE a.grp = '1' AND c.z != '2'",
+		"SELECT a.id, c.z FROM a JOIN b ON a.id = b.a_id JOIN c ON b.id = c.b_id AND c.z < b.y WHERE b.y IN ('1', '2', '3')",
+		"SELECT a.id, b.y FROM a JOIN b ON a.x = b.a_id WHERE a.grp = '1' OR b.y = '2'",
+		"SELECT a.id, b.id FROM a LEFT JOIN b ON a.id = b.a_id WHERE b.y IS NULL AND a.grp BETWEEN '1' AND '3'",
+		"SELECT a.id, b.id FROM a RIGHT JOIN b ON a.id = b.a_id WHERE a.grp = '4'",
+		"SELECT a.id, b.id, c.id FROM a JOIN b ON a.id = b.a_id LEFT JOIN c ON b.id = c.b_id WHERE a.x > '5' AND c.z = '0'",
+		"SELECT c.id, a.id FROM c JOIN b ON c.b_id = b.id JOIN a ON b.a_id = a.id WHERE NOT a.grp = '0' ORDER BY a.id LIMIT 10",
+	}
+	for i, sql := range queries {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			q, err := ParseSQL(sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, want := mustQuery(t, optimized, q), mustQuery(t, plain, q)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s:\noptimized = %v\nplain     = %v", sql, got, want)
+			}
+		})
+	}
+}
+
+func TestOptimizerRewritesPlan(t *testing.T) {
+	optimized, plain := newOptimizerTestEngines(t)
+	q, err := ParseSQL("SELECT a.id FROM a JOIN b ON a.id = b.a_id JOIN c ON a.id = c.b_id WHERE a.grp = '1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := optimized.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findPlanNode(plan.Root, FilterNode) != nil {
+		t.Errorf("optimized plan keeps a Filter above the joins:\n%s", plan)
+	}
+	if join := findPlanNode(plan.Root, HashJoinNode); join == nil || join.Children[0].Children[1].Detail[:1] != "c" {
+		t.Errorf("optimized plan does not join c before b:\n%s", plan)
+	}
+
+	plan, err = plain.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findPlanNode(plan.Root, FilterNode) == nil {
+		t.Errorf("plain plan has no Filter:\n%s", plan)
+	}
+}
@@ -0,0 +1,238 @@
+package csvsql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type SortDirection string
+
+const (
+	Asc  SortDirection = "ASC"
+	Desc SortDirection = "DESC"
+)
+
+type OrderByField struct {
+	Column    string
+	Direction SortDirection
+}
+
+type OrderByComponent struct {
+	Fields []OrderByField
+}
+
+func (o *OrderByComponent) Type() string {
+	return "ORDER BY"
+}
+
+func (o *OrderByComponent) Validate() error {
+	if len(o.Fields) == 0 {
+		return &ErrInvalidQuery{"ORDER BY must specify at least one column"}
+	}
+	return validateOrderByFields(o.Fields)
+}
+
+func validateOrderByFields(fields []OrderByField) error {
+	for _, field := range fields {
+		if field.Column == "" {
+			return &ErrInvalidQuery{"ORDER BY column cannot be empty"}
+		}
+		if field.Direction != Asc && field.Direction != Desc {
+			return &ErrInvalidQuery{fmt.Sprintf("invalid sort direction: %s", field.Direction)}
+		}
+	}
+	return nil
+}
+
+func newOrderByField(column string, direction []SortDirection) OrderByField {
+	field := OrderByField{Column: column, Direction: Asc}
+	if len(direction) > 0 {
+		field.Direction = SortDirection(strings.ToUpper(string(direction[0])))
+	}
+	return field
+}
+
+func (qb *QueryBuilder) OrderBy(column string, direction ...SortDirection) *QueryBuilder {
+	if qb.err != nil {
+		return qb
+	}
+	if qb.query.OrderBy == nil {
+		qb.query.OrderBy = &OrderByComponent{}
+	}
+	qb.query.OrderBy.Fields = append(qb.query.OrderBy.Fields, newOrderByField(column, direction))
+	return qb
+}
+
+// resolveSortKeys maps every ORDER BY field to a position in the projected
+// row. Fields that are not part of the select list are returned as hidden
+// columns which the caller appends to each row and strips after sorting.
+func (o *OrderByComponent) resolveSortKeys(headers []string) ([]int, []string) {
+	positions := make([]int, len(o.Fields))
+	var hidden []string
+
+	for i, field := range o.Fields {
+		positions[i] = -1
+		for j, header := range headers {
+			if strings.EqualFold(header, field.Column) {
+				positions[i] = j
+				break
+			}
+		}
+		if positions[i] == -1 {
+			positions[i] = len(headers) + len(hidden)
+			hidden = append(hidden, field.Column)
+		}
+	}
+
+	return positions, hidden
+}
+
+// sortOrder compares rows on their sort keys. Every key is compared either
+// numerically or lexically for all rows, so the order is consistent even
+// when a column mixes numbers and text: a key is numeric only if every
+// non-empty value observed for it parses as a number. Empty values sort
+// before all others.
+type sortOrder struct {
+	positions []int
+	fields    []OrderByField
+	numeric   []bool
+}
+
+func newSortOrder(positions []int, fields []OrderByField) *sortOrder {
+	numeric := make([]bool, len(positions))
+	for i := range numeric {
+		numeric[i] = true
+	}
+	return &sortOrder{positions: positions, fields: fields, numeric: numeric}
+}
+
+// observe records the key values of row. All rows must be observed before
+// any are compared.
+func (s *sortOrder) observe(row []string) {
+	for k, pos := range s.positions {
+		if s.numeric[k] && row[pos] != "" {
+			if _, err := parseNumber(row[pos]); err != nil {
+				s.numeric[k] = false
+			}
+		}
+	}
+}
+
+// sort observes rows and sorts them stably. It returns ctx.Err() once ctx is
+// done, leaving rows in their original order.
+func (s *sortOrder) sort(ctx context.Context, rows [][]string) error {
+	for i, row := range rows {
+		if i%sortChunkRows == 0 {
+			if err := checkContext(ctx); err != nil {
+				return err
+			}
+		}
+		s.observe(row)
+	}
+	order, err := stableOrder(ctx, len(rows), func(i, j int) bool {
+		return s.compare(rows[i], rows[j]) < 0
+	})
+	if err != nil {
+		return err
+	}
+
+	sorted := make([][]string, len(rows))
+	for i, pos := range order {
+		sorted[i] = rows[pos]
+	}
+	copy(rows, sorted)
+	return nil
+}
+
+// sortChunkRows is the number of rows sorted, or merged, between checks for
+// cancellation.
+const sortChunkRows = 4096
+
+// stableOrder returns the positions 0 to n-1 sorted stably by less. Chunks of
+// sortChunkRows positions are sorted one at a time and then merged, so that
+// ctx can be checked while sorting; ctx.Err() is returned once it is done.
+func stableOrder(ctx context.Context, n int, less func(i, j int) bool) ([]int, error) {
+	src := make([]int, n)
+	for i := range src {
+		src[i] = i
+	}
+	for lo := 0; lo < n; lo += sortChunkRows {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		chunk := src[lo:minInt(lo+sortChunkRows, n)]
+		sort.SliceStable(chunk, func(a, b int) bool { return less(chunk[a], chunk[b]) })
+	}
+
+	dst := make([]int, n)
+	for width := sortChunkRows; width < n; width *= 2 {
+		for lo := 0; lo < n; lo += 2 * width {
+			mid, hi := minInt(lo+width, n), minInt(lo+2*width, n)
+			i, j, k := lo, mid, lo
+			for ; i < mid && j < hi; k++ {
+				if k%sortChunkRows == 0 {
+					if err := checkContext(ctx); err != nil {
+						return nil, err
+					}
+				}
+				// Taking the left position on ties keeps the sort stable.
+				if less(src[j], src[i]) {
+					dst[k] = src[j]
+					j++
+				} else {
+					dst[k] = src[i]
+					i++
+				}
+			}
+			k += copy(dst[k:], src[i:mid])
+			copy(dst[k:], src[j:hi])
+		}
+		src, dst = dst, src
+	}
+	return src, nil
+}
+
+func (s *sortOrder) compare(a, b []string) int {
+	for k, pos := range s.positions {
+		cmp := compareValues(a[pos], b[pos], s.numeric[k])
+		if s.fields[k].Direction == Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// compareValues orders two cell values numerically or lexically. In numeric
+// mode both values must be empty or parse as numbers.
+func compareValues(a, b string, numeric bool) int {
+	if !numeric || a == "" || b == "" {
+		return strings.Compare(a, b)
+	}
+	af, _ := parseNumber(a)
+	bf, _ := parseNumber(b)
+	switch {
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// parseNumber parses a numeric sort key. NaN is rejected, as it is not
+// ordered against other numbers.
+func parseNumber(s string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err == nil && math.IsNaN(f) {
+		return 0, fmt.Errorf("NaN is not a sortable number")
+	}
+	return f, err
+}
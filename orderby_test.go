@@ -0,0 +1,95 @@
+package csvsql
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCompoundOrderByAndLimit(t *testing.T) {
+	e := newTestEngine(t)
+	ids := func(table string) *QueryBuilder { return NewQuery().Select("id").From(table) }
+
+	tests := []struct {
+		name  string
+		query *QueryBuilder
+		want  []string
+	}{
+		{"union", ids("u").Union(ids("v")).OrderBy("id", Desc).Limit(2), []string{"5", "4"}},
+		{"union all offset", ids("u").UnionAll(ids("v")).OrderBy("id").Limit(3).Offset(2), []string{"3", "3", "4"}},
+		{"except", ids("u").Except(ids("v")).OrderBy("id", Desc), []string{"2", "1"}},
+		{"qualified column", ids("u").Union(ids("v")).OrderBy("u.id", Desc).Limit(1), []string{"5"}},
+		{"limit without order", ids("v").UnionAll(ids("u")).Limit(4), []string{"3", "4", "5", "1"}},
+		{"operand limit", ids("u").Union(ids("v").OrderBy("id", Desc).Limit(1)), []string{"1", "2", "3", "5"}},
+		{"nested operand", ids("u").UnionAll(ids("v").Union(ids("u")).OrderBy("id", Desc).Limit(2)), []string{"1", "2", "3", "5", "4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertColumn(t, mustQuery(t, e, mustBuild(t, tt.query)), 0, tt.want)
+		})
+	}
+}
+
+func TestCompoundOrderByUnknownColumn(t *testing.T) {
+	e := newTestEngine(t)
+	q := mustBuild(t, NewQuery().Select("id").From("u").
+		Union(NewQuery().Select("id").From("v")).
+		OrderBy("name"))
+	if _, err := e.ExecuteQuery(q); err == nil || !strings.Contains(err.Error(), "ORDER BY column name") {
+		t.Fatalf("ExecuteQuery error = %v, want unknown ORDER BY column", err)
+	}
+}
+
+func TestCompoundExplain(t *testing.T) {
+	e := newTestEngine(t)
+	q := mustBuild(t, NewQuery().Select("id").From("u").
+		Union(NewQuery().Select("id").From("v")).
+		OrderBy("id", Desc).
+		Limit(2))
+	plan, err := e.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := plan.Root
+	if root.Type != LimitNode || root.Children[0].Type != SortNode || root.Children[0].Children[0].Type != UnionNode {
+		t.Errorf("plan = %s, want Limit over Sort over Union", plan)
+	}
+}
+
+func TestOrderByMixedColumnIsConsistent(t *testing.T) {
+	values := []string{"10", "9", "", "b", "100", "a", "2.5", "-1", "B"}
+	e := NewEngine()
+	var rows [][]string
+	for _, v := range values {
+		rows = append(rows, []string{v})
+	}
+
+	// A column holding text is compared as text throughout, which is a
+	// total order whatever order the rows come in.
+	want := append([]string(nil), values...)
+	sort.Strings(want)
+	for i := 0; i < 20; i++ {
+		rand.Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+		name := fmt.Sprintf("t%d", i)
+		if err := e.CreateTableFromRows(name, []string{"v"}, rows); err != nil {
+			t.Fatal(err)
+		}
+		results := mustQuery(t, e, mustBuild(t, NewQuery().Select("v").From(name).OrderBy("v")))
+		assertColumn(t, results, 0, want)
+	}
+}
+
+func TestOrderByNumericColumn(t *testing.T) {
+	e := NewEngine()
+	rows := [][]string{{"10"}, {"9"}, {""}, {"100"}, {"2.5"}, {"-1"}}
+	if err := e.CreateTableFromRows("t", []string{"v"}, rows); err != nil {
+		t.Fatal(err)
+	}
+	results := mustQuery(t, e, mustBuild(t, NewQuery().Select("v").From("t").OrderBy("v")))
+	assertColumn(t, results, 0, []string{"", "-1", "2.5", "9", "10", "100"})
+
+	results = mustQuery(t, e, mustBuild(t, NewQuery().Select("v").From("t").OrderBy("v", Desc).Limit(2)))
+	assertColumn(t, results, 0, []string{"100", "10"})
+}
@@ -0,0 +1,77 @@
+package csvsql
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minPartitionRows is the smallest number of rows worth handing to a worker
+// goroutine; smaller inputs are processed by fewer workers.
+const minPartitionRows = 512
+
+// WithParallelism lets the engine split filtering, join probing and
+// projection across up to workers goroutines and run the operands of set
+// operations concurrently. A value below 1 uses one worker per CPU. Results
+// keep the same order as with a single worker. Custom functions passed to
+// WhereFunc, OnFunc or SelectCustom may then be called concurrently.
+func WithParallelism(workers int) EngineOption {
+	return func(e *Engine) {
+		if workers < 1 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		e.config.parallelism = workers
+	}
+}
+
+// partition is a contiguous range of rows handled by one worker.
+type partition struct {
+	lo, hi int
+}
+
+// partitions splits n rows into contiguous ranges, one per worker. Without
+// parallelism there is a single range covering all rows.
+func (e *Engine) partitions(n int) []partition {
+	workers := e.config.parallelism
+	if limit := n / minPartitionRows; workers > limit {
+		workers = limit
+	}
+	if workers <= 1 {
+		return []partition{{0, n}}
+	}
+
+	parts := make([]partition, workers)
+	size := (n + workers - 1) / workers
+	for i := range parts {
+		lo := minInt(i*size, n)
+		parts[i] = partition{lo, minInt(lo+size, n)}
+	}
+	return parts
+}
+
+// runPartitions calls fn for every partition, concurrently when there are
+// several. Callers store results per partition index and concatenate them in
+// order, which keeps the output order independent of scheduling. The error of
+// the first failing partition is returned, so errors are deterministic too.
+func runPartitions(parts []partition, fn func(i int, part partition) error) error {
+	if len(parts) == 1 {
+		return fn(0, parts[0])
+	}
+
+	errs := make([]error, len(parts))
+	var wg sync.WaitGroup
+	for i, part := range parts {
+		wg.Add(1)
+		go func(i int, part partition) {
+			defer wg.Done()
+			errs[i] = fn(i, part)
+		}(i, part)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package csvsql
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestParallelMatchesSequential runs queries with and without parallelism,
+// which must not change their results or their order. Run it with -race.
+func TestParallelMatchesSequential(t *testing.T) {
+	const n = 4 * minPartitionRows
+	rows := make([][]string, n)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i), strconv.Itoa(i % 7), strconv.Itoa(i % 13)}
+	}
+	engines := []*Engine{NewEngine(), NewEngine(WithParallelism(8))}
+	for _, e := range engines {
+		if err := e.CreateTableFromRows("a", []string{"id", "x", "y"}, rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.CreateTableFromRows("b", []string{"id", "x", "y"}, rows[:n/2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queries := []*QueryBuilder{
+		NewQuery().Select("a.id", "a.x").From("a").Where("a.y", "=", "3"),
+		NewQuery().Select("a.id", "b.id").From("a").
+			InnerJoin("b").On("a", "x", "=", "b", "y").
+			Where("b.id", "<", "2"),
+		NewQuery().Select("a.id", "b.id").From("a").
+			LeftJoin("b").On("a", "id", "=", "b", "x"),
+		NewQuery().Select("a.id").From("a").
+			WhereFunc(func(row map[string][]string, tables map[string]*Table) (bool, error) {
+				return row["a"][1] == row["a"][2], nil
+			}).
+			SelectCustom("sum", func(row map[string][]string, tables map[string]*Table) (string, error) {
+				x, _ := strconv.Atoi(row["a"][1])
+				y, _ := strconv.Atoi(row["a"][2])
+				return strconv.Itoa(x + y), nil
+			}),
+		NewQuery().Select("a.x").From("a").
+			Except(NewQuery().Select("b.y").From("b").Where("b.y", ">", "3")).
+			Union(NewQuery().Select("a.y").From("a").Intersect(NewQuery().Select("b.x").From("b"))),
+	}
+	for i, qb := range queries {
+		q := mustBuild(t, qb)
+		want := mustQuery(t, engines[0], q)
+		if got := mustQuery(t, engines[1], q); !reflect.DeepEqual(got, want) {
+			t.Errorf("query %d: parallel results differ from sequential ones", i)
+		}
+	}
+}
+
+func TestParallelSetOperandFailureCancelsOther(t *testing.T) {
+	const n = 2000
+	e := newLargeTestEngine(t, n, WithParallelism(4))
+	errLeft := errors.New("left operand failed")
+	leftFailed := make(chan struct{})
+	var once sync.Once
+
+	left := NewQuery().Select("id").From("t").
+		WhereFunc(func(row map[string][]string, tables map[string]*Table) (bool, error) {
+			once.Do(func() { close(leftFailed) })
+			return false, errLeft
+		})
+	var calls int32
+	right := NewQuery().Select("id").From("t").
+		WhereFunc(func(row map[string][]string, tables map[string]*Table) (bool, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-leftFailed
+				time.Sleep(20 * time.Millisecond)
+			}
+			return true, nil
+		})
+
+	_, err := e.ExecuteQuery(mustBuild(t, left.Union(right)))
+	if !errors.Is(err, errLeft) {
+		t.Fatalf("ExecuteQuery error = %v, want the left operand's error", err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls >= n {
+		t.Errorf("right operand filtered all %d rows after the left one failed", calls)
+	}
+}
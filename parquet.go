@@ -0,0 +1,480 @@
+package csvsql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
+)
+
+// parquetSource reads the rows of a Parquet file one row group at a time,
+// decoding only the column chunks of the columns a query reads. Of every row
+// group only the rows the query keeps are held on to, and the file is read
+// again by the next query, as nothing is cached in between.
+type parquetSource struct {
+	open    func() (source.ParquetFile, error)
+	rows    int
+	columns []parquetColumn
+}
+
+// parquetColumn is a leaf of the Parquet schema, which becomes one column.
+// typ is the type of its values; a repeated column holds lists of them.
+type parquetColumn struct {
+	path     string
+	element  *parquet.SchemaElement
+	typ      ColumnType
+	maxDef   int32
+	repeated bool
+}
+
+// NewTableFromParquet loads all rows of a Parquet file. Nested fields become
+// dotted column names such as address.city and lists are kept as JSON text.
+// Tables created by Engine.CreateTable instead read the file for every query,
+// and then only the columns the query uses.
+func NewTableFromParquet(name, filepath string) (*Table, error) {
+	table, err := newParquetTable(name, filepath)
+	if err != nil {
+		return nil, err
+	}
+	return table.withRows(context.Background(), nil, nil)
+}
+
+// newParquetTable returns a table with the schema of a Parquet file whose
+// rows are read from the file by every query.
+func newParquetTable(name, filepath string) (*Table, error) {
+	check, compressed, err := openDecompressed(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("open parquet file error: %w", err)
+	}
+	check.Close()
+	if compressed {
+		return nil, fmt.Errorf("compressed parquet files are not supported, as parquet compresses column chunks itself")
+	}
+
+	return newParquetSourceTable(name, func() (source.ParquetFile, error) {
+		return openParquetFile(filepath)
+	})
+}
+
+// newParquetTableFromReader returns a table with the schema of the Parquet
+// data read from r, which is held in memory for the queries to read.
+func newParquetTableFromReader(name string, r io.Reader) (*Table, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read parquet data error: %w", err)
+	}
+	return newParquetSourceTable(name, func() (source.ParquetFile, error) {
+		return &parquetBuffer{Reader: bytes.NewReader(data), data: data}, nil
+	})
+}
+
+func newParquetSourceTable(name string, open func() (source.ParquetFile, error)) (*Table, error) {
+	file, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("open parquet file error: %w", err)
+	}
+	defer file.Close()
+
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		return nil, fmt.Errorf("read parquet footer error: %w", err)
+	}
+	defer pr.ReadStop()
+
+	src := &parquetSource{open: open, rows: int(pr.GetNumRows())}
+	sh := pr.SchemaHandler
+
+	var headers []string
+	seen := make(map[string]int)
+	for _, inPath := range sh.ValueColumns {
+		path := common.StrToPath(inPath)
+		exPath := common.StrToPath(sh.InPathToExPath[inPath])[1:]
+
+		column := parquetColumn{path: inPath, element: sh.SchemaElements[sh.MapIndex[inPath]]}
+		if column.maxDef, err = sh.MaxDefinitionLevel(path); err != nil {
+			return nil, fmt.Errorf("read parquet schema error: %w", err)
+		}
+		maxRep, err := sh.MaxRepetitionLevel(path)
+		if err != nil {
+			return nil, fmt.Errorf("read parquet schema error: %w", err)
+		}
+		column.repeated = maxRep > 0
+		column.typ = parquetColumnType(column.element)
+
+		// A list is named after the field holding it rather than after the
+		// repeated group and element inside it.
+		for i := 2; i < len(path); i++ {
+			group := sh.SchemaElements[sh.MapIndex[common.PathToStr(path[:i])]]
+			if isParquetList(group) {
+				exPath = exPath[:i-1]
+				break
+			}
+		}
+		header := strings.Join(exPath, ".")
+		seen[header]++
+		if n := seen[header]; n > 1 {
+			header = fmt.Sprintf("%s_%d", header, n)
+		}
+
+		headers = append(headers, header)
+		src.columns = append(src.columns, column)
+	}
+
+	headerMap := make(map[string]int)
+	types := make([]ColumnType, len(headers))
+	for i, header := range headers {
+		headerMap[strings.ToLower(header)] = i
+		if !src.columns[i].repeated {
+			types[i] = src.columns[i].typ
+		}
+	}
+
+	return &Table{
+		Name:      name,
+		Headers:   headers,
+		HeaderMap: headerMap,
+		Types:     types,
+		source:    src,
+	}, nil
+}
+
+func (s *parquetSource) rowCount() int {
+	return s.rows
+}
+
+func (s *parquetSource) load(ctx context.Context, columns []int, keep func(row []string) bool) ([][]string, error) {
+	if columns == nil {
+		columns = make([]int, len(s.columns))
+		for i := range columns {
+			columns[i] = i
+		}
+	}
+
+	file, err := s.open()
+	if err != nil {
+		return nil, fmt.Errorf("open parquet file error: %w", err)
+	}
+	defer file.Close()
+
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		return nil, fmt.Errorf("read parquet footer error: %w", err)
+	}
+	defer pr.ReadStop()
+
+	if err := s.checkSchema(pr); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	if keep == nil {
+		rows = make([][]string, 0, s.rows)
+	}
+	for _, group := range pr.Footer.RowGroups {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
+		n := int(group.NumRows)
+		cells := make([]string, n*len(s.columns))
+		groupRows := make([][]string, n)
+		for i := range groupRows {
+			groupRows[i] = cells[i*len(s.columns) : (i+1)*len(s.columns) : (i+1)*len(s.columns)]
+		}
+
+		for _, col := range columns {
+			column := s.columns[col]
+			values, rls, dls, err := pr.ReadColumnByPath(column.path, int64(n))
+			if err != nil {
+				return nil, fmt.Errorf("read parquet column %s error: %w", column.path, err)
+			}
+			if err := column.fill(groupRows, col, values, rls, dls); err != nil {
+				return nil, err
+			}
+		}
+
+		if keep == nil {
+			rows = append(rows, groupRows...)
+			continue
+		}
+		// Kept rows are copied out of the row group, so that the cells of
+		// the rows dropped are released with it.
+		for _, row := range groupRows {
+			if keep(row) {
+				rows = append(rows, append([]string(nil), row...))
+			}
+		}
+	}
+	return rows, nil
+}
+
+// checkSchema fails when the file read by pr no longer has the rows and
+// columns it had when the table was created, which the table's schema and
+// the row ids of its indexes rely on.
+func (s *parquetSource) checkSchema(pr *reader.ParquetReader) error {
+	if rows := int(pr.GetNumRows()); rows != s.rows {
+		return fmt.Errorf("parquet file has %d rows, but had %d when the table was created", rows, s.rows)
+	}
+	paths := pr.SchemaHandler.ValueColumns
+	changed := len(paths) != len(s.columns)
+	for i := 0; !changed && i < len(paths); i++ {
+		changed = paths[i] != s.columns[i].path
+	}
+	if changed {
+		return fmt.Errorf("the columns of the parquet file changed after the table was created")
+	}
+	return nil
+}
+
+// fill stores the values read from one row group of the column in rows.
+func (c *parquetColumn) fill(rows [][]string, col int, values []interface{}, rls, dls []int32) error {
+	if !c.repeated {
+		if len(values) != len(rows) {
+			return fmt.Errorf("parquet column %s has %d values for %d rows", c.path, len(values), len(rows))
+		}
+		for i, value := range values {
+			if value != nil && dls[i] == c.maxDef {
+				rows[i][col] = c.format(value)
+			}
+		}
+		return nil
+	}
+
+	// Values of a repeated column start a new row at repetition level 0.
+	row := -1
+	var list []interface{}
+	defined := false
+	flush := func() error {
+		if row < 0 {
+			return nil
+		}
+		if row >= len(rows) {
+			return fmt.Errorf("parquet column %s has more rows than its row group", c.path)
+		}
+		if defined {
+			text, err := json.Marshal(list)
+			if err != nil {
+				return err
+			}
+			rows[row][col] = string(text)
+		}
+		return nil
+	}
+	for i, value := range values {
+		if rls[i] == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			row, list, defined = row+1, []interface{}{}, dls[i] > 0
+		}
+		if value != nil && dls[i] == c.maxDef {
+			list = append(list, c.jsonValue(value))
+		}
+	}
+	return flush()
+}
+
+func (c *parquetColumn) jsonValue(value interface{}) interface{} {
+	switch c.typ {
+	case IntegerColumn, FloatColumn:
+		return json.Number(c.format(value))
+	case BooleanColumn:
+		return value
+	default:
+		return c.format(value)
+	}
+}
+
+// parquetColumnType maps the physical and logical type of a Parquet column
+// to a column type.
+func parquetColumnType(element *parquet.SchemaElement) ColumnType {
+	logical := element.GetLogicalType()
+	switch {
+	case logical != nil && logical.IsSetDATE(), element.GetConvertedType() == parquet.ConvertedType_DATE:
+		return DateColumn
+	case logical != nil && logical.IsSetTIMESTAMP(),
+		element.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MILLIS,
+		element.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MICROS,
+		element.GetType() == parquet.Type_INT96:
+		return DateTimeColumn
+	case logical != nil && logical.IsSetDECIMAL(), element.GetConvertedType() == parquet.ConvertedType_DECIMAL:
+		return FloatColumn
+	case logical != nil && logical.IsSetTIME(),
+		element.GetConvertedType() == parquet.ConvertedType_TIME_MILLIS,
+		element.GetConvertedType() == parquet.ConvertedType_TIME_MICROS:
+		return StringColumn
+	}
+
+	switch element.GetType() {
+	case parquet.Type_BOOLEAN:
+		return BooleanColumn
+	case parquet.Type_INT32, parquet.Type_INT64:
+		return IntegerColumn
+	case parquet.Type_FLOAT, parquet.Type_DOUBLE:
+		return FloatColumn
+	default:
+		return StringColumn
+	}
+}
+
+// format converts a value read from the column to its cell value.
+func (c *parquetColumn) format(value interface{}) string {
+	element := c.element
+	logical := element.GetLogicalType()
+	converted := element.GetConvertedType()
+
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int32:
+		switch {
+		case c.typ == DateColumn:
+			return time.Unix(int64(v)*86400, 0).UTC().Format(DateFormat)
+		case c.typ == FloatColumn:
+			return formatDecimal(big.NewInt(int64(v)), int(element.GetScale()))
+		case (logical != nil && logical.IsSetTIME()) || converted == parquet.ConvertedType_TIME_MILLIS:
+			return formatTimeOfDay(time.Duration(v) * time.Millisecond)
+		case converted == parquet.ConvertedType_UINT_32 || (logical != nil && logical.IsSetINTEGER() && !logical.INTEGER.IsSigned):
+			return strconv.FormatUint(uint64(uint32(v)), 10)
+		}
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		switch {
+		case c.typ == DateTimeColumn:
+			return parquetTimestamp(element, v).Format(DateTimeFormat)
+		case c.typ == FloatColumn:
+			return formatDecimal(big.NewInt(v), int(element.GetScale()))
+		case c.typ == StringColumn:
+			unit := time.Microsecond
+			if logical != nil && logical.IsSetTIME() && logical.TIME.Unit.IsSetNANOS() {
+				unit = time.Nanosecond
+			}
+			return formatTimeOfDay(time.Duration(v) * unit)
+		case converted == parquet.ConvertedType_UINT_64 || (logical != nil && logical.IsSetINTEGER() && !logical.INTEGER.IsSigned):
+			return strconv.FormatUint(uint64(v), 10)
+		}
+		return strconv.FormatInt(v, 10)
+	case string:
+		switch {
+		case element.GetType() == parquet.Type_INT96:
+			return types.INT96ToTime(v).UTC().Format(DateTimeFormat)
+		case c.typ == FloatColumn:
+			return formatDecimal(decimalFromBytes([]byte(v)), int(element.GetScale()))
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatDecimal formats the unscaled value of a decimal with scale digits
+// after the decimal point.
+func formatDecimal(unscaled *big.Int, scale int) string {
+	digits := new(big.Int).Abs(unscaled).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// decimalFromBytes decodes the big-endian two's complement unscaled value of
+// a decimal stored in a byte array.
+func decimalFromBytes(b []byte) *big.Int {
+	value := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		value.Sub(value, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return value
+}
+
+func parquetTimestamp(element *parquet.SchemaElement, v int64) time.Time {
+	logical := element.GetLogicalType()
+	switch {
+	case logical != nil && logical.IsSetTIMESTAMP() && logical.TIMESTAMP.Unit.IsSetNANOS():
+		return time.Unix(0, v).UTC()
+	case (logical != nil && logical.IsSetTIMESTAMP() && logical.TIMESTAMP.Unit.IsSetMICROS()) ||
+		element.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MICROS:
+		return time.UnixMicro(v).UTC()
+	default:
+		return time.UnixMilli(v).UTC()
+	}
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	return time.Unix(0, 0).UTC().Add(d).Format("15:04:05.999999999")
+}
+
+func isParquetList(element *parquet.SchemaElement) bool {
+	logical := element.GetLogicalType()
+	return element.GetConvertedType() == parquet.ConvertedType_LIST || (logical != nil && logical.IsSetLIST())
+}
+
+// parquetFile adapts a local file to the source.ParquetFile interface of the
+// Parquet reader, which opens the file again for every column it reads.
+type parquetFile struct {
+	*os.File
+	path string
+}
+
+func openParquetFile(path string) (*parquetFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetFile{File: file, path: path}, nil
+}
+
+func (f *parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.path
+	}
+	return openParquetFile(name)
+}
+
+func (f *parquetFile) Create(name string) (source.ParquetFile, error) {
+	return nil, fmt.Errorf("parquet files are read-only")
+}
+
+// parquetBuffer is a source.ParquetFile over Parquet data held in memory.
+type parquetBuffer struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (b *parquetBuffer) Open(name string) (source.ParquetFile, error) {
+	return &parquetBuffer{Reader: bytes.NewReader(b.data), data: b.data}, nil
+}
+
+func (b *parquetBuffer) Create(name string) (source.ParquetFile, error) {
+	return nil, fmt.Errorf("parquet files are read-only")
+}
+
+func (b *parquetBuffer) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("parquet files are read-only")
+}
+
+func (b *parquetBuffer) Close() error {
+	return nil
+}
@@ -0,0 +1,259 @@
+package csvsql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type parquetTestRow struct {
+	ID    int64   `parquet:"name=id, type=INT64"`
+	Name  string  `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Score float64 `parquet:"name=score, type=DOUBLE"`
+}
+
+// writeParquetTestFile writes n rows to a Parquet file split into several
+// row groups and returns its path.
+func writeParquetTestFile(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scores.parquet")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := writer.NewParquetWriter(&parquetFile{File: file, path: path}, new(parquetTestRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		row := parquetTestRow{ID: int64(i), Name: "n" + strconv.Itoa(i%7), Score: float64(i) / 2}
+		if err := pw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+		if (i+1)%100 == 0 {
+			if err := pw.Flush(true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParquetTable(t *testing.T) {
+	const n = 500
+	path := writeParquetTestFile(t, n)
+	e := NewEngine()
+	if err := e.CreateTable("scores", path); err != nil {
+		t.Fatal(err)
+	}
+
+	table := e.tables["scores"]
+	if table.Rows != nil || table.numRows() != n {
+		t.Fatalf("table holds %d rows and reports %d, want 0 and %d", len(table.Rows), table.numRows(), n)
+	}
+	types := []ColumnType{IntegerColumn, StringColumn, FloatColumn}
+	if !reflect.DeepEqual(table.Types, types) {
+		t.Errorf("types = %v, want %v", table.Types, types)
+	}
+	src := table.source.(*parquetSource)
+	file, err := src.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := len(pr.Footer.RowGroups); groups < 2 {
+		t.Fatalf("file has %d row groups, want several", groups)
+	}
+	pr.ReadStop()
+	file.Close()
+
+	q := mustBuild(t, NewQuery().Select("id", "score").From("scores").Where("name", "=", "n3").Limit(3))
+	want := [][]string{{"id", "score"}, {"3", "1.5"}, {"10", "5"}, {"17", "8.5"}}
+	if got := mustQuery(t, e, q); !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %q, want %q", got, want)
+	}
+
+	// Only the given columns are decoded, across all row groups.
+	rows, err := src.load(context.Background(), []int{0}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != n || rows[n-1][0] != strconv.Itoa(n-1) || rows[n-1][1] != "" || rows[n-1][2] != "" {
+		t.Errorf("loaded %d rows, the last %q", len(rows), rows[len(rows)-1])
+	}
+
+	// The table stays unloaded after queries and after indexing.
+	if err := e.CreateIndex("scores", "name"); err != nil {
+		t.Fatal(err)
+	}
+	if table.Rows != nil {
+		t.Error("table rows were loaded into the registered table")
+	}
+	if got := e.indexes["scores"][1].values; len(got) != n || got[3] != "n3" {
+		t.Errorf("index holds %d values", len(got))
+	}
+	if got := mustQuery(t, e, q); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexed results = %q, want %q", got, want)
+	}
+}
+
+func TestParquetKeepsMatchingRows(t *testing.T) {
+	const n = 500
+	e := NewEngine()
+	if err := e.CreateTable("scores", writeParquetTestFile(t, n)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows are filtered as every row group is read, and the kept rows do
+	// not hold on to the cells of their row group.
+	src := e.tables["scores"].source.(*parquetSource)
+	rows, err := src.load(context.Background(), []int{1}, func(row []string) bool { return row[1] == "n3" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 71 || rows[70][1] != "n3" || cap(rows[70]) != 3 {
+		t.Errorf("kept %d rows, the last %q with capacity %d", len(rows), rows[len(rows)-1], cap(rows[len(rows)-1]))
+	}
+
+	q := mustBuild(t, NewQuery().Select("id").From("scores").Where("name", "=", "n3").And(NewQuery().Where("id", "LIKE", "4%")))
+	s := e.snapshot()
+	if err := s.loadSources(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.tables["scores"].Rows); got != 15 {
+		t.Errorf("query loaded %d rows, want the 15 matching", got)
+	}
+	results := mustQuery(t, e, q)
+	if len(results) != 1+15 || results[1][0] != "45" || results[2][0] != "402" {
+		t.Errorf("results = %q", results)
+	}
+
+	// A table read twice by a statement is loaded whole for both reads.
+	union := mustBuild(t, NewQuery().Select("id").From("scores").Where("id", "=", "3").
+		Union(NewQuery().Select("id").From("scores").Where("id", "=", "4")))
+	assertColumn(t, mustQuery(t, e, union), 0, []string{"3", "4"})
+
+	// Row ids of indexes refer to all rows, so indexed tables are loaded
+	// whole.
+	if err := e.CreateIndex("scores", "id"); err != nil {
+		t.Fatal(err)
+	}
+	s = e.snapshot()
+	if err := s.loadSources(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.tables["scores"].Rows); got != n {
+		t.Errorf("indexed query loaded %d rows, want %d", got, n)
+	}
+}
+
+func TestParquetFileChanged(t *testing.T) {
+	path := writeParquetTestFile(t, 500)
+	e := NewEngine()
+	if err := e.CreateTable("scores", path); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateIndex("scores", "id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(writeParquetTestFile(t, 300), path); err != nil {
+		t.Fatal(err)
+	}
+
+	q := mustBuild(t, NewQuery().Select("name").From("scores").Where("id", "=", "400"))
+	if _, err := e.ExecuteQuery(q); err == nil {
+		t.Error("query of a file that lost rows succeeded")
+	}
+}
+
+type parquetTypesAddress struct {
+	City string `parquet:"name=city, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Zip  int32  `parquet:"name=zip, type=INT32"`
+}
+
+type parquetTypesRow struct {
+	Day     int32               `parquet:"name=day, type=INT32, convertedtype=DATE"`
+	AtMs    int64               `parquet:"name=at_ms, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	AtUs    int64               `parquet:"name=at_us, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Price   int32               `parquet:"name=price, type=INT32, convertedtype=DECIMAL, scale=2, precision=9"`
+	Big     string              `parquet:"name=big, type=BYTE_ARRAY, convertedtype=DECIMAL, scale=3, precision=20"`
+	OK      bool                `parquet:"name=ok, type=BOOLEAN"`
+	Address parquetTypesAddress `parquet:"name=address"`
+	Tags    []string            `parquet:"name=tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Note    *string             `parquet:"name=note, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+func TestParquetColumnTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "types.parquet")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := writer.NewParquetWriter(&parquetFile{File: file, path: path}, new(parquetTypesRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := "late"
+	rows := []parquetTypesRow{
+		{
+			Day: 19797, AtMs: 1710505800000, AtUs: 1710505800123456, Price: 12345,
+			Big: string([]byte{0xED, 0x29, 0x79}), OK: true,
+			Address: parquetTypesAddress{City: "Paris", Zip: 75001}, Tags: []string{"a", "b"}, Note: &note,
+		},
+		{Day: 0, Price: -5, Big: string([]byte{0x01}), Address: parquetTypesAddress{City: "Oslo"}},
+	}
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEngine()
+	if err := e.CreateTable("t", path); err != nil {
+		t.Fatal(err)
+	}
+	table := e.tables["t"]
+	headers := []string{"day", "at_ms", "at_us", "price", "big", "ok", "address.city", "address.zip", "tags", "note"}
+	if !reflect.DeepEqual(table.Headers, headers) {
+		t.Errorf("headers = %q, want %q", table.Headers, headers)
+	}
+	// Lists are kept as JSON text.
+	types := []ColumnType{DateColumn, DateTimeColumn, DateTimeColumn, FloatColumn, FloatColumn, BooleanColumn,
+		StringColumn, IntegerColumn, StringColumn, StringColumn}
+	if !reflect.DeepEqual(table.Types, types) {
+		t.Errorf("types = %v, want %v", table.Types, types)
+	}
+
+	// The nil list of the second row is written as a null list, which is
+	// empty.
+	results := mustQuery(t, e, mustBuild(t, NewQuery().Select(headers...).From("t")))
+	want := [][]string{
+		headers,
+		{"2024-03-15", "2024-03-15 12:30:00", "2024-03-15 12:30:00", "123.45", "-1234.567", "true", "Paris", "75001", `["a","b"]`, "late"},
+		{"1970-01-01", "1970-01-01 00:00:00", "1970-01-01 00:00:00", "-0.05", "0.001", "false", "Oslo", "0", "", ""},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %q, want %q", results, want)
+	}
+}
@@ -0,0 +1,475 @@
+package csvsql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type joinMethod int
+
+const (
+	nestedLoopJoin joinMethod = iota
+	hashJoin
+)
+
+// joinStep is one join of a query plan. previous lists the tables already
+// present in the joined rows when the step runs, starting with the FROM table,
+// and positions their places in the query. position is the place of the
+// joined table, where the FROM table is 0, and width the number of tables in
+// the query.
+type joinStep struct {
+	join      *JoinComponent
+	position  int
+	width     int
+	table     *Table
+	access    *accessPath
+	previous  []string
+	positions []int
+	method    joinMethod
+	probe     *joinProbe
+	node      *PlanNode
+	scan      *PlanNode
+}
+
+// queryPlan holds every decision needed to run a single query, and the plan
+// nodes describing it. The executor follows the plan and, under
+// ExplainAnalyze, records actual row counts and timings per node in a
+// planStats kept apart from the plan. reordered is set when joins run in a
+// different order than written, and referenced lists the columns read per
+// table.
+type queryPlan struct {
+	query      *Query
+	access     map[string]*accessPath
+	residual   Condition
+	joins      []*joinStep
+	reordered  bool
+	referenced map[string][]string
+	expanded   []string
+	columns    []string
+	scan       *PlanNode
+	filter     *PlanNode
+	window     *PlanNode
+	project    *PlanNode
+	sort       *PlanNode
+	limit      *PlanNode
+	root       *PlanNode
+}
+
+// statementPlan is a query together with its set operations. baseLeaf is the
+// leaf of the set operation tree that receives the base query results. The
+// ORDER BY and LIMIT of a query with set operations apply to the combined
+// result, which is sorted on the result columns at sortPositions.
+type statementPlan struct {
+	base          *queryPlan
+	set           *setOperationNode
+	baseLeaf      *setOperationNode
+	orderBy       *OrderByComponent
+	sortPositions []int
+	limit         *LimitComponent
+	sortNode      *PlanNode
+	limitNode     *PlanNode
+	root          *PlanNode
+}
+
+func (e *Engine) planStatement(q *Query) (*statementPlan, error) {
+	baseQuery := q
+	if q.Union != nil && (q.OrderBy != nil || q.Limit != nil) {
+		operand := *q
+		operand.OrderBy, operand.Limit = nil, nil
+		baseQuery = &operand
+	}
+	base, err := e.planQuery(baseQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &statementPlan{base: base, root: base.root}
+	if q.Union == nil {
+		return stmt, nil
+	}
+
+	stmt.baseLeaf = &setOperationNode{node: base.root}
+	operations := q.Union.operations()
+	operands := make([]*setOperationNode, len(operations))
+	for i, op := range operations {
+		operand, err := e.planStatement(op.Query)
+		if err != nil {
+			return nil, fmt.Errorf("%s query execution failed: %w", op.Kind, err)
+		}
+		operands[i] = &setOperationNode{stmt: operand, node: operand.root}
+	}
+
+	stmt.set = q.Union.buildTree(stmt.baseLeaf, operands)
+	planSetNodes(stmt.set)
+	stmt.root = stmt.set.node
+
+	if q.OrderBy != nil {
+		positions, err := e.resolveSetSortKeys(q.OrderBy, base.columns)
+		if err != nil {
+			return nil, err
+		}
+		stmt.orderBy, stmt.sortPositions = q.OrderBy, positions
+		stmt.sortNode = sortNode(q.OrderBy, stmt.root)
+		stmt.root = stmt.sortNode
+	}
+	if q.Limit != nil {
+		stmt.limit = q.Limit
+		stmt.limitNode = limitNode(q.Limit, stmt.root)
+		stmt.root = stmt.limitNode
+	}
+	return stmt, nil
+}
+
+// resolveSetSortKeys maps the ORDER BY fields of a query with set operations
+// to positions in the combined result, whose headers are those of the base
+// query without table prefixes. Unlike the ORDER BY of a single query, it
+// cannot sort on columns that are not selected.
+func (e *Engine) resolveSetSortKeys(orderBy *OrderByComponent, columns []string) ([]int, error) {
+	headers := e.stripTablePrefixes(columns)
+	positions := make([]int, len(orderBy.Fields))
+	for i, field := range orderBy.Fields {
+		positions[i] = -1
+		_, column := splitColumn(field.Column, e.tables)
+		for j, header := range headers {
+			if strings.EqualFold(header, column) {
+				positions[i] = j
+				break
+			}
+		}
+		if positions[i] == -1 {
+			return nil, fmt.Errorf("ORDER BY column %s is not a column of the set operation result", field.Column)
+		}
+	}
+	return positions, nil
+}
+
+func planSetNodes(n *setOperationNode) {
+	if n.left == nil {
+		return
+	}
+	planSetNodes(n.left)
+	planSetNodes(n.right)
+
+	left, right := n.left.node.EstimatedRows, n.right.node.EstimatedRows
+	estimate := left + right
+	switch n.kind {
+	case Intersect, IntersectAll:
+		estimate = minInt(left, right)
+	case Except, ExceptAll:
+		estimate = left
+	}
+
+	n.node = &PlanNode{
+		Type:          UnionNode,
+		Detail:        string(n.kind),
+		EstimatedRows: estimate,
+		Children:      []*PlanNode{n.left.node, n.right.node},
+	}
+}
+
+func (e *Engine) planQuery(q *Query) (*queryPlan, error) {
+	if err := e.validateQuery(q); err != nil {
+		return nil, err
+	}
+	if q.Select == nil {
+		// The default selection goes into a copy, as the query may be
+		// executed by other goroutines at the same time.
+		selectAll := *q
+		selectAll.Select = &SelectComponent{Columns: e.tables[q.From.Table].Headers}
+		q = &selectAll
+	}
+
+	p := &queryPlan{query: q}
+	access, residual := e.planIndexAccess(q)
+	p.access, p.residual = access, residual
+	if !e.config.noOptimize {
+		p.residual = e.pushDownPredicates(q, access, residual)
+	}
+	p.referenced = e.referencedColumns(q)
+
+	mainTable := e.tables[q.From.Table]
+	p.scan = scanNode(mainTable, p.access[q.From.Table], p.referenced[q.From.Table])
+	current := p.scan
+
+	previous, positions := []string{q.From.Table}, []int{0}
+	order := make([]int, len(q.Joins))
+	for i := range order {
+		order[i] = i
+	}
+	if !e.config.noOptimize {
+		order = e.orderJoins(q, p.access)
+	}
+	for i, position := range order {
+		join := q.Joins[position]
+		joinedTable, ok := e.tables[join.Table]
+		if !ok {
+			return nil, fmt.Errorf("join table %s not found", join.Table)
+		}
+		if position != i {
+			p.reordered = true
+		}
+
+		step := &joinStep{
+			join:      join,
+			position:  position + 1,
+			width:     len(q.Joins) + 1,
+			table:     joinedTable,
+			access:    p.access[join.Table],
+			previous:  previous,
+			positions: positions,
+			probe:     e.planJoinProbe(join),
+			scan:      scanNode(joinedTable, p.access[join.Table], p.referenced[join.Table]),
+		}
+		switch {
+		case step.probe == nil:
+		case step.probe.op == Equal:
+			step.method = hashJoin
+		case step.probe.index == nil:
+			// Only indexes answer range lookups; without one the
+			// condition is evaluated for every pair of rows.
+			step.probe = nil
+		}
+
+		step.node = &PlanNode{
+			Type:          NestedLoopJoinNode,
+			Detail:        describeJoin(step),
+			EstimatedRows: estimateJoinRows(step, current.EstimatedRows, step.scan.EstimatedRows),
+			Children:      []*PlanNode{current, step.scan},
+		}
+		if step.method == hashJoin {
+			step.node.Type = HashJoinNode
+		}
+
+		p.joins = append(p.joins, step)
+		current = step.node
+		previous = append(append([]string(nil), previous...), join.Table)
+		positions = append(append([]int(nil), positions...), position+1)
+	}
+
+	if p.residual != nil {
+		p.filter = &PlanNode{
+			Type:          FilterNode,
+			Detail:        describeCondition(p.residual),
+			EstimatedRows: int(float64(current.EstimatedRows) * estimateSelectivity(p.residual)),
+			Children:      []*PlanNode{current},
+		}
+		current = p.filter
+	}
+
+	if len(q.Select.WindowColumns) > 0 {
+		var windows []string
+		for _, wc := range q.Select.WindowColumns {
+			windows = append(windows, wc.Name+" = "+wc.Window.String())
+		}
+		p.window = &PlanNode{
+			Type:          WindowNode,
+			Detail:        strings.Join(windows, ", "),
+			EstimatedRows: current.EstimatedRows,
+			Children:      []*PlanNode{current},
+		}
+		current = p.window
+	}
+
+	expanded, columns, err := e.outputColumns(q)
+	if err != nil {
+		return nil, err
+	}
+	p.expanded, p.columns = expanded, columns
+	p.project = &PlanNode{
+		Type:          ProjectNode,
+		Detail:        strings.Join(columns, ", "),
+		EstimatedRows: current.EstimatedRows,
+		Children:      []*PlanNode{current},
+	}
+	current = p.project
+
+	if q.OrderBy != nil {
+		p.sort = sortNode(q.OrderBy, current)
+		current = p.sort
+	}
+
+	if q.Limit != nil {
+		p.limit = limitNode(q.Limit, current)
+		current = p.limit
+	}
+
+	p.root = current
+	return p, nil
+}
+
+func sortNode(orderBy *OrderByComponent, child *PlanNode) *PlanNode {
+	var fields []string
+	for _, field := range orderBy.Fields {
+		fields = append(fields, field.Column+" "+string(field.Direction))
+	}
+	return &PlanNode{
+		Type:          SortNode,
+		Detail:        strings.Join(fields, ", "),
+		EstimatedRows: child.EstimatedRows,
+		Children:      []*PlanNode{child},
+	}
+}
+
+func limitNode(limit *LimitComponent, child *PlanNode) *PlanNode {
+	estimate := child.EstimatedRows - limit.Offset
+	if limit.Count >= 0 {
+		estimate = minInt(estimate, limit.Count)
+	}
+	return &PlanNode{
+		Type:          LimitNode,
+		Detail:        fmt.Sprintf("count=%d offset=%d", limit.Count, limit.Offset),
+		EstimatedRows: maxInt(estimate, 0),
+		Children:      []*PlanNode{child},
+	}
+}
+
+// scanNode describes the scan of a table: the indexes used, the pushed down
+// filters and, when not every column is needed, the columns read.
+func scanNode(table *Table, path *accessPath, columns []string) *PlanNode {
+	node := &PlanNode{
+		Type:          ScanNode,
+		Detail:        table.Name,
+		EstimatedRows: estimateScanRows(table, path),
+	}
+
+	if path != nil && len(path.scans) > 0 {
+		var uses []string
+		for _, scan := range path.scans {
+			uses = append(uses, fmt.Sprintf("index %s for %s", scan.index, describeCondition(scan.condition)))
+		}
+		node.Type = IndexScanNode
+		node.Detail += " using " + strings.Join(uses, ", ")
+	}
+	if path != nil && len(path.filters) > 0 {
+		node.Detail += " filter " + describeCondition(joinConjuncts(path.filters))
+	}
+	if columns != nil && len(columns) < len(table.Headers) {
+		node.Detail += " columns " + strings.Join(columns, ", ")
+	}
+	return node
+}
+
+func describeJoin(step *joinStep) string {
+	joinTypes := map[JoinType]string{
+		InnerJoin: "INNER JOIN",
+		LeftJoin:  "LEFT JOIN",
+		RightJoin: "RIGHT JOIN",
+		FullJoin:  "FULL JOIN",
+	}
+
+	detail := fmt.Sprintf("%s %s", joinTypes[step.join.JoinType], step.join.Table)
+	if step.join.Condition != nil {
+		detail += " ON " + describeJoinCondition(step.join.Condition)
+	}
+
+	switch {
+	case step.probe == nil:
+	case step.probe.index != nil:
+		detail += " using index " + step.probe.index.String()
+	default:
+		detail += fmt.Sprintf(" hashing %s.%s", step.table.Name, step.table.Headers[step.probe.column])
+	}
+	return detail
+}
+
+// estimateJoinRows guesses the output size of a join. Equality joins through
+// an index use its number of distinct values, other equality joins are
+// assumed to follow a key relationship, and other conditions are assumed to
+// keep a third of all pairs.
+func estimateJoinRows(step *joinStep, left, right int) int {
+	var estimate int
+	switch {
+	case step.join.Condition == nil:
+		estimate = left * right
+	case step.probe != nil && step.probe.op == Equal && step.probe.index != nil:
+		distinct := maxInt(len(step.probe.index.hash), 1)
+		estimate = left * maxInt(right/distinct, 1)
+	case step.probe != nil && step.probe.op == Equal:
+		estimate = maxInt(left, right)
+	default:
+		estimate = left * right / 3
+	}
+
+	switch step.join.JoinType {
+	case LeftJoin:
+		estimate = maxInt(estimate, left)
+	case RightJoin:
+		estimate = maxInt(estimate, right)
+	case FullJoin:
+		estimate = maxInt(estimate, maxInt(left, right))
+	}
+	return estimate
+}
+
+// estimateSelectivity returns the expected fraction of rows that satisfy a
+// condition, using fixed guesses per predicate kind.
+func estimateSelectivity(condition Condition) float64 {
+	switch c := condition.(type) {
+	case *SimpleCondition:
+		switch c.Op {
+		case Equal:
+			return 0.1
+		case NotEqual:
+			return 0.9
+		case GreaterThan, GreaterThanEqual, LessThan, LessThanEqual:
+			return 1.0 / 3
+		default:
+			return 0.25
+		}
+	case *InCondition:
+		if s := 0.1 * float64(len(c.Values)); s < 1 {
+			return s
+		}
+		return 1
+	case *BetweenCondition:
+		return 0.25
+	case *CompositeCondition:
+		left, right := estimateSelectivity(c.Left), estimateSelectivity(c.Right)
+		if c.Operator == And {
+			return left * right
+		}
+		return left + right - left*right
+	default:
+		return 0.5
+	}
+}
+
+func describeCondition(condition Condition) string {
+	switch c := condition.(type) {
+	case *SimpleCondition:
+		return fmt.Sprintf("%s %s '%s'", c.Column, c.Op, c.Value)
+	case *InCondition:
+		return fmt.Sprintf("%s IN ('%s')", c.Column, strings.Join(c.Values, "', '"))
+	case *BetweenCondition:
+		return fmt.Sprintf("%s BETWEEN '%s' AND '%s'", c.Column, c.Low, c.High)
+	case *CompositeCondition:
+		return fmt.Sprintf("(%s %s %s)", describeCondition(c.Left), c.Operator, describeCondition(c.Right))
+	default:
+		return "custom function"
+	}
+}
+
+func describeJoinCondition(condition JoinConditionEvaluator) string {
+	switch c := condition.(type) {
+	case *JoinCondition:
+		return fmt.Sprintf("%s.%s %s %s.%s", c.LeftTable, c.LeftCol, c.Op, c.RightTable, c.RightCol)
+	case *CompositeJoinCondition:
+		return fmt.Sprintf("(%s %s %s)", describeJoinCondition(c.Left), c.Operator, describeJoinCondition(c.Right))
+	default:
+		return "custom function"
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -6,11 +6,15 @@ type QueryComponent interface {
 }
 
 type Query struct {
-	Select *SelectComponent
-	From   *FromComponent
-	Joins  []*JoinComponent
-	Where  *WhereComponent
-	Union  *UnionComponent
+	Select  *SelectComponent
+	From    *FromComponent
+	Joins   []*JoinComponent
+	Where   *WhereComponent
+	Union   *UnionComponent
+	OrderBy *OrderByComponent
+	Limit   *LimitComponent
+
+	ResourceLimits *ResourceLimits
 }
 
 type QueryBuilder struct {
@@ -115,5 +119,23 @@ func (qb *QueryBuilder) Build() (*Query, error) {
 		}
 	}
 
+	if qb.query.OrderBy != nil {
+		if err := qb.query.OrderBy.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if qb.query.Limit != nil {
+		if err := qb.query.Limit.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if qb.query.ResourceLimits != nil {
+		if err := qb.query.ResourceLimits.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	return qb.query, nil
 }
@@ -8,6 +8,7 @@ import (
 type SelectComponent struct {
 	Columns       []string
 	CustomColumns []CustomSelectField
+	WindowColumns []WindowSelectField
 }
 
 type CustomSelectField struct {
@@ -20,6 +21,11 @@ func (s *SelectComponent) Type() string {
 }
 
 func (s *SelectComponent) Validate() error {
+	for _, wc := range s.WindowColumns {
+		if err := wc.Window.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -49,7 +55,7 @@ func (qb *QueryBuilder) SelectCustom(name string, fn func(row map[string][]strin
 }
 
 func (s *SelectComponent) expandWildcards(tables map[string]*Table, mainTable string, joinedTables []string) ([]string, error) {
-	if len(s.Columns) == 0 && len(s.CustomColumns) == 0 {
+	if len(s.Columns) == 0 && len(s.CustomColumns) == 0 && len(s.WindowColumns) == 0 {
 		return nil, &ErrInvalidQuery{"SELECT must specify at least one column"}
 	}
 
@@ -0,0 +1,288 @@
+package csvsql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// defaultSniffSize is the number of bytes sampled when SniffOptions leaves
+// SampleSize unset.
+const defaultSniffSize = 64 << 10
+
+var (
+	utf8BOM         = []byte("\xEF\xBB\xBF")
+	sniffDelimiters = []rune{',', ';', '\t', '|'}
+	sniffQuotes     = []rune{'"', '\''}
+)
+
+// Dialect describes the format of a delimited text file.
+type Dialect struct {
+	Delimiter rune
+	Quote     rune
+	HasHeader bool
+	// BOM reports whether the file started with a byte order mark.
+	BOM      bool
+	Encoding Encoding
+}
+
+// SniffOptions enable detection of the delimiter, quote character and header
+// row of a CSV file from a sample of its start. Options set explicitly in
+// CSVOptions take precedence over detected ones: a Delimiter or Quote is
+// kept, and NoHeader set to true is not overridden. The dialect the file was
+// read with is stored in Table.Dialect and returned by Engine.TableDialect.
+type SniffOptions struct {
+	// SampleSize is the number of bytes sampled; it defaults to 64 KiB.
+	SampleSize int
+}
+
+// TableDialect returns the dialect of table alias, which is only known for a
+// single CSV file read with SniffOptions.
+func (e *Engine) TableDialect(alias string) (Dialect, error) {
+	e.mu.RLock()
+	table, ok := e.tables[alias]
+	e.mu.RUnlock()
+	if !ok {
+		return Dialect{}, fmt.Errorf("table %s not found", alias)
+	}
+	if table.Dialect == nil {
+		return Dialect{}, fmt.Errorf("no dialect was detected for table %s", alias)
+	}
+	return *table.Dialect, nil
+}
+
+// skipBOM discards a UTF-8 byte order mark at the start of r, which would
+// otherwise become part of the first header name.
+func skipBOM(r *bufio.Reader) bool {
+	prefix, _ := r.Peek(len(utf8BOM))
+	if !bytes.Equal(prefix, utf8BOM) {
+		return false
+	}
+	r.Discard(len(utf8BOM))
+	return true
+}
+
+// sniffDialect detects the dialect of sample, the start of a file after any
+// skipped rows. complete reports whether sample holds the whole file;
+// otherwise its last, possibly partial, line is ignored.
+func sniffDialect(sample []byte, complete bool, opts CSVOptions) *Dialect {
+	if !complete {
+		if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+			sample = sample[:i+1]
+		}
+	}
+
+	dialect := &Dialect{Delimiter: opts.Delimiter, Quote: opts.Quote}
+	if dialect.Quote == 0 {
+		dialect.Quote = sniffQuote(sample, opts.Delimiter)
+	}
+
+	var records [][]string
+	if dialect.Delimiter == 0 {
+		dialect.Delimiter = ','
+		bestConsistent, bestTotal, bestWidth := 0, 1, 1
+		for _, delimiter := range sniffDelimiters {
+			candidate, err := parseSample(sample, delimiter, dialect.Quote, opts)
+			if err != nil || len(candidate) == 0 {
+				continue
+			}
+			consistent, width := recordWidth(candidate)
+			if width < 2 {
+				continue
+			}
+			// Prefer the delimiter splitting the most records into the same
+			// number of fields, then the one producing more fields.
+			score, best := consistent*bestTotal, bestConsistent*len(candidate)
+			if score > best || (score == best && width > bestWidth) {
+				dialect.Delimiter, records = delimiter, candidate
+				bestConsistent, bestTotal, bestWidth = consistent, len(candidate), width
+			}
+		}
+	}
+	if records == nil {
+		records, _ = parseSample(sample, dialect.Delimiter, dialect.Quote, opts)
+	}
+
+	dialect.HasHeader = !opts.NoHeader && sniffHeader(records)
+	return dialect
+}
+
+// sniffQuote picks the quote character found most often at the boundaries
+// of fields, preferring the double quote.
+func sniffQuote(sample []byte, delimiter rune) rune {
+	delimiters := sniffDelimiters
+	if delimiter != 0 {
+		delimiters = []rune{delimiter}
+	}
+	isBoundary := func(r rune) bool {
+		if r == '\n' || r == '\r' {
+			return true
+		}
+		for _, d := range delimiters {
+			if r == d {
+				return true
+			}
+		}
+		return false
+	}
+
+	best, bestCount := '"', 0
+	runes := []rune(string(sample))
+	for _, quote := range sniffQuotes {
+		opening, closing := 0, 0
+		for i, r := range runes {
+			if r != quote {
+				continue
+			}
+			if i == 0 || isBoundary(runes[i-1]) {
+				opening++
+			}
+			if i == len(runes)-1 || isBoundary(runes[i+1]) {
+				closing++
+			}
+		}
+		if count := minInt(opening, closing); count > bestCount {
+			best, bestCount = quote, count
+		}
+	}
+	return best
+}
+
+func parseSample(sample []byte, delimiter, quote rune, opts CSVOptions) ([][]string, error) {
+	var r io.Reader = bytes.NewReader(sample)
+	if quote != '"' {
+		r = &quoteSwapReader{r: r, quote: byte(quote)}
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.Comment = opts.Comment
+	reader.TrimLeadingSpace = opts.TrimLeadingSpace
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if quote != '"' {
+		swapQuotes(records, byte(quote))
+	}
+	return records, nil
+}
+
+// recordWidth returns the most common number of fields per record and how
+// many records have it.
+func recordWidth(records [][]string) (consistent, width int) {
+	counts := make(map[int]int)
+	for _, record := range records {
+		counts[len(record)]++
+	}
+	for w, c := range counts {
+		if c > consistent || (c == consistent && w > width) {
+			consistent, width = c, w
+		}
+	}
+	return consistent, width
+}
+
+// sniffHeader guesses whether the first record is a header row by comparing
+// each of its fields with the values below it: a header is not numeric where
+// the column is, and differs in length where all values share one length.
+// Without evidence either way, the first record is taken as a header.
+func sniffHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return true
+	}
+
+	header := records[0]
+	seen := make(map[string]bool)
+	for _, name := range header {
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+
+	votes := 0
+	for i, name := range header {
+		numeric, length, sameLength, values := true, -1, true, 0
+		for _, record := range records[1:] {
+			if i >= len(record) || record[i] == "" {
+				continue
+			}
+			values++
+			if !isNumeric(record[i]) {
+				numeric = false
+			}
+			if length == -1 {
+				length = len(record[i])
+			} else if len(record[i]) != length {
+				sameLength = false
+			}
+		}
+
+		switch {
+		case values == 0:
+		case numeric:
+			if isNumeric(name) {
+				votes--
+			} else {
+				votes++
+			}
+		case sameLength:
+			if len(name) != length {
+				votes++
+			} else {
+				votes--
+			}
+		}
+	}
+	return votes >= 0
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil
+}
+
+// quoteSwapReader exchanges double quotes and quote, letting encoding/csv,
+// which only knows double quotes, parse files quoted with another character.
+// Parsed fields are swapped back with swapQuotes.
+type quoteSwapReader struct {
+	r     io.Reader
+	quote byte
+}
+
+func (s *quoteSwapReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for i, b := range p[:n] {
+		switch b {
+		case '"':
+			p[i] = s.quote
+		case s.quote:
+			p[i] = '"'
+		}
+	}
+	return n, err
+}
+
+func swapQuotes(records [][]string, quote byte) {
+	swap := func(r rune) rune {
+		switch r {
+		case '"':
+			return rune(quote)
+		case rune(quote):
+			return '"'
+		}
+		return r
+	}
+	for _, record := range records {
+		for i, field := range record {
+			record[i] = strings.Map(swap, field)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package csvsql
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSniffDialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		opts    CSVOptions
+		dialect Dialect
+		headers []string
+		rows    [][]string
+	}{
+		{
+			name:    "semicolons",
+			data:    "name;score\nalice;10\nbob;9\n",
+			dialect: Dialect{Delimiter: ';', Quote: '"', HasHeader: true, Encoding: UTF8},
+			headers: []string{"name", "score"},
+			rows:    [][]string{{"alice", "10"}, {"bob", "9"}},
+		},
+		{
+			name:    "single quotes",
+			data:    "name|note\n'alice'|'a|b'\n'bob'|'c'\n",
+			dialect: Dialect{Delimiter: '|', Quote: '\'', HasHeader: true, Encoding: UTF8},
+			headers: []string{"name", "note"},
+			rows:    [][]string{{"alice", "a|b"}, {"bob", "c"}},
+		},
+		{
+			name:    "no header",
+			data:    "1,2.5\n2,3.5\n3,4.5\n",
+			dialect: Dialect{Delimiter: ',', Quote: '"', Encoding: UTF8},
+			headers: []string{"column1", "column2"},
+			rows:    [][]string{{"1", "2.5"}, {"2", "3.5"}, {"3", "4.5"}},
+		},
+		{
+			name:    "byte order mark",
+			data:    "\xEF\xBB\xBFid\tname\n1\talice\n",
+			dialect: Dialect{Delimiter: '\t', Quote: '"', HasHeader: true, BOM: true, Encoding: UTF8},
+			headers: []string{"id", "name"},
+			rows:    [][]string{{"1", "alice"}},
+		},
+		{
+			name:    "explicit delimiter",
+			data:    "a;b,c\n1;2,3\n",
+			opts:    CSVOptions{Delimiter: ','},
+			dialect: Dialect{Delimiter: ',', Quote: '"', HasHeader: true, Encoding: UTF8},
+			headers: []string{"a;b", "c"},
+			rows:    [][]string{{"1;2", "3"}},
+		},
+		{
+			// The first row looks like a header, but NoHeader says it
+			// is data.
+			name:    "explicit no header",
+			data:    "name,city\nalice,boston\n",
+			opts:    CSVOptions{NoHeader: true, ColumnNames: []string{"n", "c"}},
+			dialect: Dialect{Delimiter: ',', Quote: '"', Encoding: UTF8},
+			headers: []string{"n", "c"},
+			rows:    [][]string{{"name", "city"}, {"alice", "boston"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sniff := &SniffOptions{}
+			tt.opts.Sniff = sniff
+			table, err := newTableFromCSVReader("t", strings.NewReader(tt.data), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if table.Dialect == nil || *table.Dialect != tt.dialect {
+				t.Errorf("dialect = %+v, want %+v", table.Dialect, tt.dialect)
+			}
+			if !reflect.DeepEqual(table.Headers, tt.headers) {
+				t.Errorf("headers = %q, want %q", table.Headers, tt.headers)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) {
+				t.Errorf("rows = %q, want %q", table.Rows, tt.rows)
+			}
+			if *sniff != (SniffOptions{}) {
+				t.Errorf("sniffing modified its options: %+v", *sniff)
+			}
+		})
+	}
+}
+
+func TestTableDialect(t *testing.T) {
+	// Tables sharing one SniffOptions may be created concurrently.
+	sniff := &SniffOptions{SampleSize: 1024}
+	files := map[string]string{
+		"commas":     "id,name\n1,alice\n",
+		"semicolons": "id;name\n1;alice\n",
+	}
+	e := NewEngine()
+	var wg sync.WaitGroup
+	for name, data := range files {
+		wg.Add(1)
+		go func(name, data string) {
+			defer wg.Done()
+			opts := TableOptions{CSV: CSVOptions{Sniff: sniff}}
+			if err := e.CreateTableFromReader(name, strings.NewReader(data), "csv", opts); err != nil {
+				t.Error(err)
+			}
+		}(name, data)
+	}
+	wg.Wait()
+
+	for name, want := range map[string]rune{"commas": ',', "semicolons": ';'} {
+		dialect, err := e.TableDialect(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dialect.Delimiter != want {
+			t.Errorf("%s: delimiter = %q, want %q", name, dialect.Delimiter, want)
+		}
+	}
+
+	if err := e.CreateTableFromRows("rows", []string{"id"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, alias := range []string{"rows", "missing"} {
+		if _, err := e.TableDialect(alias); err == nil {
+			t.Errorf("TableDialect(%s) succeeded", alias)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package csvsql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// tableSource reads the rows of a table that is loaded for every query
+// instead of once when it is created, such as a Parquet file.
+type tableSource interface {
+	// load reads the rows of the table, filling in the given columns, or
+	// every column when columns is nil. Sources that can skip columns leave
+	// the other values empty. Unless keep is nil, only the rows it accepts
+	// are returned; sources reading their rows in parts drop the others
+	// before reading the next part.
+	load(ctx context.Context, columns []int, keep func(row []string) bool) ([][]string, error)
+	// rowCount returns the number of rows without reading them.
+	rowCount() int
+}
+
+// numRows returns the number of rows of t, including those of a table whose
+// rows are read by queries.
+func (t *Table) numRows() int {
+	if t.source != nil {
+		return t.source.rowCount()
+	}
+	return len(t.Rows)
+}
+
+// withRows returns a copy of t with its rows loaded from its source, filling
+// in only the given columns and keeping only the rows keep accepts, or all of
+// them when keep is nil.
+func (t *Table) withRows(ctx context.Context, columns []int, keep func(row []string) bool) (*Table, error) {
+	rows, err := t.source.load(ctx, columns, keep)
+	if err != nil {
+		return nil, fmt.Errorf("load table %s error: %w", t.Name, err)
+	}
+	loaded := *t
+	loaded.Rows = rows
+	loaded.source = nil
+	return &loaded, nil
+}
+
+// loadSources replaces the tables of q, including those of set operation
+// operands, that have a source with copies holding their rows. Only the
+// columns the statement reads are loaded, and only the files of multi-file
+// tables its WHERE conditions do not prune. Rows failing the WHERE conjuncts
+// on a table alone are dropped while the table is read, unless the table is
+// read more than once by the statement or has indexes, whose row ids refer to
+// all of its rows; an indexed table whose source no longer has as many rows as
+// its indexes is an error. It must run on a snapshot, so that the registered
+// tables are left unloaded.
+func (e *Engine) loadSources(ctx context.Context, q *Query) error {
+	e.prunePartitions(q)
+
+	columns := make(map[string]map[int]bool)
+	all := make(map[string]bool)
+	e.collectSourceColumns(q, columns, all)
+
+	uses := make(map[string]int)
+	countTableUses(q, uses)
+	filters := make(map[string][]Condition)
+	e.collectSourceFilters(q, uses, filters)
+
+	for name, cols := range columns {
+		var indexes []int
+		if !all[name] {
+			indexes = make([]int, 0, len(cols))
+			for idx := range cols {
+				indexes = append(indexes, idx)
+			}
+			sort.Ints(indexes)
+		}
+
+		loaded, err := e.tables[name].withRows(ctx, indexes, e.rowFilter(name, filters[name]))
+		if err != nil {
+			return err
+		}
+		if err := e.checkIndexedRows(name, loaded); err != nil {
+			return err
+		}
+		e.tables[name] = loaded
+	}
+	return nil
+}
+
+// checkIndexedRows fails when the loaded table name no longer has the rows
+// its indexes were built from, as their row ids would not refer to its rows.
+func (e *Engine) checkIndexedRows(name string, table *Table) error {
+	for _, idx := range e.indexes[name] {
+		if len(idx.values) != len(table.Rows) {
+			return fmt.Errorf("table %s has %d rows, but had %d when the index on %s was created",
+				name, len(table.Rows), len(idx.values), idx.Column)
+		}
+	}
+	return nil
+}
+
+// collectSourceFilters records the WHERE conjuncts of q, and of its set
+// operation operands, that only read one table with a source, for the tables
+// that are read once, have no indexes and are not padded by an outer join.
+func (e *Engine) collectSourceFilters(q *Query, uses map[string]int, filters map[string][]Condition) {
+	if q.From == nil {
+		return
+	}
+	if q.Union != nil {
+		for _, op := range q.Union.operations() {
+			e.collectSourceFilters(op.Query, uses, filters)
+		}
+	}
+	if q.Where == nil {
+		return
+	}
+
+	tableData := e.createTableDataMap()
+	eligible := e.indexEligibleTables(q)
+	for _, condition := range splitConjuncts(q.Where.Condition) {
+		tables, ok := conditionTables(condition, tableData)
+		if !ok || len(tables) != 1 {
+			continue
+		}
+		for name := range tables {
+			table, ok := e.tables[name]
+			if ok && table.source != nil && eligible[name] && uses[name] == 1 && len(e.indexes[name]) == 0 {
+				filters[name] = append(filters[name], condition)
+			}
+		}
+	}
+}
+
+// rowFilter returns a function accepting the rows of table name that satisfy
+// filters, or nil when there are none. A filter that fails to evaluate keeps
+// the row, leaving the error to the query.
+func (e *Engine) rowFilter(name string, filters []Condition) func(row []string) bool {
+	if len(filters) == 0 {
+		return nil
+	}
+	tableData := e.createTableDataMap()
+	return func(row []string) bool {
+		data := map[string][]string{name: row}
+		for _, filter := range filters {
+			if ok, err := filter.Evaluate(data, tableData); err == nil && !ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// collectSourceColumns records the columns q reads from tables with a
+// source, or marks them in all when the columns cannot be determined.
+func (e *Engine) collectSourceColumns(q *Query, columns map[string]map[int]bool, all map[string]bool) {
+	if q.From == nil {
+		return
+	}
+
+	var referenced map[string][]string
+	if q.Select != nil {
+		referenced = e.referencedColumns(q)
+	}
+
+	names := []string{q.From.Table}
+	for _, join := range q.Joins {
+		names = append(names, join.Table)
+	}
+	for _, name := range names {
+		table, ok := e.tables[name]
+		if !ok || table.source == nil {
+			continue
+		}
+		if columns[name] == nil {
+			columns[name] = make(map[int]bool)
+		}
+		cols, ok := referenced[name]
+		if !ok {
+			all[name] = true
+			continue
+		}
+		for _, col := range cols {
+			if idx, err := table.GetColumnIndex(col); err == nil {
+				columns[name][idx] = true
+			}
+		}
+	}
+
+	if q.Union != nil {
+		for _, op := range q.Union.operations() {
+			e.collectSourceColumns(op.Query, columns, all)
+		}
+	}
+}
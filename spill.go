@@ -0,0 +1,757 @@
+package csvsql
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// spillBatchRows is the number of joined rows projected at a time when
+	// the projection feeds an external sort.
+	spillBatchRows = 4096
+	// maxSpillPartitions bounds the number of partition files, or sorted
+	// runs, used by a single operator.
+	maxSpillPartitions = 64
+	// spillMergeFanIn is the number of sorted runs of the same size merged
+	// into one larger run, so that every row is rewritten only once per
+	// level of runs.
+	spillMergeFanIn = 16
+)
+
+// WithSpillToDisk lets sorts, equality joins and set operations move
+// intermediate rows to temporary files in dir once they are estimated to take
+// more than threshold bytes of memory. An empty dir uses the default
+// temporary directory. Spilling is disabled unless this option is given.
+//
+// Spilling bounds the memory taken by the input and the hash tables or sort
+// buffers of those operators. Their output is held in memory, like that of
+// every other operator.
+func WithSpillToDisk(dir string, threshold int64) EngineOption {
+	return func(e *Engine) {
+		e.config.spillDir = dir
+		e.config.spillThreshold = threshold
+	}
+}
+
+// rowBytes estimates the memory taken by a result row.
+func rowBytes(row []string) int64 {
+	size := int64(resultRowBytes)
+	for _, val := range row {
+		size += cellBytes + int64(len(val))
+	}
+	return size
+}
+
+// spillRecord is the unit written to spill files. Tag keeps the position of
+// the record in the operator's input, IDs identify the table rows a joined
+// row consists of and Row holds a result row.
+type spillRecord struct {
+	Tag int
+	IDs []int
+	Row []string
+}
+
+type spillFile struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *gob.Encoder
+}
+
+func (e *Engine) newSpillFile() (*spillFile, error) {
+	file, err := os.CreateTemp(e.config.spillDir, "csvsql-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	buf := bufio.NewWriter(file)
+	return &spillFile{file: file, buf: buf, enc: gob.NewEncoder(buf)}, nil
+}
+
+func (s *spillFile) write(record spillRecord) error {
+	if err := s.enc.Encode(record); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	return nil
+}
+
+// reader flushes the file and returns a decoder reading it from the start.
+func (s *spillFile) reader() (*spillReader, error) {
+	if err := s.buf.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	return &spillReader{dec: gob.NewDecoder(bufio.NewReader(s.file))}, nil
+}
+
+func (s *spillFile) remove() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+type spillReader struct {
+	dec *gob.Decoder
+}
+
+// next returns the next record, or false at the end of the file.
+func (r *spillReader) next() (spillRecord, bool, error) {
+	var record spillRecord
+	if err := r.dec.Decode(&record); err != nil {
+		if errors.Is(err, io.EOF) {
+			return record, false, nil
+		}
+		return record, false, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	return record, true, nil
+}
+
+func removeSpillFiles(files []*spillFile) {
+	for _, f := range files {
+		if f != nil {
+			f.remove()
+		}
+	}
+}
+
+// spillPartitions returns the number of partitions needed for each to stay
+// below the spill threshold.
+func (e *Engine) spillPartitions(size int64) int {
+	n := int((size + e.config.spillThreshold - 1) / e.config.spillThreshold)
+	return minInt(maxInt(n, 2), maxSpillPartitions)
+}
+
+func partitionOf(key string, partitions int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// sortWithSpill projects joinedRows in batches into an external merge sort and
+// returns the first n sorted rows, or all of them when n is negative. Joined
+// rows are released as soon as they are projected. As order depends on every
+// value of the sort keys, the projected rows are observed and buffered, on
+// disk once they exceed the spill threshold, before any run is sorted.
+func (e *Engine) sortWithSpill(ctx context.Context, p *queryPlan, joinedRows []JoinedRow, sortColumns []string, order *sortOrder, n int, counter *resultCounter) ([][]string, error) {
+	input := &spillBuffer{e: e}
+	defer input.remove()
+	sorter := &externalSorter{e: e, order: order}
+	defer func() { removeSpillFiles(sorter.runs) }()
+
+	start := time.Now()
+	projected := 0
+	for lo := 0; lo < len(joinedRows); lo += spillBatchRows {
+		hi := minInt(lo+spillBatchRows, len(joinedRows))
+		batch, err := e.projectRows(ctx, p, joinedRows[lo:hi], sortColumns, counter)
+		if err != nil {
+			return nil, err
+		}
+		for i := lo; i < hi; i++ {
+			joinedRows[i] = JoinedRow{}
+		}
+
+		projected += len(batch)
+		if err := e.guard.checkRows(ProjectNode, projected, 0); err != nil {
+			return nil, err
+		}
+		for _, row := range batch {
+			order.observe(row)
+			if err := input.add(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	e.stats.record(p.project, projected, start)
+
+	start = time.Now()
+	err := input.each(ctx, func(row []string) error {
+		return sorter.add(ctx, row)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := sorter.sorted(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	e.stats.record(p.sort, projected, start)
+	return rows, nil
+}
+
+// spillBuffer keeps rows in memory until they exceed the spill threshold and
+// moves them to a spill file from then on.
+type spillBuffer struct {
+	e     *Engine
+	rows  [][]string
+	bytes int64
+	file  *spillFile
+}
+
+func (b *spillBuffer) add(row []string) error {
+	if b.file != nil {
+		return b.file.write(spillRecord{Row: row})
+	}
+	b.rows = append(b.rows, row)
+	b.bytes += rowBytes(row)
+	if b.bytes <= b.e.config.spillThreshold {
+		return nil
+	}
+
+	file, err := b.e.newSpillFile()
+	if err != nil {
+		return err
+	}
+	b.file = file
+	for _, row := range b.rows {
+		if err := file.write(spillRecord{Row: row}); err != nil {
+			return err
+		}
+	}
+	b.rows, b.bytes = nil, 0
+	return nil
+}
+
+// each passes the buffered rows to fn in the order they were added.
+func (b *spillBuffer) each(ctx context.Context, fn func(row []string) error) error {
+	if b.file == nil {
+		for _, row := range b.rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	reader, err := b.file.reader()
+	if err != nil {
+		return err
+	}
+	for {
+		if err := checkContext(ctx); err != nil {
+			return err
+		}
+		record, ok, err := reader.next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := fn(record.Row); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *spillBuffer) remove() {
+	if b.file != nil {
+		b.file.remove()
+	}
+}
+
+// externalSorter sorts rows in memory until they exceed the spill threshold,
+// then writes them out as a sorted run. Whenever the last spillMergeFanIn
+// runs are of the same level they are merged into one run of the next level,
+// and the remaining runs are merged at the end. All rows must have been
+// observed by order before the first one is added.
+type externalSorter struct {
+	e      *Engine
+	order  *sortOrder
+	buffer [][]string
+	bytes  int64
+	runs   []*spillFile
+	levels []int
+}
+
+func (s *externalSorter) add(ctx context.Context, row []string) error {
+	s.buffer = append(s.buffer, row)
+	s.bytes += rowBytes(row)
+	if s.bytes <= s.e.config.spillThreshold {
+		return nil
+	}
+	if err := s.spill(ctx); err != nil {
+		return err
+	}
+	return s.compact(ctx)
+}
+
+func (s *externalSorter) spill(ctx context.Context) error {
+	if err := s.order.sort(ctx, s.buffer); err != nil {
+		return err
+	}
+
+	run, err := s.e.newSpillFile()
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, run)
+	s.levels = append(s.levels, 0)
+	for _, row := range s.buffer {
+		if err := run.write(spillRecord{Row: row}); err != nil {
+			return err
+		}
+	}
+	s.buffer, s.bytes = nil, 0
+	return nil
+}
+
+// sorted returns the first n rows in sort order, or all rows when n is
+// negative. Rows that compare equal keep the order they were added in, as
+// runs are merged preferring earlier runs.
+func (s *externalSorter) sorted(ctx context.Context, n int) ([][]string, error) {
+	if len(s.runs) == 0 {
+		if err := s.order.sort(ctx, s.buffer); err != nil {
+			return nil, err
+		}
+		return s.buffer, nil
+	}
+	if len(s.buffer) > 0 {
+		if err := s.spill(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for len(s.runs) > maxSpillPartitions {
+		if err := s.mergeTail(ctx, spillMergeFanIn); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows [][]string
+	err := s.merge(ctx, s.runs, func(row []string) bool {
+		rows = append(rows, row)
+		return n < 0 || len(rows) < n
+	})
+	return rows, err
+}
+
+// compact merges the last spillMergeFanIn runs while they are of the same
+// level. Levels never increase along the runs, so the merged runs are always
+// the most recent ones.
+func (s *externalSorter) compact(ctx context.Context) error {
+	for len(s.runs) >= spillMergeFanIn {
+		tail := len(s.runs) - spillMergeFanIn
+		if s.levels[tail] != s.levels[len(s.runs)-1] {
+			return nil
+		}
+		if err := s.mergeTail(ctx, spillMergeFanIn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeTail merges the last n runs into one run a level above the highest of
+// them. Merging adjacent runs keeps rows that compare equal in the order they
+// were added.
+func (s *externalSorter) mergeTail(ctx context.Context, n int) error {
+	tail := len(s.runs) - n
+	run, err := s.e.newSpillFile()
+	if err != nil {
+		return err
+	}
+
+	var writeErr error
+	err = s.merge(ctx, s.runs[tail:], func(row []string) bool {
+		writeErr = run.write(spillRecord{Row: row})
+		return writeErr == nil
+	})
+	removeSpillFiles(s.runs[tail:])
+	s.runs = append(s.runs[:tail], run)
+	s.levels = append(s.levels[:tail], s.levels[tail]+1)
+	if err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// merge passes the rows of runs to emit in sort order until emit returns
+// false.
+func (s *externalSorter) merge(ctx context.Context, runs []*spillFile, emit func(row []string) bool) error {
+	merge := &runMerge{sorter: s}
+	for i, run := range runs {
+		reader, err := run.reader()
+		if err != nil {
+			return err
+		}
+		head := &runHead{run: i, reader: reader}
+		if err := head.advance(); err != nil {
+			return err
+		}
+		merge.heads = append(merge.heads, head)
+	}
+	heap.Init(merge)
+
+	for merge.Len() > 0 {
+		if err := checkContext(ctx); err != nil {
+			return err
+		}
+		head := merge.heads[0]
+		if !emit(head.row) {
+			return nil
+		}
+		if err := head.advance(); err != nil {
+			return err
+		}
+		if head.row == nil {
+			heap.Pop(merge)
+		} else {
+			heap.Fix(merge, 0)
+		}
+	}
+	return nil
+}
+
+// runMerge is a heap over the current row of every sorted run.
+type runMerge struct {
+	sorter *externalSorter
+	heads  []*runHead
+}
+
+type runHead struct {
+	run    int
+	reader *spillReader
+	row    []string
+}
+
+// advance moves to the next row of the run; row is nil once it is exhausted.
+func (h *runHead) advance() error {
+	record, ok, err := h.reader.next()
+	if err != nil {
+		return err
+	}
+	h.row = nil
+	if ok {
+		h.row = record.Row
+	}
+	return nil
+}
+
+func (m *runMerge) Len() int { return len(m.heads) }
+
+func (m *runMerge) Less(i, j int) bool {
+	a, b := m.heads[i], m.heads[j]
+	cmp := m.sorter.order.compare(a.row, b.row)
+	if cmp != 0 {
+		return cmp < 0
+	}
+	return a.run < b.run
+}
+
+func (m *runMerge) Swap(i, j int) { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+
+func (m *runMerge) Push(x any) { m.heads = append(m.heads, x.(*runHead)) }
+
+func (m *runMerge) Pop() any {
+	head := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return head
+}
+
+// useGraceHashJoin reports whether an equality join should be run as a grace
+// hash join, which is when spilling is enabled and its input rows are
+// estimated to exceed the spill threshold.
+func (e *Engine) useGraceHashJoin(step *joinStep, joinedRows []JoinedRow) (int, bool) {
+	probe := step.probe
+	if e.config.spillThreshold <= 0 || probe == nil || probe.op != Equal || step.join.JoinType != InnerJoin {
+		return 0, false
+	}
+	if !containsString(step.previous, probe.otherTable) {
+		return 0, false
+	}
+
+	size := int64(countActiveRows(joinedRows)) * (joinedRowBytes + tableRowBytes*int64(len(step.previous)))
+	if size <= e.config.spillThreshold {
+		return 0, false
+	}
+	return e.spillPartitions(size), true
+}
+
+// graceHashJoin runs an inner equality join whose input is too large to keep
+// next to its output. The joined rows are written to partition files by the
+// hash of their join key, as the ids of the table rows they consist of, and
+// released. Every partition is then joined on its own using a hash table over
+// the joined-table rows of the same partition, which are picked from the
+// loaded table as each partition is joined. The output is sorted back into
+// the order an in-memory hash join produces.
+func (e *Engine) graceHashJoin(ctx context.Context, step *joinStep, allowed []bool, joinedRows *[]JoinedRow, counter *rowCounter, partitions int) error {
+	probe, joinedTable := step.probe, step.table
+
+	files := make([]*spillFile, partitions)
+	defer removeSpillFiles(files)
+	for i := range files {
+		f, err := e.newSpillFile()
+		if err != nil {
+			return err
+		}
+		files[i] = f
+	}
+
+	for seq, jr := range *joinedRows {
+		if jr.isFiltered {
+			continue
+		}
+		if err := checkContext(ctx); err != nil {
+			return err
+		}
+		key, _ := probe.key(jr)
+		if err := files[partitionOf(key, partitions)].write(spillRecord{Tag: seq, IDs: jr.rowIDs}); err != nil {
+			return err
+		}
+	}
+	*joinedRows = nil
+
+	var output taggedJoinedRows
+	output.position = step.position
+	for i, file := range files {
+		hash := make(map[string][]int)
+		for rowIdx, row := range joinedTable.Rows {
+			if allowed != nil && !allowed[rowIdx] {
+				continue
+			}
+			if key := row[probe.column]; partitionOf(key, partitions) == i {
+				hash[key] = append(hash[key], rowIdx)
+			}
+		}
+
+		reader, err := file.reader()
+		if err != nil {
+			return err
+		}
+		for {
+			record, ok, err := reader.next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+
+			jr := e.restoreJoinedRow(step, record.IDs)
+			key, _ := probe.key(jr)
+			for _, rowIdx := range hash[key] {
+				if err := checkContext(ctx); err != nil {
+					return err
+				}
+				joinRow := joinedTable.Rows[rowIdx]
+				match, err := e.evaluateJoinCondition(step, jr, joinRow)
+				if err != nil {
+					return err
+				}
+				if !match {
+					continue
+				}
+				if err := counter.add(1); err != nil {
+					return err
+				}
+				output.rows = append(output.rows, e.createNewJoinedRow(jr, step, joinRow, rowIdx))
+				output.tags = append(output.tags, record.Tag)
+			}
+		}
+	}
+
+	sort.Sort(output)
+	*joinedRows = output.rows
+	return nil
+}
+
+// restoreJoinedRow rebuilds a joined row of the tables in step.previous from
+// the ids of its table rows. An id of -1 stands for a row padded by an outer
+// join.
+func (e *Engine) restoreJoinedRow(step *joinStep, ids []int) JoinedRow {
+	jr := JoinedRow{
+		mainTable:  step.previous[0],
+		joinedRows: make(map[string][]string),
+		rowIDs:     ids,
+	}
+	for i, name := range step.previous {
+		table := e.tables[name]
+		row := make([]string, len(table.Headers))
+		if id := ids[step.positions[i]]; id >= 0 {
+			row = table.Rows[id]
+		}
+		if i == 0 {
+			jr.mainRow = row
+		} else {
+			jr.joinedRows[name] = row
+		}
+	}
+	return jr
+}
+
+// taggedJoinedRows sorts joined rows by the position of their input row and
+// then by the id of the joined-table row.
+type taggedJoinedRows struct {
+	rows     []JoinedRow
+	tags     []int
+	position int
+}
+
+func (t taggedJoinedRows) Len() int { return len(t.rows) }
+
+func (t taggedJoinedRows) Less(i, j int) bool {
+	if t.tags[i] != t.tags[j] {
+		return t.tags[i] < t.tags[j]
+	}
+	return t.rows[i].rowIDs[t.position] < t.rows[j].rowIDs[t.position]
+}
+
+func (t taggedJoinedRows) Swap(i, j int) {
+	t.rows[i], t.rows[j] = t.rows[j], t.rows[i]
+	t.tags[i], t.tags[j] = t.tags[j], t.tags[i]
+}
+
+// spillSetResults combines the rows of a set operation like
+// combineSetResults when they are too large to hash in memory at once. Both
+// sides are partitioned into files by the hash of each row, so equal rows
+// meet in the same partition, and released. The partitions are then combined
+// one at a time into output files, which are merged back into the order
+// combineSetResults produces.
+func (e *Engine) spillSetResults(ctx context.Context, kind UnionType, left, right [][]string) ([][]string, error) {
+	var size int64
+	for _, rows := range [][][]string{left[1:], right[1:]} {
+		for _, row := range rows {
+			size += rowBytes(row)
+		}
+	}
+	if size <= e.config.spillThreshold {
+		return combineSetResults(kind, left, right), nil
+	}
+	partitions := e.spillPartitions(size)
+
+	files := make([]*spillFile, 3*partitions)
+	defer removeSpillFiles(files)
+	for i := range files {
+		f, err := e.newSpillFile()
+		if err != nil {
+			return nil, err
+		}
+		files[i] = f
+	}
+	inputs, outputs := files[:2*partitions], files[2*partitions:]
+
+	header := left[0]
+	for side, rows := range [][][]string{left[1:], right[1:]} {
+		offset := side * len(left)
+		for i, row := range rows {
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			file := inputs[side*partitions+partitionOf(createRowKey(row), partitions)]
+			if err := file.write(spillRecord{Tag: offset + i, Row: row}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// The operands are no longer needed once they are partitioned.
+	left, right = nil, nil
+
+	for i := 0; i < partitions; i++ {
+		var sides [2][]setRow
+		for side := range sides {
+			reader, err := inputs[side*partitions+i].reader()
+			if err != nil {
+				return nil, err
+			}
+			for {
+				record, ok, err := reader.next()
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					break
+				}
+				sides[side] = append(sides[side], setRow{pos: record.Tag, row: record.Row})
+			}
+		}
+		inputs[i].remove()
+		inputs[partitions+i].remove()
+		inputs[i], inputs[partitions+i] = nil, nil
+
+		for _, r := range combineSetRows(kind, sides[0], sides[1]) {
+			if err := outputs[i].write(spillRecord{Tag: r.pos, Row: r.row}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Every output file holds its rows in input order, so merging them by
+	// position restores the order of the whole input.
+	merge := &setMerge{}
+	for _, file := range outputs {
+		reader, err := file.reader()
+		if err != nil {
+			return nil, err
+		}
+		head := &setHead{reader: reader}
+		if err := head.advance(); err != nil {
+			return nil, err
+		}
+		if head.ok {
+			merge.heads = append(merge.heads, head)
+		}
+	}
+	heap.Init(merge)
+
+	results := [][]string{header}
+	for merge.Len() > 0 {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		head := merge.heads[0]
+		results = append(results, head.record.Row)
+		if err := head.advance(); err != nil {
+			return nil, err
+		}
+		if head.ok {
+			heap.Fix(merge, 0)
+		} else {
+			heap.Pop(merge)
+		}
+	}
+	return results, nil
+}
+
+// setMerge is a heap over the current record of every output partition of a
+// set operation, ordered by input position.
+type setMerge struct {
+	heads []*setHead
+}
+
+type setHead struct {
+	reader *spillReader
+	record spillRecord
+	ok     bool
+}
+
+func (h *setHead) advance() (err error) {
+	h.record, h.ok, err = h.reader.next()
+	return err
+}
+
+func (m *setMerge) Len() int { return len(m.heads) }
+
+func (m *setMerge) Less(i, j int) bool { return m.heads[i].record.Tag < m.heads[j].record.Tag }
+
+func (m *setMerge) Swap(i, j int) { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+
+func (m *setMerge) Push(x any) { m.heads = append(m.heads, x.(*setHead)) }
+
+func (m *setMerge) Pop() any {
+	head := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return head
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package csvsql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// newSpillTestEngine returns an engine with table t(id, g) holding ten rows
+// for every g and table s(g, name) holding one or two rows for every g.
+func newSpillTestEngine(t *testing.T, opts ...EngineOption) *Engine {
+	t.Helper()
+	const n = 3000
+	rows := make([][]string, n)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i), strconv.Itoa(i / 10)}
+	}
+	var sRows [][]string
+	for g := 100; g < 400; g++ {
+		sRows = append(sRows, []string{strconv.Itoa(g), "n" + strconv.Itoa(g)})
+		if g%3 == 0 {
+			sRows = append(sRows, []string{strconv.Itoa(g), "m" + strconv.Itoa(g)})
+		}
+	}
+
+	e := NewEngine(opts...)
+	if err := e.CreateTableFromRows("t", []string{"id", "g"}, rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateTableFromRows("s", []string{"g", "name"}, sRows); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func spillTestQueries() map[string]*QueryBuilder {
+	g := func(table string) *QueryBuilder { return NewQuery().Select("g").From(table) }
+	return map[string]*QueryBuilder{
+		"sort":           NewQuery().Select("id", "g").From("t").OrderBy("g", Desc),
+		"sort_limit":     NewQuery().Select("id", "g").From("t").OrderBy("g", Desc).Limit(25).Offset(1000),
+		"grace_join":     NewQuery().Select("t.id", "s.name").From("t").InnerJoin("s").On("t", "g", "=", "s", "g"),
+		"union":          g("t").Union(g("s")),
+		"intersect":      g("t").Intersect(g("s")),
+		"intersect_all":  g("t").IntersectAll(g("s")),
+		"except":         g("t").Except(g("s")),
+		"except_all":     g("s").ExceptAll(g("t")),
+		"nested_set_ops": g("t").Except(g("s").Union(g("s"))).OrderBy("g", Desc),
+	}
+}
+
+func TestSpillMatchesInMemoryExecution(t *testing.T) {
+	memory := newSpillTestEngine(t)
+	for name, qb := range spillTestQueries() {
+		t.Run(name, func(t *testing.T) {
+			q := mustBuild(t, qb)
+			want := mustQuery(t, memory, q)
+
+			// A tiny threshold makes every operator spill, the sort
+			// into enough runs to merge them over several levels.
+			dir := t.TempDir()
+			got := mustQuery(t, newSpillTestEngine(t, WithSpillToDisk(dir, 100)), q)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("spilled results differ from in-memory results:\ngot  %v\nwant %v", got, want)
+			}
+
+			if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+				t.Errorf("spill directory holds %d entries after the query (err %v)", len(entries), err)
+			}
+		})
+	}
+}
+
+func TestSpillUsesSpillDirectory(t *testing.T) {
+	// Every query spills, so creating spill files in a missing directory
+	// fails.
+	e := newSpillTestEngine(t, WithSpillToDisk(filepath.Join(t.TempDir(), "missing"), 100))
+	for name, qb := range spillTestQueries() {
+		if _, err := e.ExecuteQuery(mustBuild(t, qb)); err == nil {
+			t.Errorf("%s: ExecuteQuery succeeded without a spill directory", name)
+		}
+	}
+}
+
+func TestExternalSorterMergesRunsByLevel(t *testing.T) {
+	e := NewEngine(WithSpillToDisk(t.TempDir(), 1))
+	order := newSortOrder([]int{0}, []OrderByField{{Column: "k", Direction: Asc}})
+	sorter := &externalSorter{e: e, order: order}
+	defer func() { removeSpillFiles(sorter.runs) }()
+
+	// With a threshold of one byte every row becomes a run of its own.
+	const n = 1000
+	var rows [][]string
+	for i := 0; i < n; i++ {
+		rows = append(rows, []string{strconv.Itoa((i * 7) % 100), strconv.Itoa(i)})
+	}
+	for _, row := range rows {
+		order.observe(row)
+	}
+	for _, row := range rows {
+		if err := sorter.add(context.Background(), row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Fewer than spillMergeFanIn runs are kept per level, from the largest
+	// to the smallest.
+	perLevel := make(map[int]int)
+	for i, level := range sorter.levels {
+		if i > 0 && level > sorter.levels[i-1] {
+			t.Fatalf("run levels %v increase", sorter.levels)
+		}
+		if perLevel[level]++; perLevel[level] >= spillMergeFanIn {
+			t.Fatalf("run levels %v are not merged", sorter.levels)
+		}
+	}
+	if len(perLevel) < 3 {
+		t.Fatalf("run levels %v, want three levels", sorter.levels)
+	}
+
+	got, err := sorter.sorted(context.Background(), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != n {
+		t.Fatalf("got %d rows, want %d", len(got), n)
+	}
+	for i := 1; i < n; i++ {
+		a, _ := strconv.Atoi(got[i-1][0])
+		b, _ := strconv.Atoi(got[i][0])
+		ia, _ := strconv.Atoi(got[i-1][1])
+		ib, _ := strconv.Atoi(got[i][1])
+		if a > b || (a == b && ia > ib) {
+			t.Fatalf("rows %v and %v are out of order", got[i-1], got[i])
+		}
+	}
+}
@@ -0,0 +1,865 @@
+package csvsql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseSQL parses a SELECT statement into the Query the QueryBuilder would
+// build for it. The statement may contain:
+//
+//	SELECT *, t.*, column, t.column
+//	FROM table [INNER | LEFT | RIGHT | FULL] JOIN table ON t.a = u.b [AND ...]
+//	WHERE conditions using =, !=, <>, <, <=, >, >=, [NOT] LIKE, [NOT] IN,
+//	      [NOT] BETWEEN, IS [NOT] NULL, NOT, AND, OR and parentheses
+//	UNION, INTERSECT and EXCEPT, each optionally followed by ALL
+//	ORDER BY column [ASC | DESC], LIMIT n and OFFSET n
+//
+// Each ? placeholder takes the next of args, which may be strings, byte
+// slices, integers, floats, booleans, time.Time values or nil. Like all
+// values, they are compared as strings. Names that are keywords or contain
+// other characters than letters, digits and underscores are quoted with
+// double quotes or backticks, and string literals with single quotes.
+func ParseSQL(query string, args ...interface{}) (*Query, error) {
+	tokens, err := lexSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens, args: args}
+	q, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	if p.argPos != len(args) {
+		return nil, &ErrInvalidQuery{fmt.Sprintf("query has %d placeholders but %d arguments were given", p.argPos, len(args))}
+	}
+	return q, nil
+}
+
+type sqlTokenKind int
+
+const (
+	sqlEOF sqlTokenKind = iota
+	sqlIdent
+	sqlQuotedIdent
+	sqlString
+	sqlNumber
+	sqlPlaceholder
+	sqlSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+func (t sqlToken) String() string {
+	switch t.kind {
+	case sqlEOF:
+		return "end of query"
+	case sqlString:
+		return "'" + t.text + "'"
+	case sqlQuotedIdent:
+		return `"` + t.text + `"`
+	}
+	return t.text
+}
+
+// sqlKeywords are the words that cannot be used as unquoted names.
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true,
+	"NOT": true, "IN": true, "LIKE": true, "BETWEEN": true, "IS": true,
+	"NULL": true, "TRUE": true, "FALSE": true, "JOIN": true, "INNER": true,
+	"LEFT": true, "RIGHT": true, "FULL": true, "OUTER": true, "CROSS": true,
+	"ON": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "ALL": true,
+	"DISTINCT": true, "AS": true, "GROUP": true, "HAVING": true, "ORDER": true,
+	"BY": true, "ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true,
+}
+
+func lexSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for pos := 0; pos < len(query); {
+		r, size := utf8.DecodeRuneInString(query[pos:])
+		start := pos
+		switch {
+		case unicode.IsSpace(r):
+			pos += size
+		case strings.HasPrefix(query[pos:], "--"):
+			if end := strings.IndexByte(query[pos:], '\n'); end >= 0 {
+				pos += end + 1
+			} else {
+				pos = len(query)
+			}
+		case strings.HasPrefix(query[pos:], "/*"):
+			end := strings.Index(query[pos+2:], "*/")
+			if end < 0 {
+				return nil, &ErrInvalidQuery{fmt.Sprintf("unterminated comment at position %d", start)}
+			}
+			pos += end + 4
+		case r == '\'' || r == '"' || r == '`':
+			text, n, ok := lexSQLQuoted(query[pos:], byte(r))
+			if !ok {
+				return nil, &ErrInvalidQuery{fmt.Sprintf("unterminated quoted text at position %d", start)}
+			}
+			kind := sqlQuotedIdent
+			if r == '\'' {
+				kind = sqlString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: text, pos: start})
+			pos += n
+		case r == '_' || unicode.IsLetter(r):
+			for pos < len(query) {
+				r, size := utf8.DecodeRuneInString(query[pos:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				pos += size
+			}
+			tokens = append(tokens, sqlToken{kind: sqlIdent, text: query[start:pos], pos: start})
+		case r >= '0' && r <= '9':
+			pos = lexSQLNumber(query, pos)
+			tokens = append(tokens, sqlToken{kind: sqlNumber, text: query[start:pos], pos: start})
+		case r == '?':
+			tokens = append(tokens, sqlToken{kind: sqlPlaceholder, text: "?", pos: start})
+			pos++
+		default:
+			symbol := ""
+			for _, s := range []string{"<=", ">=", "<>", "!=", "=", "<", ">", "(", ")", ",", ".", "*", ";", "-"} {
+				if strings.HasPrefix(query[pos:], s) {
+					symbol = s
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, &ErrInvalidQuery{fmt.Sprintf("unexpected character %q at position %d", r, start)}
+			}
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, text: symbol, pos: start})
+			pos += len(symbol)
+		}
+	}
+	return append(tokens, sqlToken{kind: sqlEOF, pos: len(query)}), nil
+}
+
+// lexSQLQuoted reads text enclosed in quote, in which the quote is escaped by
+// doubling it. It returns the text and the number of bytes read.
+func lexSQLQuoted(s string, quote byte) (string, int, bool) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			sb.WriteByte(quote)
+			i++
+			continue
+		}
+		return sb.String(), i + 1, true
+	}
+	return "", 0, false
+}
+
+func lexSQLNumber(s string, pos int) int {
+	digits := func() {
+		for pos < len(s) && s[pos] >= '0' && s[pos] <= '9' {
+			pos++
+		}
+	}
+	digits()
+	if pos+1 < len(s) && s[pos] == '.' && s[pos+1] >= '0' && s[pos+1] <= '9' {
+		pos++
+		digits()
+	}
+	if pos < len(s) && (s[pos] == 'e' || s[pos] == 'E') {
+		exp := pos + 1
+		if exp < len(s) && (s[exp] == '+' || s[exp] == '-') {
+			exp++
+		}
+		if exp < len(s) && s[exp] >= '0' && s[exp] <= '9' {
+			pos = exp
+			digits()
+		}
+	}
+	return pos
+}
+
+// countSQLPlaceholders returns the number of ? placeholders in query.
+func countSQLPlaceholders(query string) (int, error) {
+	tokens, err := lexSQL(query)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, token := range tokens {
+		if token.kind == sqlPlaceholder {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+	args   []interface{}
+	argPos int
+	// table is the only table of the SELECT being parsed, or empty when it
+	// joins tables.
+	table string
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == sqlIdent && strings.EqualFold(token.text, keyword)
+}
+
+func (p *sqlParser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.unexpected(keyword)
+	}
+	return nil
+}
+
+func (p *sqlParser) isSymbol(symbol string) bool {
+	token := p.peek()
+	return token.kind == sqlSymbol && token.text == symbol
+}
+
+func (p *sqlParser) acceptSymbol(symbol string) bool {
+	if p.isSymbol(symbol) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.unexpected(symbol)
+	}
+	return nil
+}
+
+// unexpected reports the current token, which is not what was expected.
+func (p *sqlParser) unexpected(expected string) error {
+	token := p.peek()
+	if token.kind == sqlIdent {
+		switch keyword := strings.ToUpper(token.text); keyword {
+		case "DISTINCT", "AS", "GROUP", "HAVING", "CROSS":
+			return &ErrInvalidQuery{fmt.Sprintf("%s is not supported", keyword)}
+		}
+	}
+	return &ErrInvalidQuery{fmt.Sprintf("syntax error at position %d: expected %s, found %s", token.pos, expected, token)}
+}
+
+func (p *sqlParser) parseStatement() (*Query, error) {
+	qb, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var kind UnionType
+		switch {
+		case p.acceptKeyword("UNION"):
+			kind = Union
+		case p.acceptKeyword("INTERSECT"):
+			kind = Intersect
+		case p.acceptKeyword("EXCEPT"):
+			kind = Except
+		}
+		if kind == "" {
+			break
+		}
+		if p.acceptKeyword("ALL") {
+			kind += " ALL"
+		}
+		other, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		qb.setOperation(kind, other)
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			column, err := p.parseName("column")
+			if err != nil {
+				return nil, err
+			}
+			direction := Asc
+			if p.acceptKeyword("DESC") {
+				direction = Desc
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			qb.OrderBy(column, direction)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		count, err := p.parseCount("LIMIT")
+		if err != nil {
+			return nil, err
+		}
+		qb.Limit(count)
+	}
+	if p.acceptKeyword("OFFSET") {
+		offset, err := p.parseCount("OFFSET")
+		if err != nil {
+			return nil, err
+		}
+		qb.Offset(offset)
+	}
+
+	p.acceptSymbol(";")
+	if p.peek().kind != sqlEOF {
+		return nil, p.unexpected("end of query")
+	}
+	return qb.Build()
+}
+
+func (p *sqlParser) parseSelect() (*QueryBuilder, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	qb := NewQuery()
+	for {
+		column, err := p.parseSelectColumn()
+		if err != nil {
+			return nil, err
+		}
+		qb.Select(column)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.parseTable()
+	if err != nil {
+		return nil, err
+	}
+	qb.From(table)
+
+	for {
+		joinType, ok, err := p.parseJoinType()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		table, err := p.parseTable()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("ON"); err != nil {
+			return nil, err
+		}
+		condition, err := p.parseJoinCondition()
+		if err != nil {
+			return nil, err
+		}
+		qb.query.Joins = append(qb.query.Joins, &JoinComponent{
+			Table:     table,
+			Condition: condition,
+			JoinType:  joinType,
+		})
+	}
+
+	p.table = ""
+	if len(qb.query.Joins) == 0 {
+		p.table = table
+	}
+	if p.acceptKeyword("WHERE") {
+		condition, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		qb.query.Where = &WhereComponent{Condition: condition}
+	}
+	return qb, nil
+}
+
+func (p *sqlParser) parseTable() (string, error) {
+	table, err := p.parseName("table")
+	if err != nil {
+		return "", err
+	}
+	if token := p.peek(); token.kind == sqlQuotedIdent || token.kind == sqlIdent && !sqlKeywords[strings.ToUpper(token.text)] {
+		return "", &ErrInvalidQuery{fmt.Sprintf("table aliases are not supported: %s at position %d", token, token.pos)}
+	}
+	return table, nil
+}
+
+func (p *sqlParser) parseSelectColumn() (string, error) {
+	if p.acceptSymbol("*") {
+		return "*", nil
+	}
+	name, err := p.parseIdent("column")
+	if err != nil {
+		return "", err
+	}
+	for p.acceptSymbol(".") {
+		if p.acceptSymbol("*") {
+			return name + ".*", nil
+		}
+		part, err := p.parseIdent("column")
+		if err != nil {
+			return "", err
+		}
+		name += "." + part
+	}
+	return name, nil
+}
+
+func (p *sqlParser) parseJoinType() (JoinType, bool, error) {
+	joinType := InnerJoin
+	switch {
+	case p.acceptKeyword("INNER"):
+	case p.acceptKeyword("LEFT"):
+		joinType = LeftJoin
+		p.acceptKeyword("OUTER")
+	case p.acceptKeyword("RIGHT"):
+		joinType = RightJoin
+		p.acceptKeyword("OUTER")
+	case p.acceptKeyword("FULL"):
+		joinType = FullJoin
+		p.acceptKeyword("OUTER")
+	case p.isKeyword("JOIN"):
+	default:
+		return 0, false, nil
+	}
+	if err := p.expectKeyword("JOIN"); err != nil {
+		return 0, false, err
+	}
+	return joinType, true, nil
+}
+
+// parseJoinCondition parses comparisons of columns of two tables joined by
+// AND. Columns must be qualified by their table.
+func (p *sqlParser) parseJoinCondition() (JoinConditionEvaluator, error) {
+	var condition JoinConditionEvaluator
+	for {
+		leftTable, leftCol, err := p.parseQualifiedColumn()
+		if err != nil {
+			return nil, err
+		}
+		op, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		rightTable, rightCol, err := p.parseQualifiedColumn()
+		if err != nil {
+			return nil, err
+		}
+
+		comparison := &JoinCondition{
+			LeftTable:  leftTable,
+			LeftCol:    leftCol,
+			Op:         op,
+			RightTable: rightTable,
+			RightCol:   rightCol,
+		}
+		if condition == nil {
+			condition = comparison
+		} else {
+			condition = &CompositeJoinCondition{Left: condition, Right: comparison, Operator: And}
+		}
+
+		if !p.acceptKeyword("AND") {
+			return condition, nil
+		}
+	}
+}
+
+func (p *sqlParser) parseQualifiedColumn() (string, string, error) {
+	token := p.peek()
+	name, err := p.parseName("column")
+	if err != nil {
+		return "", "", err
+	}
+	table, column, ok := strings.Cut(name, ".")
+	if !ok {
+		return "", "", &ErrInvalidQuery{fmt.Sprintf("join column %s at position %d must be qualified by its table", name, token.pos)}
+	}
+	return table, column, nil
+}
+
+func (p *sqlParser) parseOr() (Condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &CompositeCondition{Left: left, Right: right, Operator: Or}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAnd() (Condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &CompositeCondition{Left: left, Right: right, Operator: And}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseNot() (Condition, error) {
+	if p.acceptKeyword("NOT") {
+		condition, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition(condition), nil
+	}
+	if p.acceptSymbol("(") {
+		condition, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return condition, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *sqlParser) parsePredicate() (Condition, error) {
+	// A value compared to a column is turned around to compare the column.
+	if value, ok, err := p.parseValue(); err != nil {
+		return nil, err
+	} else if ok {
+		op, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		column, err := p.parseConditionColumn("column")
+		if err != nil {
+			return nil, err
+		}
+		return &SimpleCondition{Column: column, Op: reverseComparison(op), Value: value}, nil
+	}
+
+	column, err := p.parseConditionColumn("column")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("IS") {
+		op := Equal
+		if p.acceptKeyword("NOT") {
+			op = NotEqual
+		}
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &SimpleCondition{Column: column, Op: op, Value: ""}, nil
+	}
+
+	negate := p.acceptKeyword("NOT")
+	var condition Condition
+	switch {
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.expectValue()
+		if err != nil {
+			return nil, err
+		}
+		condition = &SimpleCondition{Column: column, Op: &LikeOperator{}, Value: pattern}
+	case p.acceptKeyword("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var values []string
+		for {
+			value, err := p.expectValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		condition = &InCondition{Column: column, Values: values}
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.expectValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.expectValue()
+		if err != nil {
+			return nil, err
+		}
+		condition = &BetweenCondition{Column: column, Low: low, High: high}
+	case negate:
+		return nil, p.unexpected("LIKE, IN or BETWEEN")
+	default:
+		op, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		value, ok, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &SimpleCondition{Column: column, Op: op, Value: value}, nil
+		}
+		other, err := p.parseConditionColumn("value or column")
+		if err != nil {
+			return nil, err
+		}
+		return columnComparison(column, op, other), nil
+	}
+
+	if negate {
+		return notCondition(condition), nil
+	}
+	return condition, nil
+}
+
+func (p *sqlParser) parseComparison() (ComparisonOperator, error) {
+	token := p.peek()
+	if token.kind == sqlSymbol {
+		switch token.text {
+		case "<>":
+			p.pos++
+			return NotEqual, nil
+		case "=", "!=", "<", "<=", ">", ">=":
+			p.pos++
+			return ComparisonOperator(token.text), nil
+		}
+	}
+	return "", p.unexpected("comparison operator")
+}
+
+func reverseComparison(op ComparisonOperator) ComparisonOperator {
+	switch op {
+	case GreaterThan:
+		return LessThan
+	case GreaterThanEqual:
+		return LessThanEqual
+	case LessThan:
+		return GreaterThan
+	case LessThanEqual:
+		return GreaterThanEqual
+	}
+	return op
+}
+
+// parseValue parses a literal or a placeholder, reporting whether the next
+// token is one.
+func (p *sqlParser) parseValue() (string, bool, error) {
+	token := p.peek()
+	switch {
+	case token.kind == sqlString || token.kind == sqlNumber:
+		p.pos++
+		return token.text, true, nil
+	case token.kind == sqlSymbol && token.text == "-" && p.tokens[p.pos+1].kind == sqlNumber:
+		p.pos += 2
+		return "-" + p.tokens[p.pos-1].text, true, nil
+	case token.kind == sqlPlaceholder:
+		p.pos++
+		if p.argPos >= len(p.args) {
+			return "", false, &ErrInvalidQuery{fmt.Sprintf("missing argument for placeholder %d", p.argPos+1)}
+		}
+		value, err := sqlArgString(p.args[p.argPos])
+		if err != nil {
+			return "", false, &ErrInvalidQuery{fmt.Sprintf("argument %d: %v", p.argPos+1, err)}
+		}
+		p.argPos++
+		return value, true, nil
+	case p.isKeyword("TRUE"), p.isKeyword("FALSE"):
+		p.pos++
+		return strings.ToLower(token.text), true, nil
+	case p.isKeyword("NULL"):
+		return "", false, &ErrInvalidQuery{fmt.Sprintf("NULL at position %d can only be compared with IS NULL or IS NOT NULL", token.pos)}
+	}
+	return "", false, nil
+}
+
+func (p *sqlParser) expectValue() (string, error) {
+	value, ok, err := p.parseValue()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", p.unexpected("value")
+	}
+	return value, nil
+}
+
+func (p *sqlParser) parseCount(clause string) (int, error) {
+	token := p.peek()
+	value, err := p.expectValue()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, &ErrInvalidQuery{fmt.Sprintf("%s at position %d must be a non-negative integer, not %s", clause, token.pos, value)}
+	}
+	return n, nil
+}
+
+// parseIdent parses a single, possibly quoted, name.
+func (p *sqlParser) parseIdent(what string) (string, error) {
+	token := p.peek()
+	switch {
+	case token.kind == sqlQuotedIdent:
+	case token.kind == sqlIdent && !sqlKeywords[strings.ToUpper(token.text)]:
+	default:
+		return "", p.unexpected(what)
+	}
+	p.pos++
+	return token.text, nil
+}
+
+// parseName parses a name made of dot-separated parts, such as a column
+// qualified by its table or a column flattened from a nested JSON object.
+func (p *sqlParser) parseName(what string) (string, error) {
+	name, err := p.parseIdent(what)
+	if err != nil {
+		return "", err
+	}
+	for p.acceptSymbol(".") {
+		part, err := p.parseIdent(what)
+		if err != nil {
+			return "", err
+		}
+		name += "." + part
+	}
+	return name, nil
+}
+
+// parseConditionColumn parses a column of a WHERE condition. Unqualified
+// columns of a SELECT from a single table are qualified by it, since the
+// engine resolves unqualified columns of conditions against all registered
+// tables.
+func (p *sqlParser) parseConditionColumn(what string) (string, error) {
+	column, err := p.parseName(what)
+	if err != nil {
+		return "", err
+	}
+	if p.table != "" && !strings.HasPrefix(column, p.table+".") {
+		column = p.table + "." + column
+	}
+	return column, nil
+}
+
+// sqlArgString converts the argument of a placeholder to the string it
+// stands for. Times are written in DateFormat when they fall on midnight and
+// in DateTimeFormat otherwise, and nil stands for the empty string.
+func sqlArgString(arg interface{}) (string, error) {
+	switch v := arg.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format(DateFormat), nil
+		}
+		return v.Format(DateTimeFormat), nil
+	}
+	return "", fmt.Errorf("unsupported type %T", arg)
+}
+
+// notCondition negates condition.
+func notCondition(condition Condition) Condition {
+	negated := CustomCondition(func(row map[string][]string, tables map[string]*Table) (bool, error) {
+		ok, err := condition.Evaluate(row, tables)
+		return !ok, err
+	})
+	return &negated
+}
+
+// columnComparison compares the values of two columns.
+func columnComparison(left string, op ComparisonOperator, right string) Condition {
+	condition := CustomCondition(func(row map[string][]string, tables map[string]*Table) (bool, error) {
+		leftValue, err := columnValue(left, row, tables)
+		if err != nil {
+			return false, err
+		}
+		rightValue, err := columnValue(right, row, tables)
+		if err != nil {
+			return false, err
+		}
+		return op.Evaluate(leftValue, rightValue)
+	})
+	return &condition
+}
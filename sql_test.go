@@ -0,0 +1,117 @@
+package csvsql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSQL(t *testing.T) {
+	e := newTestEngine(t)
+
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  [][]string
+	}{
+		{
+			name:  "placeholder",
+			query: "SELECT name FROM u WHERE id = ?",
+			args:  []interface{}{2},
+			want:  [][]string{{"bob"}},
+		},
+		{
+			name:  "like and in",
+			query: "SELECT name FROM u WHERE name LIKE '%o%' OR id IN ('1', '9')",
+			want:  [][]string{{"alice"}, {"bob"}, {"carol"}},
+		},
+		{
+			name:  "between",
+			query: "SELECT name FROM u WHERE id BETWEEN ? AND '2'",
+			args:  []interface{}{"1"},
+			want:  [][]string{{"alice"}, {"bob"}},
+		},
+		{
+			name:  "is null",
+			query: "SELECT name FROM u WHERE zip IS NULL",
+			want:  [][]string{{"carol"}},
+		},
+		{
+			name:  "not and parentheses",
+			query: "SELECT name FROM u WHERE NOT (id = '1' OR id = '2') AND zip IS NULL",
+			want:  [][]string{{"carol"}},
+		},
+		{
+			name:  "quoted names",
+			query: "SELECT \"name\", `zip` FROM u WHERE id = '2'",
+			want:  [][]string{{"bob", "10001"}},
+		},
+		{
+			name:  "join",
+			query: "SELECT u.name, v.zip FROM u JOIN v ON u.id = v.id",
+			want:  [][]string{{"carol", "94105"}},
+		},
+		{
+			name:  "left join",
+			query: "SELECT u.name, v.zip FROM u LEFT JOIN v ON u.id = v.id ORDER BY u.name",
+			want:  [][]string{{"alice", ""}, {"bob", ""}, {"carol", "94105"}},
+		},
+		{
+			name:  "order by, limit and offset",
+			query: "SELECT name FROM u ORDER BY name DESC LIMIT 2 OFFSET 1",
+			want:  [][]string{{"bob"}, {"alice"}},
+		},
+		{
+			name:  "order by and limit of a union",
+			query: "SELECT id FROM u UNION SELECT id FROM v ORDER BY id DESC LIMIT 2",
+			want:  [][]string{{"5"}, {"4"}},
+		},
+		{
+			name:  "offset of a union all",
+			query: "SELECT zip FROM u UNION ALL SELECT zip FROM v ORDER BY zip LIMIT 3 OFFSET 1",
+			want:  [][]string{{"02139"}, {"10001"}, {"10001"}},
+		},
+		{
+			name:  "intersect binds tighter",
+			query: "SELECT name FROM u EXCEPT SELECT name FROM v INTERSECT SELECT name FROM u ORDER BY name;",
+			want:  [][]string{{"alice"}, {"bob"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseSQL(tt.query, tt.args...)
+			if err != nil {
+				t.Fatalf("ParseSQL: %v", err)
+			}
+			got := mustQuery(t, e, q)[1:]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSQLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+	}{
+		{"not a select", "DELETE FROM u", nil},
+		{"missing argument", "SELECT id FROM u WHERE id = ?", nil},
+		{"extra argument", "SELECT id FROM u", []interface{}{"1"}},
+		{"unsupported argument", "SELECT id FROM u WHERE id = ?", []interface{}{struct{}{}}},
+		{"trailing tokens", "SELECT id FROM u WHERE id = '1' id", nil},
+		{"unterminated string", "SELECT id FROM u WHERE name = 'bob", nil},
+		{"negative limit", "SELECT id FROM u LIMIT -1", nil},
+		{"unqualified join column", "SELECT u.id FROM u JOIN v ON id = v.id", nil},
+		{"aggregate", "SELECT COUNT(id) FROM u", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSQL(tt.query, tt.args...); err == nil {
+				t.Errorf("ParseSQL(%q) succeeded", tt.query)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package sqliteexport writes the results of csvsql queries to SQLite
+// databases. It is kept apart from csvsql so that only programs exporting to
+// SQLite link the SQLite driver, which registers itself as "sqlite" with
+// database/sql when this package is imported. Programs that also import
+// another driver registering that name, such as github.com/glebarez/go-sqlite,
+// cannot import this package, as database/sql panics when a name is
+// registered twice.
+package sqliteexport
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gobylor/csvsql"
+
+	// The pure-Go driver keeps the package buildable without cgo.
+	_ "modernc.org/sqlite"
+)
+
+// Export writes the results of q, run by e, to a new table of the SQLite
+// database at dbPath, which is created if it does not exist. Column types are
+// derived like those of Engine.ExportToXLSX: integer and boolean columns
+// become INTEGER, float columns REAL, and all others, including dates, TEXT
+// holding the values as they are. Empty values become NULL. The table is
+// created and filled in one transaction, so it either holds all rows or does
+// not exist.
+func Export(e *csvsql.Engine, q *csvsql.Query, dbPath, tableName string) error {
+	return ExportContext(context.Background(), e, q, dbPath, tableName)
+}
+
+// ExportContext is like Export but stops once ctx is done, both while running
+// the query and while inserting the rows.
+func ExportContext(ctx context.Context, e *csvsql.Engine, q *csvsql.Query, dbPath, tableName string) error {
+	if dbPath == "" {
+		return fmt.Errorf("database path cannot be empty")
+	}
+	if tableName == "" {
+		return fmt.Errorf("table name cannot be empty")
+	}
+
+	results, types, err := e.ExecuteQueryWithTypesContext(ctx, q)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	if len(results) == 0 || len(results[0]) == 0 {
+		return fmt.Errorf("query has no columns")
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	headers := results[0]
+	columns := make([]string, len(headers))
+	placeholders := make([]string, len(headers))
+	for i, header := range headers {
+		columns[i] = quoteSQLiteIdentifier(header) + " " + sqliteColumnType(types[i])
+		placeholders[i] = "?"
+	}
+
+	create := fmt.Sprintf("CREATE TABLE %s (%s)", quoteSQLiteIdentifier(tableName), strings.Join(columns, ", "))
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", tableName, err)
+	}
+
+	insert, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)",
+		quoteSQLiteIdentifier(tableName), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer insert.Close()
+
+	args := make([]interface{}, len(headers))
+	for _, row := range results[1:] {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for col := range args {
+			var value string
+			if col < len(row) {
+				value = row[col]
+			}
+			args[col] = sqliteValue(value, types[col])
+		}
+		if _, err := insert.ExecContext(ctx, args...); err != nil {
+			return fmt.Errorf("failed to insert row: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func sqliteColumnType(typ csvsql.ColumnType) string {
+	switch typ {
+	case csvsql.IntegerColumn, csvsql.BooleanColumn:
+		return "INTEGER"
+	case csvsql.FloatColumn:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// sqliteValue converts a value of a column of type typ to the value bound to
+// the insert statement. Values that do not fit the type are stored as text.
+func sqliteValue(value string, typ csvsql.ColumnType) interface{} {
+	if value == "" {
+		return nil
+	}
+	switch typ {
+	case csvsql.IntegerColumn:
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case csvsql.FloatColumn:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case csvsql.BooleanColumn:
+		if v, err := strconv.ParseBool(value); err == nil {
+			if v {
+				return int64(1)
+			}
+			return int64(0)
+		}
+	}
+	return value
+}
+
+func quoteSQLiteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
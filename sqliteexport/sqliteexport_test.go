@@ -0,0 +1,66 @@
+package sqliteexport
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gobylor/csvsql"
+)
+
+func TestExport(t *testing.T) {
+	e := csvsql.NewEngine()
+	data := "{\"id\": 1, \"score\": 9.5, \"ok\": true, \"code\": \"007\"}\n{\"id\": 2, \"score\": null, \"ok\": false, \"code\": \"012\"}\n"
+	if err := e.CreateTableFromReader("t", strings.NewReader(data), "ndjson", csvsql.TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	q, err := csvsql.NewQuery().Select("id", "score", "ok", "code").From("t").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.db")
+	if err := Export(e, q, path, "my table"); err != nil {
+		t.Fatal(err)
+	}
+	// The table must not exist yet.
+	if err := Export(e, q, path, "my table"); err == nil {
+		t.Error("exporting to an existing table succeeded")
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, typeof(id), score, typeof(score), ok, code, typeof(code) FROM "my table" ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, 7)
+		ptrs := make([]interface{}, len(row))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{
+		{int64(1), "integer", 9.5, "real", int64(1), "007", "text"},
+		{int64(2), "integer", nil, "null", int64(0), "012", "text"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,230 @@
+package csvsql
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewTableFromRows returns a table holding copies of headers and rows. Every
+// row must have one value per header.
+func NewTableFromRows(name string, headers []string, rows [][]string) (*Table, error) {
+	headers = append([]string(nil), headers...)
+	copied := make([][]string, len(rows))
+	for i, row := range rows {
+		if len(row) != len(headers) {
+			return nil, fmt.Errorf("row %d has %d values, expected %d", i+1, len(row), len(headers))
+		}
+		copied[i] = append([]string(nil), row...)
+	}
+
+	headerMap := make(map[string]int)
+	for i, header := range headers {
+		headerMap[strings.ToLower(header)] = i
+	}
+
+	return &Table{
+		Name:      name,
+		Headers:   headers,
+		Rows:      copied,
+		HeaderMap: headerMap,
+	}, nil
+}
+
+// NewTableFromStructs returns a table with one row per element of records,
+// which must be a slice of structs or of pointers to structs. Every exported
+// field becomes a column named by its csvsql tag, or by the field name when
+// it has none; fields tagged "-" are skipped. Fields of embedded structs are
+// promoted and other struct fields are flattened into dotted names such as
+// address.city, as for JSON sources. A struct field of a type that is already
+// being flattened, such as the next node of a linked list, is not flattened
+// again but stored as JSON text.
+//
+// Integers, floats, booleans and time.Time values give typed columns, times
+// being formatted with DateTimeFormat. Values implementing
+// encoding.TextMarshaler are stored as their text, and any other value that is
+// not a string as JSON text. Nil pointers become empty values.
+func NewTableFromStructs(name string, records any) (*Table, error) {
+	value := reflect.ValueOf(records)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, fmt.Errorf("records must be a slice of structs, got %T", records)
+	}
+
+	elem := value.Type().Elem()
+	if elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("records must be a slice of structs, got %T", records)
+	}
+
+	var fields []structField
+	collectStructFields(elem, nil, "", map[reflect.Type]bool{}, &fields)
+
+	headers := make([]string, len(fields))
+	types := make([]ColumnType, len(fields))
+	headerMap := make(map[string]int)
+	for i, field := range fields {
+		headers[i] = field.name
+		types[i] = field.typ
+		headerMap[strings.ToLower(field.name)] = i
+	}
+
+	rows := make([][]string, value.Len())
+	cells := make([]string, value.Len()*len(fields))
+	for i := range rows {
+		row := cells[i*len(fields) : (i+1)*len(fields) : (i+1)*len(fields)]
+		record := value.Index(i)
+		for col, field := range fields {
+			text, err := field.format(record)
+			if err != nil {
+				return nil, fmt.Errorf("record %d field %s error: %w", i+1, field.name, err)
+			}
+			row[col] = text
+		}
+		rows[i] = row
+	}
+
+	return &Table{
+		Name:      name,
+		Headers:   headers,
+		Rows:      rows,
+		HeaderMap: headerMap,
+		Types:     types,
+	}, nil
+}
+
+// structField is a column of a table created from structs. index is the path
+// of field indexes from the record to the field.
+type structField struct {
+	name  string
+	index []int
+	typ   ColumnType
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// collectStructFields appends the columns of the fields of t to fields.
+// flattening holds the struct types on the path from the record to t, whose
+// fields are not flattened again.
+func collectStructFields(t reflect.Type, index []int, prefix string, flattening map[reflect.Type]bool, fields *[]structField) {
+	flattening[t] = true
+	defer delete(flattening, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("csvsql")
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		nested := fieldType.Kind() == reflect.Struct && fieldType != timeType &&
+			!reflect.PointerTo(fieldType).Implements(textMarshalerType)
+		recursive := nested && flattening[fieldType]
+		// Like encoding/json, the exported fields of an embedded struct
+		// of an unexported type are promoted.
+		if tag == "-" || (!field.IsExported() && !(field.Anonymous && nested && !recursive)) {
+			continue
+		}
+
+		path := append(append([]int(nil), index...), i)
+		if field.Anonymous && tag == "" && !recursive {
+			if nested {
+				collectStructFields(fieldType, path, prefix, flattening, fields)
+			}
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = field.Name
+		}
+		if nested && !recursive {
+			collectStructFields(fieldType, path, prefix+name+".", flattening, fields)
+			continue
+		}
+		*fields = append(*fields, structField{name: prefix + name, index: path, typ: structColumnType(fieldType)})
+	}
+}
+
+func structColumnType(t reflect.Type) ColumnType {
+	if t == timeType {
+		return DateTimeColumn
+	}
+	if reflect.PointerTo(t).Implements(textMarshalerType) {
+		return StringColumn
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return IntegerColumn
+	case reflect.Float32, reflect.Float64:
+		return FloatColumn
+	case reflect.Bool:
+		return BooleanColumn
+	default:
+		return StringColumn
+	}
+}
+
+// format returns the value of the field in record, or an empty value when a
+// pointer on its path is nil.
+func (f *structField) format(record reflect.Value) (string, error) {
+	v := record
+	for _, i := range f.index {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return "", nil
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(DateTimeFormat), nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		text, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return "", nil
+		}
+	}
+
+	text, err := json.Marshal(v.Interface())
+	return string(text), err
+}
@@ -0,0 +1,150 @@
+package csvsql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type structTestLevel int
+
+func (l structTestLevel) MarshalText() ([]byte, error) {
+	return []byte(strings.Repeat("*", int(l))), nil
+}
+
+type structTestAddress struct {
+	City string `csvsql:"city"`
+	Zip  string
+}
+
+type structTestBase struct {
+	ID int64 `csvsql:"id"`
+}
+
+type structTestRecord struct {
+	structTestBase
+	Name     string `csvsql:"name"`
+	Secret   string `csvsql:"-"`
+	hidden   string
+	Score    float64            `csvsql:"score"`
+	Active   bool               `csvsql:"active"`
+	Created  time.Time          `csvsql:"created"`
+	Level    structTestLevel    `csvsql:"level"`
+	Home     structTestAddress  `csvsql:"home"`
+	Work     *structTestAddress `csvsql:"work"`
+	Nickname *string            `csvsql:"nickname"`
+	Tags     []string           `csvsql:"tags"`
+}
+
+func TestNewTableFromStructs(t *testing.T) {
+	nickname := "al"
+	records := []*structTestRecord{
+		{
+			structTestBase: structTestBase{ID: 1},
+			Name:           "alice",
+			Secret:         "x",
+			hidden:         "y",
+			Score:          9.5,
+			Active:         true,
+			Created:        time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+			Level:          3,
+			Home:           structTestAddress{City: "Paris", Zip: "75001"},
+			Work:           &structTestAddress{City: "Lyon"},
+			Nickname:       &nickname,
+			Tags:           []string{"a", "b"},
+		},
+		{structTestBase: structTestBase{ID: 2}, Name: "bob"},
+	}
+	table, err := NewTableFromStructs("t", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := []string{"id", "name", "score", "active", "created", "level", "home.city", "home.Zip", "work.city", "work.Zip", "nickname", "tags"}
+	if !reflect.DeepEqual(table.Headers, headers) {
+		t.Errorf("headers = %q, want %q", table.Headers, headers)
+	}
+	types := []ColumnType{
+		IntegerColumn, StringColumn, FloatColumn, BooleanColumn, DateTimeColumn, StringColumn,
+		StringColumn, StringColumn, StringColumn, StringColumn, StringColumn, StringColumn,
+	}
+	if !reflect.DeepEqual(table.Types, types) {
+		t.Errorf("types = %v, want %v", table.Types, types)
+	}
+	rows := [][]string{
+		{"1", "alice", "9.5", "true", "2024-03-01 12:30:00", "***", "Paris", "75001", "Lyon", "", "al", `["a","b"]`},
+		{"2", "bob", "0", "false", "0001-01-01 00:00:00", "", "", "", "", "", "", ""},
+	}
+	if !reflect.DeepEqual(table.Rows, rows) {
+		t.Errorf("rows = %q, want %q", table.Rows, rows)
+	}
+}
+
+type structTestNode struct {
+	Name string
+	Next *structTestNode
+}
+
+type structTestTree struct {
+	Value    int
+	Children []structTestTree
+	Left     *structTestTree
+}
+
+func TestNewTableFromRecursiveStructs(t *testing.T) {
+	nodes := []structTestNode{{Name: "a"}, {Name: "b", Next: &structTestNode{Name: "c"}}}
+	table, err := NewTableFromStructs("n", nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Name", "Next"}; !reflect.DeepEqual(table.Headers, want) {
+		t.Errorf("headers = %q, want %q", table.Headers, want)
+	}
+	rows := [][]string{{"a", ""}, {"b", `{"Name":"c","Next":null}`}}
+	if !reflect.DeepEqual(table.Rows, rows) {
+		t.Errorf("rows = %q, want %q", table.Rows, rows)
+	}
+
+	trees := []structTestTree{{Value: 1, Left: &structTestTree{Value: 2}}}
+	table, err = NewTableFromStructs("t", trees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Value", "Children", "Left"}; !reflect.DeepEqual(table.Headers, want) {
+		t.Errorf("headers = %q, want %q", table.Headers, want)
+	}
+}
+
+func TestCreateTableFromStructs(t *testing.T) {
+	e := NewEngine()
+	if err := e.CreateTableFromStructs("n", []structTestNode{{Name: "a"}, {Name: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	assertColumn(t, mustQuery(t, e, mustBuild(t, NewQuery().Select("Name").From("n").Where("Name", "=", "b"))), 0, []string{"b"})
+
+	for _, records := range []any{nil, 1, []int{1}, structTestNode{}} {
+		if err := e.CreateTableFromStructs("bad", records); err == nil {
+			t.Errorf("CreateTableFromStructs(%T) succeeded", records)
+		}
+	}
+}
+
+func TestCreateTableFromRows(t *testing.T) {
+	e := NewEngine()
+	rows := [][]string{{"1", "alice"}}
+	if err := e.CreateTableFromRows("t", []string{"id", "name"}, rows); err != nil {
+		t.Fatal(err)
+	}
+	// The rows are copied.
+	rows[0][1] = "changed"
+	assertColumn(t, mustQuery(t, e, mustBuild(t, NewQuery().Select("name").From("t"))), 0, []string{"alice"})
+
+	err := e.CreateTableFromRows("short", []string{"id", "name"}, [][]string{{"1", "alice"}, {"2"}})
+	if err == nil || !strings.Contains(err.Error(), "row 2 has 1 values, expected 2") {
+		t.Errorf("err = %v, want the short row reported", err)
+	}
+	if err := e.CreateTableFromRows("t", []string{"id"}, nil); err == nil {
+		t.Error("CreateTableFromRows replaced an existing table")
+	}
+}
@@ -1,13 +1,12 @@
 package csvsql
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
-	"os"
+	"io"
 	"strings"
 	"unicode/utf8"
-
-	"github.com/xuri/excelize/v2"
 )
 
 type Table struct {
@@ -15,91 +14,210 @@ type Table struct {
 	Headers   []string
 	Rows      [][]string
 	HeaderMap map[string]int
+	// Types holds the type of every column; nil means all columns are
+	// strings.
+	Types []ColumnType
+	// Dialect is the dialect a CSV file read with SniffOptions was found to
+	// have; it is nil for other tables.
+	Dialect *Dialect
+
+	source tableSource
+}
+
+// CSVOptions control how delimited text files are parsed. The zero value
+// reads comma-separated files whose first line is the header row.
+type CSVOptions struct {
+	// Delimiter separates fields. It defaults to ',' and to a tab for .tsv
+	// files.
+	Delimiter rune
+	// Quote encloses fields containing delimiters, quotes or line breaks. It
+	// defaults to '"'; another ASCII character such as '\'' may be used.
+	Quote rune
+	// Comment, if set, marks lines starting with it as comments to ignore.
+	Comment rune
+	// LazyQuotes allows quotes in unquoted fields and unescaped quotes in
+	// quoted fields.
+	LazyQuotes bool
+	// TrimLeadingSpace ignores leading white space in fields.
+	TrimLeadingSpace bool
+	// NoHeader reads the first row as data. Columns are then named by
+	// ColumnNames or, when it is empty, column1, column2 and so on.
+	NoHeader bool
+	// ColumnNames names the columns, replacing the header row if there is one.
+	ColumnNames []string
+	// SkipRows is the number of lines skipped before the header row, such as
+	// a title or notes preceding the data.
+	SkipRows int
+	// Encoding is the character encoding of the file, which is transcoded to
+	// UTF-8. Files starting with a UTF-16 byte order mark are read as UTF-16
+	// unless another encoding is set; without either, bytes are read as
+	// UTF-8 unchanged.
+	Encoding Encoding
+	// EncodingErrors selects how byte sequences invalid in Encoding are
+	// handled.
+	EncodingErrors EncodingErrorMode
+	// Sniff, if set, detects the dialect of the file before reading it.
+	Sniff *SniffOptions
 }
 
 func NewTableFromCSV(name, filepath string) (*Table, error) {
-	file, err := os.Open(filepath)
+	return NewTableFromCSVWithOptions(name, filepath, CSVOptions{})
+}
+
+// NewTableFromCSVWithOptions loads a delimited text file parsed according to
+// opts.
+func NewTableFromCSVWithOptions(name, filepath string, opts CSVOptions) (*Table, error) {
+	file, _, err := openDecompressed(filepath)
 	if err != nil {
 		return nil, fmt.Errorf("open file error: %w", err)
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
+	return newTableFromCSVReader(name, file, opts)
+}
 
-	headers, err := reader.Read()
-	if err != nil {
-		return nil, fmt.Errorf("read headers error: %w", err)
-	}
+func newTableFromCSVReader(name string, r io.Reader, opts CSVOptions) (*Table, error) {
+	return readCSV(name, r, opts, -1, &csvProgress{})
+}
 
-	headerMap := make(map[string]int)
-	for i, header := range headers {
-		headerMap[strings.ToLower(header)] = i
+// csvProgress reports how far readCSV read. complete is set when all rows
+// were read; headerBytes and bytes are the input consumed by the header row
+// and by the rows after it.
+type csvProgress struct {
+	complete    bool
+	headerBytes int64
+	bytes       int64
+}
+
+// readCSV reads the header row and at most limit rows, or all rows when limit
+// is negative, recording how far it read in progress.
+func readCSV(name string, r io.Reader, opts CSVOptions, limit int, progress *csvProgress) (*Table, error) {
+	if opts.SkipRows < 0 {
+		return nil, fmt.Errorf("skip rows cannot be negative")
 	}
 
-	rows, err := reader.ReadAll()
+	size := 4096
+	if opts.Sniff != nil {
+		size = opts.Sniff.SampleSize
+		if size <= 0 {
+			size = defaultSniffSize
+		}
+	}
+	decoded, encoding, utf16BOM, err := decodeReader(r, opts)
 	if err != nil {
-		return nil, fmt.Errorf("read rows error: %w", err)
+		return nil, err
+	}
+	buffered := bufio.NewReaderSize(decoded, size)
+	bom := skipBOM(buffered) || utf16BOM
+	for i := 0; i < opts.SkipRows; i++ {
+		if _, err := buffered.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("skip rows error: %w", err)
+		}
 	}
 
-	return &Table{
-		Name:      name,
-		Headers:   headers,
-		Rows:      rows,
-		HeaderMap: headerMap,
-	}, nil
-}
-
-func NewTableFromXlsx(name, filepath string, sheetName ...string) (*Table, error) {
-	f, err := excelize.OpenFile(filepath)
-	if err != nil {
-		return nil, fmt.Errorf("open xlsx file error: %w", err)
+	var dialect *Dialect
+	if opts.Sniff != nil {
+		sample, err := buffered.Peek(size)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("sniff error: %w", err)
+		}
+		dialect = sniffDialect(sample, err == io.EOF, opts)
+		dialect.BOM, dialect.Encoding = bom, encoding
+		opts.Delimiter, opts.Quote, opts.NoHeader = dialect.Delimiter, dialect.Quote, !dialect.HasHeader
 	}
-	defer f.Close()
 
-	targetSheet := f.GetSheetList()[0]
+	var source io.Reader = buffered
+	if opts.Quote == 0 {
+		opts.Quote = '"'
+	}
+	if opts.Quote != '"' {
+		if opts.Quote >= utf8.RuneSelf || opts.Quote == opts.Delimiter || opts.Quote == opts.Comment ||
+			opts.Delimiter == '"' || opts.Comment == '"' || opts.Quote == '\r' || opts.Quote == '\n' {
+			return nil, fmt.Errorf("invalid quote character %q", opts.Quote)
+		}
+		source = &quoteSwapReader{r: buffered, quote: byte(opts.Quote)}
+	}
 
-	if len(sheetName) > 0 {
-		targetSheet = sheetName[0]
+	reader := csv.NewReader(source)
+	if opts.Delimiter != 0 {
+		reader.Comma = opts.Delimiter
 	}
-	if utf8.RuneCountInString(targetSheet) > 31 {
-		runes := []rune(targetSheet)
-		targetSheet = string(runes[:31])
+	reader.Comment = opts.Comment
+	reader.LazyQuotes = opts.LazyQuotes
+	reader.TrimLeadingSpace = opts.TrimLeadingSpace
+
+	if !opts.NoHeader {
+		headers, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("read headers error: %w", err)
+		}
+		if opts.Quote != '"' {
+			swapQuotes([][]string{headers}, byte(opts.Quote))
+		}
+		if len(opts.ColumnNames) == 0 {
+			opts.ColumnNames = headers
+		} else if len(opts.ColumnNames) != len(headers) {
+			return nil, fmt.Errorf("expected %d column names, got %d", len(headers), len(opts.ColumnNames))
+		}
 	}
 
-	rows, err := f.GetRows(targetSheet)
-	if err != nil {
-		return nil, fmt.Errorf("read xlsx rows error: %w", err)
+	progress.headerBytes = reader.InputOffset()
+	var rows [][]string
+	for limit < 0 || len(rows) < limit {
+		row, err := reader.Read()
+		if err == io.EOF {
+			progress.complete = true
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read rows error: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	progress.bytes = reader.InputOffset() - progress.headerBytes
+	if opts.Quote != '"' {
+		swapQuotes(rows, byte(opts.Quote))
 	}
 
-	if len(rows) == 0 {
-		return nil, fmt.Errorf("xlsx file is empty")
+	headers := opts.ColumnNames
+	if opts.NoHeader {
+		width := len(headers)
+		if len(rows) > 0 {
+			width = len(rows[0])
+		}
+		if len(headers) == 0 {
+			headers = generatedColumnNames(width)
+		} else if len(headers) != width {
+			return nil, fmt.Errorf("expected %d column names, got %d", width, len(headers))
+		}
 	}
 
-	headers := rows[0]
 	headerMap := make(map[string]int)
 	for i, header := range headers {
 		headerMap[strings.ToLower(header)] = i
 	}
 
-	dataRows := make([][]string, 0, len(rows)-1)
-	for _, row := range rows[1:] {
-		normalizedRow := make([]string, len(headers))
-		for i := range normalizedRow {
-			if i < len(row) {
-				normalizedRow[i] = row[i]
-			}
-		}
-		dataRows = append(dataRows, normalizedRow)
-	}
-
 	return &Table{
 		Name:      name,
 		Headers:   headers,
-		Rows:      dataRows,
+		Rows:      rows,
 		HeaderMap: headerMap,
+		Dialect:   dialect,
 	}, nil
 }
 
+// generatedColumnNames names the columns of a file without a header row.
+func generatedColumnNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("column%d", i+1)
+	}
+	return names
+}
+
 func (t *Table) GetColumnIndex(column string) (int, error) {
 	if idx, ok := t.HeaderMap[strings.ToLower(column)]; ok {
 		return idx, nil
@@ -0,0 +1,139 @@
+package csvsql
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		opts    CSVOptions
+		headers []string
+		rows    [][]string
+	}{
+		{
+			name:    "defaults",
+			data:    "id,note\n1,\"a, b\"\n2,\"say \"\"hi\"\"\"\n",
+			headers: []string{"id", "note"},
+			rows:    [][]string{{"1", "a, b"}, {"2", `say "hi"`}},
+		},
+		{
+			name:    "delimiter",
+			data:    "id;name\n1;alice\n",
+			opts:    CSVOptions{Delimiter: ';'},
+			headers: []string{"id", "name"},
+			rows:    [][]string{{"1", "alice"}},
+		},
+		{
+			name:    "quote",
+			data:    "id,note\n1,'a, b'\n2,'it''s'\n",
+			opts:    CSVOptions{Quote: '\''},
+			headers: []string{"id", "note"},
+			rows:    [][]string{{"1", "a, b"}, {"2", "it's"}},
+		},
+		{
+			name:    "comment",
+			data:    "# exported today\nid,name\n1,alice\n# 2,bob\n",
+			opts:    CSVOptions{Comment: '#'},
+			headers: []string{"id", "name"},
+			rows:    [][]string{{"1", "alice"}},
+		},
+		{
+			name:    "lazy quotes",
+			data:    "id,note\n1,a \"b\" c\n",
+			opts:    CSVOptions{LazyQuotes: true},
+			headers: []string{"id", "note"},
+			rows:    [][]string{{"1", `a "b" c`}},
+		},
+		{
+			name:    "trim leading space",
+			data:    "id, name\n1,  alice\n",
+			opts:    CSVOptions{TrimLeadingSpace: true},
+			headers: []string{"id", "name"},
+			rows:    [][]string{{"1", "alice"}},
+		},
+		{
+			name:    "no header",
+			data:    "1,alice\n2,bob\n",
+			opts:    CSVOptions{NoHeader: true},
+			headers: []string{"column1", "column2"},
+			rows:    [][]string{{"1", "alice"}, {"2", "bob"}},
+		},
+		{
+			name:    "column names replace header",
+			data:    "a,b\n1,alice\n",
+			opts:    CSVOptions{ColumnNames: []string{"id", "name"}},
+			headers: []string{"id", "name"},
+			rows:    [][]string{{"1", "alice"}},
+		},
+		{
+			name:    "skip rows",
+			data:    "Sales report\n\nid,name\n1,alice\n",
+			opts:    CSVOptions{SkipRows: 2},
+			headers: []string{"id", "name"},
+			rows:    [][]string{{"1", "alice"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := newTableFromCSVReader("t", strings.NewReader(tt.data), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(table.Headers, tt.headers) {
+				t.Errorf("headers = %q, want %q", table.Headers, tt.headers)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) {
+				t.Errorf("rows = %q, want %q", table.Rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestInvalidCSVOptions(t *testing.T) {
+	for _, opts := range []CSVOptions{
+		{SkipRows: -1},
+		{Quote: ','},
+		{Delimiter: '"', Quote: '\''},
+	} {
+		if _, err := newTableFromCSVReader("t", strings.NewReader("a,b\n1,2\n"), opts); err == nil {
+			t.Errorf("options %+v were accepted", opts)
+		}
+	}
+}
+
+func TestTSV(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.tsv")
+	if err := os.WriteFile(path, []byte("id\tname\n1\talice, jr\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	semicolons := filepath.Join(dir, "semicolons.tsv")
+	if err := os.WriteFile(semicolons, []byte("id;name\n1;alice, jr\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEngine()
+	if err := e.CreateTable("file", path); err != nil {
+		t.Fatal(err)
+	}
+	data := "id\tname\n1\talice, jr\n"
+	if err := e.CreateTableFromReader("reader", strings.NewReader(data), "tsv", TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	opts := TableOptions{CSV: CSVOptions{Delimiter: ';'}}
+	if err := e.CreateTableWithOptions("delimited", semicolons, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alias := range []string{"file", "reader", "delimited"} {
+		results := mustQuery(t, e, mustBuild(t, NewQuery().Select("name").From(alias)))
+		assertColumn(t, results, 0, []string{"alice, jr"})
+	}
+}
@@ -0,0 +1,199 @@
+package csvsql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is the type of the values in a column. Values are stored as
+// strings whatever their type; the type records how typed sources such as
+// JSON or Parquet files represented them, so that they can be converted
+// back, for example by exports.
+type ColumnType int
+
+const (
+	StringColumn ColumnType = iota
+	IntegerColumn
+	FloatColumn
+	BooleanColumn
+	// DateColumn values use DateFormat and DateTimeColumn values use
+	// DateTimeFormat.
+	DateColumn
+	DateTimeColumn
+)
+
+func (t ColumnType) String() string {
+	switch t {
+	case StringColumn:
+		return "STRING"
+	case IntegerColumn:
+		return "INTEGER"
+	case FloatColumn:
+		return "FLOAT"
+	case BooleanColumn:
+		return "BOOLEAN"
+	case DateColumn:
+		return "DATE"
+	case DateTimeColumn:
+		return "DATETIME"
+	default:
+		return fmt.Sprintf("ColumnType(%d)", int(t))
+	}
+}
+
+// ColumnType returns the type of column. Tables loaded from sources without
+// type information, such as CSV files, only have string columns.
+func (t *Table) ColumnType(column string) (ColumnType, error) {
+	idx, err := t.GetColumnIndex(column)
+	if err != nil {
+		return StringColumn, err
+	}
+	if idx >= len(t.Types) {
+		return StringColumn, nil
+	}
+	return t.Types[idx], nil
+}
+
+// resultColumnTypes returns the types of the columns of results, the result
+// of q including its header row. Columns read from typed table columns keep
+// their type, and other columns are typed as integers, floats, dates or
+// datetimes when all their values are written that way. A declared type that
+// does not fit every value of the column falls back to StringColumn. It must
+// be called on the snapshot q ran on, so that the tables are those the
+// results were read from.
+func (e *Engine) resultColumnTypes(q *Query, results [][]string) []ColumnType {
+	if len(results) == 0 {
+		return nil
+	}
+	declared, known := e.declaredColumnTypes(q, len(results[0]))
+
+	types := make([]ColumnType, len(declared))
+	for col := range types {
+		if known[col] {
+			types[col] = StringColumn
+			if columnFits(results[1:], col, declared[col]) {
+				types[col] = declared[col]
+			}
+			continue
+		}
+		types[col] = inferColumnType(results[1:], col)
+	}
+	return types
+}
+
+// declaredColumnTypes returns the types the tables declare for the width
+// result columns of q, and which of them are known. A column is known when it
+// is read from a table column, in every operand of a set operation with the
+// same type; the type of other columns is StringColumn.
+func (e *Engine) declaredColumnTypes(q *Query, width int) ([]ColumnType, []bool) {
+	declared := make([]ColumnType, width)
+	known := make([]bool, width)
+
+	if q.From != nil && q.Select != nil {
+		if columns, _, err := e.outputColumns(q); err == nil && len(columns) <= width {
+			for i, column := range columns {
+				// Resolve names the way projection does, preferring the
+				// table the query reads from.
+				tableName, colName := splitColumn(column, e.tables)
+				if tableName == "" {
+					tableName = e.findTableForColumn(colName, q.From.Table)
+				}
+				table, ok := e.tables[tableName]
+				if !ok {
+					continue
+				}
+				if colIdx, err := table.GetColumnIndex(colName); err == nil && colIdx < len(table.Types) {
+					declared[i], known[i] = table.Types[colIdx], true
+				}
+			}
+		}
+	}
+
+	if q.Union != nil {
+		for _, op := range q.Union.operations() {
+			types, ok := e.declaredColumnTypes(op.Query, width)
+			for i := range known {
+				if !ok[i] || types[i] != declared[i] {
+					declared[i], known[i] = StringColumn, false
+				}
+			}
+		}
+	}
+	return declared, known
+}
+
+// inferColumnType returns the type written by all non-empty values of
+// column col of rows, or StringColumn when there is none. Numbers must be in
+// plain decimal notation without leading zeros, so that codes such as 007
+// stay strings.
+func inferColumnType(rows [][]string, col int) ColumnType {
+	candidates := []ColumnType{IntegerColumn, FloatColumn, DateColumn, DateTimeColumn}
+	seen := false
+	for _, row := range rows {
+		if col >= len(row) || row[col] == "" {
+			continue
+		}
+		seen = true
+		kept := candidates[:0]
+		for _, typ := range candidates {
+			numeric := typ == IntegerColumn || typ == FloatColumn
+			if valueFits(row[col], typ) && (!numeric || isCanonicalNumber(row[col])) {
+				kept = append(kept, typ)
+			}
+		}
+		if candidates = kept; len(candidates) == 0 {
+			return StringColumn
+		}
+	}
+	if !seen {
+		return StringColumn
+	}
+	return candidates[0]
+}
+
+func columnFits(rows [][]string, col int, typ ColumnType) bool {
+	for _, row := range rows {
+		if col < len(row) && row[col] != "" && !valueFits(row[col], typ) {
+			return false
+		}
+	}
+	return true
+}
+
+// valueFits reports whether value is written the way values of typ are.
+func valueFits(value string, typ ColumnType) bool {
+	switch typ {
+	case IntegerColumn:
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case FloatColumn:
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	case BooleanColumn:
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	case DateColumn:
+		_, err := time.Parse(DateFormat, value)
+		return err == nil
+	case DateTimeColumn:
+		_, err := time.Parse(DateTimeFormat, value)
+		return err == nil
+	default:
+		return true
+	}
+}
+
+func isCanonicalNumber(value string) bool {
+	digits := strings.TrimPrefix(value, "-")
+	if digits == "" || digits[0] == '.' || (len(digits) > 1 && digits[0] == '0' && digits[1] != '.') {
+		return false
+	}
+	for _, c := range digits {
+		if (c < '0' || c > '9') && c != '.' {
+			return false
+		}
+	}
+	return true
+}
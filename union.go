@@ -1,15 +1,52 @@
 package csvsql
 
+import "fmt"
+
 type UnionType string
 
 const (
-	Union    UnionType = "UNION"
-	UnionAll UnionType = "UNION ALL"
+	Union        UnionType = "UNION"
+	UnionAll     UnionType = "UNION ALL"
+	Intersect    UnionType = "INTERSECT"
+	IntersectAll UnionType = "INTERSECT ALL"
+	Except       UnionType = "EXCEPT"
+	ExceptAll    UnionType = "EXCEPT ALL"
 )
 
+func (t UnionType) isValid() bool {
+	switch t {
+	case Union, UnionAll, Intersect, IntersectAll, Except, ExceptAll:
+		return true
+	}
+	return false
+}
+
+// precedence follows standard SQL: INTERSECT binds tighter than UNION and EXCEPT.
+func (t UnionType) precedence() int {
+	if t == Intersect || t == IntersectAll {
+		return 2
+	}
+	return 1
+}
+
+// SetOperation is one operand of a chained set operation together with the
+// operator that combines it with everything to its left.
+type SetOperation struct {
+	Kind  UnionType
+	Query *Query
+}
+
+// UnionComponent holds the set operations applied to a query, in the order
+// they were chained.
 type UnionComponent struct {
+	Operations []*SetOperation
+
+	// Deprecated: UnionKind and Queries describe a chain of operations that
+	// all share one kind. They are only read when Operations is empty, and
+	// the query builder no longer sets them; use Operations instead.
 	UnionKind UnionType
-	Queries   []*Query
+	// Deprecated: see UnionKind.
+	Queries []*Query
 }
 
 func (u *UnionComponent) Type() string {
@@ -17,42 +54,110 @@ func (u *UnionComponent) Type() string {
 }
 
 func (u *UnionComponent) Validate() error {
-	if len(u.Queries) == 0 {
+	operations := u.operations()
+	if len(operations) == 0 {
 		return &ErrInvalidQuery{"UNION must have at least one query"}
 	}
+	for _, op := range operations {
+		if !op.Kind.isValid() {
+			return &ErrInvalidQuery{fmt.Sprintf("unsupported set operation: %s", op.Kind)}
+		}
+		if op.Query == nil {
+			return &ErrInvalidQuery{fmt.Sprintf("%s must have a query", op.Kind)}
+		}
+	}
 	return nil
 }
 
-func (qb *QueryBuilder) Union(other *QueryBuilder) *QueryBuilder {
-	if qb.err != nil {
-		return qb
+// operations returns the chained operations, building them from the
+// deprecated UnionKind and Queries fields when Operations is empty. A missing
+// UnionKind defaults to UNION.
+func (u *UnionComponent) operations() []*SetOperation {
+	if len(u.Operations) > 0 || len(u.Queries) == 0 {
+		return u.Operations
 	}
-	if other == nil {
-		qb.err = &ErrInvalidQuery{"cannot UNION with no queries"}
-		return qb
+	kind := u.UnionKind
+	if kind == "" {
+		kind = Union
 	}
-	otherQuery, err := other.Build()
-	if err != nil {
-		qb.err = err
-		return qb
+	operations := make([]*SetOperation, len(u.Queries))
+	for i, query := range u.Queries {
+		operations[i] = &SetOperation{Kind: kind, Query: query}
 	}
-	if qb.query.Union == nil {
-		qb.query.Union = &UnionComponent{
-			UnionKind: Union,
-			Queries:   []*Query{otherQuery},
+	return operations
+}
+
+// setOperationNode is a node of the evaluation tree built from the flat list
+// of operations. Leaves hold a planned operand, inner nodes combine their
+// children. node is the plan node reporting on this part of the tree.
+type setOperationNode struct {
+	kind  UnionType
+	left  *setOperationNode
+	right *setOperationNode
+	stmt  *statementPlan
+	rows  [][]string
+	node  *PlanNode
+}
+
+// buildTree arranges base and the operands of the chained operations into a
+// tree honouring operator precedence, with operators of equal precedence
+// associating left.
+func (u *UnionComponent) buildTree(base *setOperationNode, operands []*setOperationNode) *setOperationNode {
+	var root *setOperationNode
+	var rootKind UnionType
+	term := base
+
+	for i, op := range u.operations() {
+		operand := operands[i]
+		if op.Kind.precedence() > 1 {
+			term = &setOperationNode{kind: op.Kind, left: term, right: operand}
+			continue
 		}
-	} else {
-		qb.query.Union.Queries = append(qb.query.Union.Queries, otherQuery)
+		root = combineSetNodes(root, rootKind, term)
+		rootKind = op.Kind
+		term = operand
 	}
-	return qb
+
+	return combineSetNodes(root, rootKind, term)
+}
+
+func combineSetNodes(left *setOperationNode, kind UnionType, right *setOperationNode) *setOperationNode {
+	if left == nil {
+		return right
+	}
+	return &setOperationNode{kind: kind, left: left, right: right}
+}
+
+func (qb *QueryBuilder) Union(other *QueryBuilder) *QueryBuilder {
+	return qb.setOperation(Union, other)
 }
 
 func (qb *QueryBuilder) UnionAll(other *QueryBuilder) *QueryBuilder {
+	return qb.setOperation(UnionAll, other)
+}
+
+func (qb *QueryBuilder) Intersect(other *QueryBuilder) *QueryBuilder {
+	return qb.setOperation(Intersect, other)
+}
+
+func (qb *QueryBuilder) IntersectAll(other *QueryBuilder) *QueryBuilder {
+	return qb.setOperation(IntersectAll, other)
+}
+
+func (qb *QueryBuilder) Except(other *QueryBuilder) *QueryBuilder {
+	return qb.setOperation(Except, other)
+}
+
+func (qb *QueryBuilder) ExceptAll(other *QueryBuilder) *QueryBuilder {
+	return qb.setOperation(ExceptAll, other)
+}
+
+func (qb *QueryBuilder) setOperation(kind UnionType, other *QueryBuilder) *QueryBuilder {
 	if qb.err != nil {
 		return qb
 	}
 	if other == nil {
-		qb.err = &ErrInvalidQuery{"cannot UNION ALL with nil query"}
+		qb.err = &ErrInvalidQuery{fmt.Sprintf("cannot %s with nil query", kind)}
 		return qb
 	}
 	otherQuery, err := other.Build()
@@ -61,12 +166,11 @@ func (qb *QueryBuilder) UnionAll(other *QueryBuilder) *QueryBuilder {
 		return qb
 	}
 	if qb.query.Union == nil {
-		qb.query.Union = &UnionComponent{
-			UnionKind: UnionAll,
-			Queries:   []*Query{otherQuery},
-		}
-	} else {
-		qb.query.Union.Queries = append(qb.query.Union.Queries, otherQuery)
+		qb.query.Union = &UnionComponent{}
 	}
+	qb.query.Union.Operations = append(qb.query.Union.Operations, &SetOperation{
+		Kind:  kind,
+		Query: otherQuery,
+	})
 	return qb
 }
@@ -0,0 +1,56 @@
+package csvsql
+
+import "testing"
+
+func TestSetOperations(t *testing.T) {
+	e := newTestEngine(t)
+	// d and e hold duplicate rows for the ALL variants.
+	if err := e.CreateTableFromRows("d", []string{"id"}, [][]string{{"1"}, {"1"}, {"2"}, {"3"}, {"3"}, {"3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateTableFromRows("e", []string{"id"}, [][]string{{"1"}, {"1"}, {"1"}, {"3"}, {"3"}}); err != nil {
+		t.Fatal(err)
+	}
+	ids := func(table string) *QueryBuilder { return NewQuery().Select("id").From(table) }
+
+	tests := []struct {
+		name  string
+		query *QueryBuilder
+		want  []string
+	}{
+		{"union", ids("u").Union(ids("v")), []string{"1", "2", "3", "4", "5"}},
+		{"union all", ids("u").UnionAll(ids("v")), []string{"1", "2", "3", "3", "4", "5"}},
+		{"intersect", ids("u").Intersect(ids("v")), []string{"3"}},
+		{"except", ids("u").Except(ids("v")), []string{"1", "2"}},
+		{"intersect binds tighter than union", ids("v").Union(ids("u")).Intersect(ids("u")), []string{"3", "4", "5", "1", "2"}},
+		{"intersect binds tighter than except", ids("u").Except(ids("v")).Intersect(ids("v")), []string{"1", "2"}},
+		{"nested operand", ids("u").Except(ids("v").Union(ids("u"))), []string{}},
+		{"union then union all", ids("u").Union(ids("v")).UnionAll(ids("v")), []string{"1", "2", "3", "4", "5", "3", "4", "5"}},
+		{"union all then union", ids("u").UnionAll(ids("v")).Union(ids("v")), []string{"1", "2", "3", "4", "5"}},
+		{"intersect all", ids("d").IntersectAll(ids("e")), []string{"1", "1", "3", "3"}},
+		{"intersect with duplicates", ids("d").Intersect(ids("e")), []string{"1", "3"}},
+		{"except all", ids("d").ExceptAll(ids("e")), []string{"2", "3"}},
+		{"except with duplicates", ids("d").Except(ids("e")), []string{"2"}},
+		{"intersect all then intersect", ids("d").IntersectAll(ids("e")).Intersect(ids("d")), []string{"1", "3"}},
+		{"intersect all then except all", ids("d").IntersectAll(ids("d")).ExceptAll(ids("e")), []string{"2", "3"}},
+		{"intersect all then except", ids("d").IntersectAll(ids("d")).Except(ids("e")), []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertColumn(t, mustQuery(t, e, mustBuild(t, tt.query)), 0, tt.want)
+		})
+	}
+}
+
+func TestDeprecatedUnionFields(t *testing.T) {
+	e := newTestEngine(t)
+	q := mustBuild(t, NewQuery().Select("id").From("u"))
+	q.Union = &UnionComponent{
+		UnionKind: UnionAll,
+		Queries:   []*Query{mustBuild(t, NewQuery().Select("id").From("v"))},
+	}
+	assertColumn(t, mustQuery(t, e, q), 0, []string{"1", "2", "3", "3", "4", "5"})
+
+	q.Union = &UnionComponent{Queries: q.Union.Queries}
+	assertColumn(t, mustQuery(t, e, q), 0, []string{"1", "2", "3", "4", "5"})
+}
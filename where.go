@@ -14,6 +14,34 @@ func Where(column, operator, value string) *QueryBuilder {
 	}
 }
 
+func WhereIn(column string, values ...string) *QueryBuilder {
+	condition, err := NewInCondition(column, values...)
+	if err != nil {
+		return nil
+	}
+	return &QueryBuilder{
+		query: &Query{
+			Where: &WhereComponent{
+				Condition: condition,
+			},
+		},
+	}
+}
+
+func WhereBetween(column, low, high string) *QueryBuilder {
+	condition, err := NewBetweenCondition(column, low, high)
+	if err != nil {
+		return nil
+	}
+	return &QueryBuilder{
+		query: &Query{
+			Where: &WhereComponent{
+				Condition: condition,
+			},
+		},
+	}
+}
+
 func WhereFunc(fn func(row map[string][]string, tables map[string]*Table) (bool, error)) *QueryBuilder {
 	if fn == nil {
 		return nil
@@ -58,6 +86,36 @@ func (qb *QueryBuilder) Where(column, operator, value string) *QueryBuilder {
 	return qb
 }
 
+func (qb *QueryBuilder) WhereIn(column string, values ...string) *QueryBuilder {
+	if qb.err != nil {
+		return qb
+	}
+	condition, err := NewInCondition(column, values...)
+	if err != nil {
+		qb.err = err
+		return qb
+	}
+	qb.query.Where = &WhereComponent{
+		Condition: condition,
+	}
+	return qb
+}
+
+func (qb *QueryBuilder) WhereBetween(column, low, high string) *QueryBuilder {
+	if qb.err != nil {
+		return qb
+	}
+	condition, err := NewBetweenCondition(column, low, high)
+	if err != nil {
+		qb.err = err
+		return qb
+	}
+	qb.query.Where = &WhereComponent{
+		Condition: condition,
+	}
+	return qb
+}
+
 func (qb *QueryBuilder) WhereFunc(fn func(row map[string][]string, tables map[string]*Table) (bool, error)) *QueryBuilder {
 	if qb.err != nil {
 		return qb
@@ -0,0 +1,737 @@
+package csvsql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type WindowFunctionType string
+
+const (
+	RowNumberFunction  WindowFunctionType = "ROW_NUMBER"
+	RankFunction       WindowFunctionType = "RANK"
+	DenseRankFunction  WindowFunctionType = "DENSE_RANK"
+	LagFunction        WindowFunctionType = "LAG"
+	LeadFunction       WindowFunctionType = "LEAD"
+	FirstValueFunction WindowFunctionType = "FIRST_VALUE"
+	LastValueFunction  WindowFunctionType = "LAST_VALUE"
+	SumFunction        WindowFunctionType = "SUM"
+	AvgFunction        WindowFunctionType = "AVG"
+	CountFunction      WindowFunctionType = "COUNT"
+)
+
+type FrameMode string
+
+const (
+	RowsFrame  FrameMode = "ROWS"
+	RangeFrame FrameMode = "RANGE"
+)
+
+type FrameBoundType int
+
+const (
+	UnboundedPrecedingBound FrameBoundType = iota
+	PrecedingBound
+	CurrentRowBound
+	FollowingBound
+	UnboundedFollowingBound
+)
+
+type FrameBound struct {
+	Kind   FrameBoundType
+	Offset float64
+}
+
+func UnboundedPreceding() FrameBound {
+	return FrameBound{Kind: UnboundedPrecedingBound}
+}
+
+func Preceding(offset float64) FrameBound {
+	return FrameBound{Kind: PrecedingBound, Offset: offset}
+}
+
+func CurrentRow() FrameBound {
+	return FrameBound{Kind: CurrentRowBound}
+}
+
+func Following(offset float64) FrameBound {
+	return FrameBound{Kind: FollowingBound, Offset: offset}
+}
+
+func UnboundedFollowing() FrameBound {
+	return FrameBound{Kind: UnboundedFollowingBound}
+}
+
+func (b FrameBound) hasOffset() bool {
+	return b.Kind == PrecedingBound || b.Kind == FollowingBound
+}
+
+// distance returns the signed offset of the bound relative to the current
+// row, negative for PRECEDING and positive for FOLLOWING.
+func (b FrameBound) distance() float64 {
+	switch b.Kind {
+	case UnboundedPrecedingBound:
+		return math.Inf(-1)
+	case PrecedingBound:
+		return -b.Offset
+	case FollowingBound:
+		return b.Offset
+	case UnboundedFollowingBound:
+		return math.Inf(1)
+	default:
+		return 0
+	}
+}
+
+func (b FrameBound) String() string {
+	switch b.Kind {
+	case UnboundedPrecedingBound:
+		return "UNBOUNDED PRECEDING"
+	case PrecedingBound:
+		return strconv.FormatFloat(b.Offset, 'f', -1, 64) + " PRECEDING"
+	case FollowingBound:
+		return strconv.FormatFloat(b.Offset, 'f', -1, 64) + " FOLLOWING"
+	case UnboundedFollowingBound:
+		return "UNBOUNDED FOLLOWING"
+	default:
+		return "CURRENT ROW"
+	}
+}
+
+type WindowFrame struct {
+	Mode  FrameMode
+	Start FrameBound
+	End   FrameBound
+}
+
+// defaultFrame matches SQL: every row up to the last peer of the current row,
+// which is the whole partition when the window has no ORDER BY.
+var defaultFrame = WindowFrame{
+	Mode:  RangeFrame,
+	Start: UnboundedPreceding(),
+	End:   CurrentRow(),
+}
+
+func (f *WindowFrame) Validate() error {
+	if f.Mode != RowsFrame && f.Mode != RangeFrame {
+		return &ErrInvalidQuery{fmt.Sprintf("invalid frame mode: %s", f.Mode)}
+	}
+	if f.Start.Kind == UnboundedFollowingBound {
+		return &ErrInvalidQuery{"frame cannot start at UNBOUNDED FOLLOWING"}
+	}
+	if f.End.Kind == UnboundedPrecedingBound {
+		return &ErrInvalidQuery{"frame cannot end at UNBOUNDED PRECEDING"}
+	}
+	for _, bound := range []FrameBound{f.Start, f.End} {
+		if bound.Offset < 0 {
+			return &ErrInvalidQuery{"frame offset cannot be negative"}
+		}
+		if f.Mode == RowsFrame && bound.Offset != math.Trunc(bound.Offset) {
+			return &ErrInvalidQuery{"ROWS frame offset must be an integer"}
+		}
+	}
+	if f.Start.distance() > f.End.distance() {
+		return &ErrInvalidQuery{fmt.Sprintf("frame start %s is after frame end %s", f.Start, f.End)}
+	}
+	return nil
+}
+
+func (f *WindowFrame) hasOffset() bool {
+	return f.Start.hasOffset() || f.End.hasOffset()
+}
+
+type WindowFunction struct {
+	Function  WindowFunctionType
+	Column    string
+	Offset    int
+	Default   string
+	Partition []string
+	Order     []OrderByField
+	Frame     *WindowFrame
+}
+
+type WindowSelectField struct {
+	Name   string
+	Window *WindowFunction
+}
+
+func RowNumber() *WindowFunction {
+	return &WindowFunction{Function: RowNumberFunction}
+}
+
+func Rank() *WindowFunction {
+	return &WindowFunction{Function: RankFunction}
+}
+
+func DenseRank() *WindowFunction {
+	return &WindowFunction{Function: DenseRankFunction}
+}
+
+func Lag(column string, offset int, defaultValue string) *WindowFunction {
+	return &WindowFunction{Function: LagFunction, Column: column, Offset: offset, Default: defaultValue}
+}
+
+func Lead(column string, offset int, defaultValue string) *WindowFunction {
+	return &WindowFunction{Function: LeadFunction, Column: column, Offset: offset, Default: defaultValue}
+}
+
+func FirstValue(column string) *WindowFunction {
+	return &WindowFunction{Function: FirstValueFunction, Column: column}
+}
+
+func LastValue(column string) *WindowFunction {
+	return &WindowFunction{Function: LastValueFunction, Column: column}
+}
+
+func SumOver(column string) *WindowFunction {
+	return &WindowFunction{Function: SumFunction, Column: column}
+}
+
+func AvgOver(column string) *WindowFunction {
+	return &WindowFunction{Function: AvgFunction, Column: column}
+}
+
+// CountOver counts non-empty values of column, or every row when column is "*".
+func CountOver(column string) *WindowFunction {
+	return &WindowFunction{Function: CountFunction, Column: column}
+}
+
+func (w *WindowFunction) PartitionBy(columns ...string) *WindowFunction {
+	w.Partition = append(w.Partition, columns...)
+	return w
+}
+
+func (w *WindowFunction) OrderBy(column string, direction ...SortDirection) *WindowFunction {
+	w.Order = append(w.Order, newOrderByField(column, direction))
+	return w
+}
+
+func (w *WindowFunction) Rows(start, end FrameBound) *WindowFunction {
+	w.Frame = &WindowFrame{Mode: RowsFrame, Start: start, End: end}
+	return w
+}
+
+func (w *WindowFunction) Range(start, end FrameBound) *WindowFunction {
+	w.Frame = &WindowFrame{Mode: RangeFrame, Start: start, End: end}
+	return w
+}
+
+func (w *WindowFunction) Validate() error {
+	switch w.Function {
+	case RowNumberFunction, RankFunction, DenseRankFunction:
+	case LagFunction, LeadFunction, FirstValueFunction, LastValueFunction, SumFunction, AvgFunction, CountFunction:
+		if w.Column == "" || (w.Column == "*" && w.Function != CountFunction) {
+			return &ErrInvalidQuery{fmt.Sprintf("%s requires a column", w.Function)}
+		}
+		if w.Offset < 0 {
+			return &ErrInvalidQuery{fmt.Sprintf("%s offset cannot be negative", w.Function)}
+		}
+	default:
+		return &ErrInvalidQuery{fmt.Sprintf("unsupported window function: %s", w.Function)}
+	}
+
+	for _, col := range w.Partition {
+		if col == "" {
+			return &ErrInvalidQuery{"PARTITION BY column cannot be empty"}
+		}
+	}
+
+	if err := validateOrderByFields(w.Order); err != nil {
+		return err
+	}
+
+	if w.Frame != nil {
+		if err := w.Frame.Validate(); err != nil {
+			return err
+		}
+		if w.Frame.Mode == RangeFrame && w.Frame.hasOffset() && len(w.Order) != 1 {
+			return &ErrInvalidQuery{"RANGE frame with an offset requires exactly one ORDER BY column"}
+		}
+	}
+
+	return nil
+}
+
+func (w *WindowFunction) String() string {
+	var sb strings.Builder
+	sb.WriteString(string(w.Function))
+	sb.WriteString("(")
+	switch w.Function {
+	case LagFunction, LeadFunction:
+		fmt.Fprintf(&sb, "%s, %d, '%s'", w.Column, w.Offset, w.Default)
+	default:
+		sb.WriteString(w.Column)
+	}
+	sb.WriteString(") OVER (")
+
+	var clauses []string
+	if len(w.Partition) > 0 {
+		clauses = append(clauses, "PARTITION BY "+strings.Join(w.Partition, ", "))
+	}
+	if len(w.Order) > 0 {
+		order := make([]string, len(w.Order))
+		for i, field := range w.Order {
+			order[i] = field.Column + " " + string(field.Direction)
+		}
+		clauses = append(clauses, "ORDER BY "+strings.Join(order, ", "))
+	}
+	if w.Frame != nil {
+		clauses = append(clauses, fmt.Sprintf("%s BETWEEN %s AND %s", w.Frame.Mode, w.Frame.Start, w.Frame.End))
+	}
+	sb.WriteString(strings.Join(clauses, " "))
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (qb *QueryBuilder) SelectWindow(name string, fn *WindowFunction) *QueryBuilder {
+	if qb.err != nil {
+		return qb
+	}
+	if name == "" {
+		qb.err = &ErrInvalidQuery{"window column name cannot be empty"}
+		return qb
+	}
+	if fn == nil {
+		qb.err = &ErrInvalidQuery{"window function cannot be nil"}
+		return qb
+	}
+	if qb.query.Select == nil {
+		qb.query.Select = &SelectComponent{}
+	}
+	qb.query.Select.WindowColumns = append(qb.query.Select.WindowColumns, WindowSelectField{
+		Name:   name,
+		Window: fn,
+	})
+	return qb
+}
+
+// applyWindowFunctions computes the window columns of the active joined rows.
+// It checks ctx for every row and partition, returning ctx.Err() once it is
+// done.
+func (e *Engine) applyWindowFunctions(ctx context.Context, q *Query, joinedRows *[]JoinedRow) error {
+	if len(q.Select.WindowColumns) == 0 {
+		return nil
+	}
+
+	var active []int
+	for i := range *joinedRows {
+		if !(*joinedRows)[i].isFiltered {
+			active = append(active, i)
+		}
+	}
+
+	// Besides the joined rows, every row holds its window values and a place
+	// in the sorted partitions.
+	rowBytes := joinedRowBytes + tableRowBytes*int64(len(q.Joins)+1) + cellBytes*int64(len(q.Select.WindowColumns)) + sortRowBytes
+	if err := e.guard.checkRows(WindowNode, len(active), rowBytes); err != nil {
+		return err
+	}
+
+	rows := make([]JoinedRow, len(active))
+	for i, idx := range active {
+		rows[i] = (*joinedRows)[idx]
+	}
+
+	for _, wc := range q.Select.WindowColumns {
+		values, err := e.evaluateWindow(ctx, wc.Window, rows)
+		if err != nil {
+			return fmt.Errorf("window column %s: %w", wc.Name, err)
+		}
+
+		for i, idx := range active {
+			jr := &(*joinedRows)[idx]
+			if jr.windowValues == nil {
+				jr.windowValues = make(map[string]string)
+			}
+			jr.windowValues[wc.Name] = values[i]
+		}
+	}
+
+	return nil
+}
+
+// windowPartition holds the row positions of one partition in window order
+// together with the ORDER BY key values of each position.
+type windowPartition struct {
+	rows  []int
+	keys  [][]string
+	order *sortOrder
+}
+
+func (e *Engine) evaluateWindow(ctx context.Context, w *WindowFunction, rows []JoinedRow) ([]string, error) {
+	partitions, err := e.partitionWindowRows(ctx, w, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if w.Column != "" && w.Column != "*" {
+		args = make([]string, len(rows))
+		for i, jr := range rows {
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			args[i], err = e.getColumnValue(w.Column, jr, e.tables[jr.mainTable])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	values := make([]string, len(rows))
+	for _, part := range partitions {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		if err := w.evaluatePartition(part, args, values); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (e *Engine) partitionWindowRows(ctx context.Context, w *WindowFunction, rows []JoinedRow) ([]*windowPartition, error) {
+	var partitions []*windowPartition
+	byKey := make(map[string]*windowPartition)
+
+	for i, jr := range rows {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		partitionValues := make([]string, len(w.Partition))
+		for j, col := range w.Partition {
+			val, err := e.getColumnValue(col, jr, e.tables[jr.mainTable])
+			if err != nil {
+				return nil, err
+			}
+			partitionValues[j] = val
+		}
+
+		orderValues := make([]string, len(w.Order))
+		for j, field := range w.Order {
+			val, err := e.getColumnValue(field.Column, jr, e.tables[jr.mainTable])
+			if err != nil {
+				return nil, err
+			}
+			orderValues[j] = val
+		}
+
+		key := createRowKey(partitionValues)
+		part, ok := byKey[key]
+		if !ok {
+			part = &windowPartition{}
+			byKey[key] = part
+			partitions = append(partitions, part)
+		}
+		part.rows = append(part.rows, i)
+		part.keys = append(part.keys, orderValues)
+	}
+
+	// All partitions share one order, so that a key is compared the same
+	// way in every partition.
+	positions := make([]int, len(w.Order))
+	for i := range positions {
+		positions[i] = i
+	}
+	order := newSortOrder(positions, w.Order)
+	for _, part := range partitions {
+		for _, key := range part.keys {
+			order.observe(key)
+		}
+	}
+	for _, part := range partitions {
+		part.order = order
+		if err := part.sort(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return partitions, nil
+}
+
+// sort puts the rows of the partition in window order.
+func (p *windowPartition) sort(ctx context.Context) error {
+	order, err := stableOrder(ctx, len(p.rows), func(i, j int) bool {
+		return p.order.compare(p.keys[i], p.keys[j]) < 0
+	})
+	if err != nil {
+		return err
+	}
+
+	rows, keys := make([]int, len(p.rows)), make([][]string, len(p.keys))
+	for i, pos := range order {
+		rows[i], keys[i] = p.rows[pos], p.keys[pos]
+	}
+	p.rows, p.keys = rows, keys
+	return nil
+}
+
+func (w *WindowFunction) evaluatePartition(part *windowPartition, args []string, values []string) error {
+	n := len(part.rows)
+	isPeer := func(i, j int) bool {
+		return part.order.compare(part.keys[i], part.keys[j]) == 0
+	}
+
+	switch w.Function {
+	case RowNumberFunction:
+		for pos, row := range part.rows {
+			values[row] = strconv.Itoa(pos + 1)
+		}
+		return nil
+
+	case RankFunction, DenseRankFunction:
+		rank, dense := 0, 0
+		for pos, row := range part.rows {
+			if pos == 0 || !isPeer(pos-1, pos) {
+				rank = pos + 1
+				dense++
+			}
+			if w.Function == RankFunction {
+				values[row] = strconv.Itoa(rank)
+			} else {
+				values[row] = strconv.Itoa(dense)
+			}
+		}
+		return nil
+
+	case LagFunction, LeadFunction:
+		offset := w.Offset
+		if w.Function == LagFunction {
+			offset = -offset
+		}
+		for pos, row := range part.rows {
+			target := pos + offset
+			if target >= 0 && target < n {
+				values[row] = args[part.rows[target]]
+			} else {
+				values[row] = w.Default
+			}
+		}
+		return nil
+	}
+
+	frame := defaultFrame
+	if w.Frame != nil {
+		frame = *w.Frame
+	}
+
+	bounds, err := frameBounds(frame, part, w.Order, isPeer)
+	if err != nil {
+		return err
+	}
+
+	switch w.Function {
+	case FirstValueFunction, LastValueFunction:
+		for pos, row := range part.rows {
+			start, end := bounds[pos][0], bounds[pos][1]
+			switch {
+			case start > end:
+				values[row] = ""
+			case w.Function == FirstValueFunction:
+				values[row] = args[part.rows[start]]
+			default:
+				values[row] = args[part.rows[end]]
+			}
+		}
+		return nil
+	}
+
+	// SUM, AVG and COUNT are answered from prefix and suffix sums, so that
+	// frames reaching either end of the partition stay linear in its size.
+	// Sums are never subtracted from each other, which would cancel small
+	// values next to large ones; other frames are summed directly.
+	nums := make([]float64, n)
+	counts := make([]int, n+1)
+	for pos, row := range part.rows {
+		counts[pos+1] = counts[pos]
+
+		if args == nil {
+			counts[pos+1]++
+			continue
+		}
+
+		val := strings.TrimSpace(args[row])
+		if val == "" {
+			continue
+		}
+		counts[pos+1]++
+		if w.Function == CountFunction {
+			continue
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("%s requires numeric values, got %q in column %s", w.Function, val, w.Column)
+		}
+		nums[pos] = f
+	}
+	prefix := make([]float64, n+1)
+	for pos := 0; pos < n; pos++ {
+		prefix[pos+1] = prefix[pos] + nums[pos]
+	}
+	suffix := make([]float64, n+1)
+	for pos := n - 1; pos >= 0; pos-- {
+		suffix[pos] = suffix[pos+1] + nums[pos]
+	}
+
+	for pos, row := range part.rows {
+		start, end := bounds[pos][0], bounds[pos][1]
+		if start > end {
+			if w.Function == CountFunction {
+				values[row] = "0"
+			} else {
+				values[row] = ""
+			}
+			continue
+		}
+
+		count := counts[end+1] - counts[start]
+		var sum float64
+		switch {
+		case start == 0:
+			sum = prefix[end+1]
+		case end == n-1:
+			sum = suffix[start]
+		default:
+			for _, f := range nums[start : end+1] {
+				sum += f
+			}
+		}
+		switch {
+		case w.Function == CountFunction:
+			values[row] = strconv.Itoa(count)
+		case count == 0:
+			values[row] = ""
+		case w.Function == SumFunction:
+			values[row] = formatNumber(sum)
+		default:
+			values[row] = formatNumber(sum / float64(count))
+		}
+	}
+	return nil
+}
+
+// frameBounds returns the inclusive [start, end] partition positions of the
+// frame for every row; start > end denotes an empty frame.
+func frameBounds(frame WindowFrame, part *windowPartition, order []OrderByField, isPeer func(i, j int) bool) ([][2]int, error) {
+	n := len(part.rows)
+	bounds := make([][2]int, n)
+
+	if frame.Mode == RowsFrame {
+		for pos := range bounds {
+			start := rowsBound(frame.Start, pos, n)
+			end := rowsBound(frame.End, pos, n)
+			if start < 0 {
+				start = 0
+			}
+			if end > n-1 {
+				end = n - 1
+			}
+			bounds[pos] = [2]int{start, end}
+		}
+		return bounds, nil
+	}
+
+	if frame.hasOffset() {
+		return rangeOffsetBounds(frame, part, order[0].Direction)
+	}
+
+	peerStart := make([]int, n)
+	for pos := range peerStart {
+		if pos > 0 && isPeer(pos-1, pos) {
+			peerStart[pos] = peerStart[pos-1]
+		} else {
+			peerStart[pos] = pos
+		}
+	}
+	peerEnd := make([]int, n)
+	for pos := n - 1; pos >= 0; pos-- {
+		if pos < n-1 && isPeer(pos, pos+1) {
+			peerEnd[pos] = peerEnd[pos+1]
+		} else {
+			peerEnd[pos] = pos
+		}
+	}
+
+	for pos := range bounds {
+		start, end := 0, n-1
+		if frame.Start.Kind == CurrentRowBound {
+			start = peerStart[pos]
+		}
+		if frame.End.Kind == CurrentRowBound {
+			end = peerEnd[pos]
+		}
+		bounds[pos] = [2]int{start, end}
+	}
+	return bounds, nil
+}
+
+func rowsBound(bound FrameBound, pos, n int) int {
+	switch bound.Kind {
+	case UnboundedPrecedingBound:
+		return 0
+	case UnboundedFollowingBound:
+		return n - 1
+	default:
+		return pos + int(bound.distance())
+	}
+}
+
+// rangeOffsetBounds computes RANGE frames with an offset. Rows with an empty
+// ORDER BY value sort together at one end of the partition and form their own
+// peer group: their frame is that group, and it is never part of the frame
+// of any other row.
+func rangeOffsetBounds(frame WindowFrame, part *windowPartition, direction SortDirection) ([][2]int, error) {
+	n := len(part.rows)
+	keys := make([]float64, n)
+	lo, hi := 0, n
+	for pos, key := range part.keys {
+		if key[0] == "" {
+			continue
+		}
+		f, err := parseNumber(key[0])
+		if err != nil {
+			return nil, fmt.Errorf("RANGE frame with an offset requires numeric ORDER BY values, got %q", key[0])
+		}
+		keys[pos] = f
+	}
+	for lo < n && part.keys[lo][0] == "" {
+		lo++
+	}
+	for hi > lo && part.keys[hi-1][0] == "" {
+		hi--
+	}
+
+	// The distance from the current row grows monotonically along the
+	// non-empty values, which allows binary searching the frame edges.
+	distance := func(pos, current int) float64 {
+		if direction == Desc {
+			return keys[current] - keys[pos]
+		}
+		return keys[pos] - keys[current]
+	}
+
+	bounds := make([][2]int, n)
+	for pos := range bounds {
+		switch {
+		case pos < lo:
+			bounds[pos] = [2]int{0, lo - 1}
+			continue
+		case pos >= hi:
+			bounds[pos] = [2]int{hi, n - 1}
+			continue
+		}
+		startDistance, endDistance := frame.Start.distance(), frame.End.distance()
+		start := lo + sort.Search(hi-lo, func(i int) bool { return distance(lo+i, pos) >= startDistance })
+		end := lo + sort.Search(hi-lo, func(i int) bool { return distance(lo+i, pos) > endDistance }) - 1
+		bounds[pos] = [2]int{start, end}
+	}
+	return bounds, nil
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1e9)/1e9, 'f', -1, 64)
+}
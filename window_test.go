@@ -0,0 +1,92 @@
+package csvsql
+
+import "testing"
+
+func TestWindowFunctions(t *testing.T) {
+	e := NewEngine()
+	err := e.CreateTableFromRows("w", []string{"id", "dept", "amount"}, [][]string{
+		{"1", "a", "10"},
+		{"2", "a", "20"},
+		{"3", "a", "20"},
+		{"4", "a", "40"},
+		{"5", "b", "30"},
+		{"6", "b", ""},
+		{"7", "b", "15"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fn   *WindowFunction
+		want []string
+	}{
+		{"row number", RowNumber().PartitionBy("dept").OrderBy("amount"), []string{"1", "2", "3", "4", "3", "1", "2"}},
+		{"row number without partition", RowNumber().OrderBy("id", Desc), []string{"7", "6", "5", "4", "3", "2", "1"}},
+		{"rank", Rank().PartitionBy("dept").OrderBy("amount"), []string{"1", "2", "2", "4", "3", "1", "2"}},
+		{"dense rank", DenseRank().PartitionBy("dept").OrderBy("amount"), []string{"1", "2", "2", "3", "3", "1", "2"}},
+		{"lag", Lag("amount", 1, "none").PartitionBy("dept").OrderBy("id"), []string{"none", "10", "20", "20", "none", "30", ""}},
+		{"lead", Lead("amount", 2, "x").PartitionBy("dept").OrderBy("id"), []string{"20", "40", "x", "x", "15", "x", "x"}},
+		{"first value", FirstValue("id").PartitionBy("dept").OrderBy("amount", Desc), []string{"4", "4", "4", "4", "5", "5", "5"}},
+		{"last value includes peers", LastValue("id").PartitionBy("dept").OrderBy("amount"), []string{"1", "3", "3", "4", "5", "6", "7"}},
+		{"running sum", SumOver("amount").PartitionBy("dept").OrderBy("amount"), []string{"10", "50", "50", "90", "45", "", "15"}},
+		{"partition sum", SumOver("amount").PartitionBy("dept"), []string{"90", "90", "90", "90", "45", "45", "45"}},
+		{"count column", CountOver("amount").PartitionBy("dept"), []string{"4", "4", "4", "4", "2", "2", "2"}},
+		{"count star", CountOver("*").PartitionBy("dept"), []string{"4", "4", "4", "4", "3", "3", "3"}},
+		{
+			"rows frame avg",
+			AvgOver("amount").OrderBy("id").Rows(Preceding(1), Following(1)),
+			[]string{"15", "16.666666667", "26.666666667", "30", "35", "22.5", "15"},
+		},
+		{
+			"rows frame to end",
+			CountOver("*").OrderBy("id").Rows(CurrentRow(), UnboundedFollowing()),
+			[]string{"7", "6", "5", "4", "3", "2", "1"},
+		},
+		{
+			"range frame with offset",
+			SumOver("amount").OrderBy("amount").Range(Preceding(10), CurrentRow()),
+			[]string{"10", "65", "65", "70", "70", "", "25"},
+		},
+		{
+			"descending range frame",
+			CountOver("*").OrderBy("amount", Desc).Range(Preceding(5), Following(5)),
+			[]string{"2", "3", "3", "1", "1", "1", "4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := mustBuild(t, NewQuery().Select("id").From("w").SelectWindow("v", tt.fn).OrderBy("id"))
+			assertColumn(t, mustQuery(t, e, q), 1, tt.want)
+		})
+	}
+}
+
+func TestWindowSumsOfLargeAndSmallValues(t *testing.T) {
+	e := NewEngine()
+	err := e.CreateTableFromRows("w", []string{"id", "v"}, [][]string{
+		{"1", "1e17"}, {"2", "1"}, {"3", "1"}, {"4", "1"}, {"5", "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Frames after the large value must not lose the small ones to it.
+	tests := []struct {
+		name string
+		fn   *WindowFunction
+		want []string
+	}{
+		{"rows sum", SumOver("v").OrderBy("id").Rows(Preceding(1), CurrentRow()), []string{"100000000000000000", "100000000000000000", "2", "2", "2"}},
+		{"rows avg", AvgOver("v").OrderBy("id").Rows(CurrentRow(), Following(1)), []string{"50000000000000000", "1", "1", "1", "1"}},
+		{"rows sum to end", SumOver("v").OrderBy("id").Rows(Following(1), UnboundedFollowing()), []string{"4", "3", "2", "1", ""}},
+		{"range sum", SumOver("v").OrderBy("id").Range(Preceding(2), Preceding(1)), []string{"", "100000000000000000", "100000000000000000", "2", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := mustBuild(t, NewQuery().Select("id").From("w").SelectWindow("s", tt.fn).OrderBy("id"))
+			assertColumn(t, mustQuery(t, e, q), 1, tt.want)
+		})
+	}
+}
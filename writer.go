@@ -0,0 +1,441 @@
+package csvsql
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ResultWriter writes query results in one output format. Values of typed
+// columns may be written as the native values of the format, such as JSON
+// numbers; types holds the type of every column.
+type ResultWriter interface {
+	WriteResults(w io.Writer, headers []string, rows [][]string, types []ColumnType) error
+}
+
+var (
+	resultWritersMu sync.RWMutex
+	resultWriters   = map[string]ResultWriter{
+		"csv":      &CSVWriter{},
+		"json":     &JSONWriter{},
+		"ndjson":   &NDJSONWriter{},
+		"jsonl":    &NDJSONWriter{},
+		"markdown": &MarkdownWriter{},
+		"md":       &MarkdownWriter{},
+		"html":     &HTMLWriter{},
+	}
+)
+
+// RegisterResultWriter makes rw available to Export as format, replacing
+// any writer registered under that name. Formats are case-insensitive.
+func RegisterResultWriter(format string, rw ResultWriter) {
+	resultWritersMu.Lock()
+	defer resultWritersMu.Unlock()
+	resultWriters[strings.ToLower(format)] = rw
+}
+
+func lookupResultWriter(format string) (ResultWriter, error) {
+	resultWritersMu.RLock()
+	defer resultWritersMu.RUnlock()
+	if rw, ok := resultWriters[strings.ToLower(format)]; ok {
+		return rw, nil
+	}
+	formats := make([]string, 0, len(resultWriters))
+	for name := range resultWriters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return nil, fmt.Errorf("unsupported export format %q: format must be one of %s", format, strings.Join(formats, ", "))
+}
+
+// Export writes the results of q to w in format, which names a registered
+// ResultWriter: csv, json, ndjson (or jsonl), markdown (or md) and html are
+// built in.
+func (e *Engine) Export(q *Query, w io.Writer, format string) error {
+	return e.ExportContext(context.Background(), q, w, format)
+}
+
+// ExportContext is like Export but stops once ctx is done while running the
+// query.
+func (e *Engine) ExportContext(ctx context.Context, q *Query, w io.Writer, format string) error {
+	rw, err := lookupResultWriter(format)
+	if err != nil {
+		return err
+	}
+	return e.ExportWithWriterContext(ctx, q, w, rw)
+}
+
+// ExportWithWriter writes the results of q to w using rw.
+func (e *Engine) ExportWithWriter(q *Query, w io.Writer, rw ResultWriter) error {
+	return e.ExportWithWriterContext(context.Background(), q, w, rw)
+}
+
+// ExportWithWriterContext is like ExportWithWriter but stops once ctx is done
+// while running the query.
+func (e *Engine) ExportWithWriterContext(ctx context.Context, q *Query, w io.Writer, rw ResultWriter) error {
+	results, types, err := e.ExecuteQueryWithTypesContext(ctx, q)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	var headers []string
+	var rows [][]string
+	if len(results) > 0 {
+		headers, rows = results[0], results[1:]
+	}
+
+	buffered := bufio.NewWriter(w)
+	if err := rw.WriteResults(buffered, headers, rows, types); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	return nil
+}
+
+// CSVQuoting selects which fields CSVWriter encloses in quotes.
+type CSVQuoting int
+
+const (
+	// QuoteMinimal quotes only fields containing the delimiter, quotes or
+	// line breaks, or starting with white space.
+	QuoteMinimal CSVQuoting = iota
+	// QuoteAll quotes every field, including empty ones.
+	QuoteAll
+	// QuoteNonNumeric quotes every field except the values of integer and
+	// float columns.
+	QuoteNonNumeric
+	// QuoteNone never quotes fields; fields that would need quotes are an
+	// error.
+	QuoteNone
+)
+
+// CSVWriter writes results as delimited text with a header row. The zero
+// value writes comma-separated values like encoding/csv does.
+type CSVWriter struct {
+	// Delimiter separates fields. It defaults to ','.
+	Delimiter rune
+	// Quoting selects which fields are quoted.
+	Quoting CSVQuoting
+	// CRLF ends lines with \r\n instead of \n.
+	CRLF bool
+	// BOM starts the output with a UTF-8 byte order mark, which makes Excel
+	// read the file as UTF-8 rather than in the legacy encoding of the
+	// system.
+	BOM bool
+	// NoHeader leaves out the header row.
+	NoHeader bool
+}
+
+func (c CSVWriter) WriteResults(w io.Writer, headers []string, rows [][]string, types []ColumnType) error {
+	return c.writeResults(context.Background(), w, headers, rows, types)
+}
+
+func (c CSVWriter) writeResults(ctx context.Context, w io.Writer, headers []string, rows [][]string, types []ColumnType) error {
+	delimiter := c.Delimiter
+	if delimiter == 0 {
+		delimiter = ','
+	}
+	if !validCSVDelimiter(delimiter) {
+		return fmt.Errorf("invalid delimiter %q", delimiter)
+	}
+	newline := "\n"
+	if c.CRLF {
+		newline = "\r\n"
+	}
+
+	var sb strings.Builder
+	writeRecord := func(record []string, quoted func(col int) bool) error {
+		sb.Reset()
+		for col, field := range record {
+			if col > 0 {
+				sb.WriteRune(delimiter)
+			}
+			needsQuotes := csvFieldNeedsQuotes(field, delimiter)
+			switch {
+			case c.Quoting == QuoteNone && needsQuotes:
+				return fmt.Errorf("field %q needs quotes, which quoting style QuoteNone does not allow", field)
+			case c.Quoting == QuoteNone || !needsQuotes && !quoted(col):
+				sb.WriteString(field)
+			default:
+				writeQuotedCSVField(&sb, field, c.CRLF)
+			}
+		}
+		sb.WriteString(newline)
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	if c.BOM {
+		if _, err := w.Write(utf8BOM); err != nil {
+			return err
+		}
+	}
+	if !c.NoHeader {
+		quoteHeader := func(int) bool { return c.Quoting == QuoteAll || c.Quoting == QuoteNonNumeric }
+		if err := writeRecord(headers, quoteHeader); err != nil {
+			return err
+		}
+	}
+
+	quoteValue := func(col int) bool {
+		switch c.Quoting {
+		case QuoteAll:
+			return true
+		case QuoteNonNumeric:
+			return col >= len(types) || types[col] != IntegerColumn && types[col] != FloatColumn
+		}
+		return false
+	}
+	for _, row := range rows {
+		if err := checkContext(ctx); err != nil {
+			return err
+		}
+		if err := writeRecord(row, quoteValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validCSVDelimiter reports whether r can separate fields, following the
+// rules of encoding/csv.
+func validCSVDelimiter(r rune) bool {
+	return r != 0 && r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
+
+// csvFieldNeedsQuotes reports whether field must be quoted to be read back
+// unchanged, following the rules of encoding/csv.
+func csvFieldNeedsQuotes(field string, delimiter rune) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsRune(field, delimiter) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
+
+func writeQuotedCSVField(sb *strings.Builder, field string, crlf bool) {
+	sb.WriteByte('"')
+	for _, r := range field {
+		switch r {
+		case '"':
+			sb.WriteString(`""`)
+		case '\r':
+			if !crlf {
+				sb.WriteByte('\r')
+			}
+		case '\n':
+			if crlf {
+				sb.WriteString("\r\n")
+			} else {
+				sb.WriteByte('\n')
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+}
+
+// JSONWriter writes results as a JSON array holding one object per row,
+// keyed by the column names in column order. Values of numeric and boolean
+// columns are written as JSON numbers and booleans, and empty values of such
+// columns as null.
+type JSONWriter struct {
+	// Indent, when set, puts every object on lines of its own indented by
+	// it.
+	Indent string
+}
+
+func (j JSONWriter) WriteResults(w io.Writer, headers []string, rows [][]string, types []ColumnType) error {
+	separator, newline := ",", ""
+	if j.Indent != "" {
+		separator, newline = ",\n", "\n"
+	}
+
+	if _, err := io.WriteString(w, "["+newline); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if i > 0 {
+			if _, err := io.WriteString(w, separator); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, j.Indent); err != nil {
+			return err
+		}
+		if err := writeJSONObject(w, headers, row, types); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, newline+"]\n")
+	return err
+}
+
+// NDJSONWriter writes results as newline-delimited JSON, one object per
+// row, typed like JSONWriter does.
+type NDJSONWriter struct{}
+
+func (NDJSONWriter) WriteResults(w io.Writer, headers []string, rows [][]string, types []ColumnType) error {
+	for _, row := range rows {
+		if err := writeJSONObject(w, headers, row, types); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSONObject(w io.Writer, headers, row []string, types []ColumnType) error {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for col, header := range headers {
+		if col > 0 {
+			sb.WriteByte(',')
+		}
+		key, err := json.Marshal(header)
+		if err != nil {
+			return err
+		}
+		sb.Write(key)
+		sb.WriteByte(':')
+
+		var value string
+		if col < len(row) {
+			value = row[col]
+		}
+		typ := StringColumn
+		if col < len(types) {
+			typ = types[col]
+		}
+		sb.WriteString(jsonLiteral(value, typ))
+	}
+	sb.WriteByte('}')
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// jsonLiteral returns the JSON text of a value of a column of type typ.
+// Values that do not fit the type are written as strings.
+func jsonLiteral(value string, typ ColumnType) string {
+	switch typ {
+	case IntegerColumn, FloatColumn:
+		if value == "" {
+			return "null"
+		}
+		if valueFits(value, typ) && json.Valid([]byte(value)) {
+			return value
+		}
+	case BooleanColumn:
+		if value == "" {
+			return "null"
+		}
+		if b, err := strconv.ParseBool(value); err == nil {
+			return strconv.FormatBool(b)
+		}
+	}
+	text, _ := json.Marshal(value)
+	return string(text)
+}
+
+// MarkdownWriter writes results as a GitHub Flavored Markdown table.
+// Numeric columns are right-aligned.
+type MarkdownWriter struct{}
+
+func (MarkdownWriter) WriteResults(w io.Writer, headers []string, rows [][]string, types []ColumnType) error {
+	var sb strings.Builder
+	writeMarkdownRow(&sb, headers)
+	sb.WriteByte('|')
+	for col := range headers {
+		if col < len(types) && (types[col] == IntegerColumn || types[col] == FloatColumn) {
+			sb.WriteString(" ---: |")
+		} else {
+			sb.WriteString(" --- |")
+		}
+	}
+	sb.WriteByte('\n')
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		sb.Reset()
+		writeMarkdownRow(&sb, row)
+		if _, err := io.WriteString(w, sb.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownEscaper keeps cell values from being read as table syntax or HTML.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"|", `\|`,
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"\r\n", "<br>",
+	"\n", "<br>",
+	"\r", "<br>",
+)
+
+func writeMarkdownRow(sb *strings.Builder, cells []string) {
+	sb.WriteByte('|')
+	for _, cell := range cells {
+		sb.WriteByte(' ')
+		sb.WriteString(markdownEscaper.Replace(cell))
+		sb.WriteString(" |")
+	}
+	sb.WriteByte('\n')
+}
+
+// HTMLWriter writes results as an HTML table with escaped values.
+type HTMLWriter struct{}
+
+func (HTMLWriter) WriteResults(w io.Writer, headers []string, rows [][]string, types []ColumnType) error {
+	var sb strings.Builder
+	sb.WriteString("<table>\n<thead>\n")
+	writeHTMLRow(&sb, "th", headers)
+	sb.WriteString("</thead>\n<tbody>\n")
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		sb.Reset()
+		writeHTMLRow(&sb, "td", row)
+		if _, err := io.WriteString(w, sb.String()); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</tbody>\n</table>\n")
+	return err
+}
+
+func writeHTMLRow(sb *strings.Builder, tag string, cells []string) {
+	sb.WriteString("<tr>")
+	for _, cell := range cells {
+		fmt.Fprintf(sb, "<%s>%s</%s>", tag, html.EscapeString(cell), tag)
+	}
+	sb.WriteString("</tr>\n")
+}
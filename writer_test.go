@@ -0,0 +1,87 @@
+package csvsql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestResultWriters(t *testing.T) {
+	e := NewEngine()
+	data := `{"id": 1, "score": 9.5, "ok": true, "code": "007", "note": "a|b"}` + "\n" +
+		`{"id": 2, "score": null, "ok": false, "code": "012", "note": "<i>x</i> & y\nz"}` + "\n"
+	if err := e.CreateTableFromReader("t", strings.NewReader(data), "ndjson", TableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	q := mustBuild(t, NewQuery().Select("id", "score", "ok", "code", "note").From("t"))
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", `[{"id":1,"score":9.5,"ok":true,"code":"007","note":"a|b"},` +
+			`{"id":2,"score":null,"ok":false,"code":"012","note":"\u003ci\u003ex\u003c/i\u003e \u0026 y\nz"}]` + "\n"},
+		{"ndjson", `{"id":1,"score":9.5,"ok":true,"code":"007","note":"a|b"}` + "\n" +
+			`{"id":2,"score":null,"ok":false,"code":"012","note":"\u003ci\u003ex\u003c/i\u003e \u0026 y\nz"}` + "\n"},
+		{"markdown", "| id | score | ok | code | note |\n" +
+			"| ---: | ---: | --- | --- | --- |\n" +
+			"| 1 | 9.5 | true | 007 | a\\|b |\n" +
+			"| 2 |  | false | 012 | &lt;i&gt;x&lt;/i&gt; &amp; y<br>z |\n"},
+		{"html", "<table>\n<thead>\n" +
+			"<tr><th>id</th><th>score</th><th>ok</th><th>code</th><th>note</th></tr>\n" +
+			"</thead>\n<tbody>\n" +
+			"<tr><td>1</td><td>9.5</td><td>true</td><td>007</td><td>a|b</td></tr>\n" +
+			"<tr><td>2</td><td></td><td>false</td><td>012</td><td>&lt;i&gt;x&lt;/i&gt; &amp; y\nz</td></tr>\n" +
+			"</tbody>\n</table>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := e.Export(q, &buf, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+
+			// Formats are looked up case-insensitively.
+			buf.Reset()
+			if err := e.Export(q, &buf, strings.ToUpper(tt.format)); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("upper case format output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := e.Export(q, &buf, "xml"); err == nil {
+		t.Error("unsupported format was accepted")
+	}
+}
+
+func TestJSONWriterIndent(t *testing.T) {
+	e := newTestEngine(t)
+	q := mustBuild(t, NewQuery().Select("id").From("u").Where("u.id", "<", "3"))
+
+	var buf bytes.Buffer
+	if err := e.ExportWithWriter(q, &buf, JSONWriter{Indent: "  "}); err != nil {
+		t.Fatal(err)
+	}
+	// The CSV column holds integers only, so they are written as numbers.
+	want := "[\n  {\"id\":1},\n  {\"id\":2}\n]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	// Without rows the array is empty.
+	buf.Reset()
+	empty := mustBuild(t, NewQuery().Select("id").From("u").Where("u.id", "=", "9"))
+	if err := e.ExportWithWriter(empty, &buf, JSONWriter{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "[]\n" {
+		t.Errorf("empty output = %q, want %q", got, "[]\n")
+	}
+}
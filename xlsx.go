@@ -0,0 +1,563 @@
+package csvsql
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSXOptions select the cells of a workbook that make up a table. At most one
+// of HeaderRow, Range and Name may be set.
+type XLSXOptions struct {
+	// Sheet selects the worksheet; the first sheet is used when it is empty.
+	Sheet string
+	// HeaderRow is the 1-based row of the sheet holding the column names.
+	// Rows above it and blank columns left of the first name are skipped.
+	// The first row is used when it is 0.
+	HeaderRow int
+	// Range is an A1-style range such as Sheet1!B3:H200, whose first row
+	// holds the column names. A range without a sheet refers to Sheet.
+	Range string
+	// Name selects a defined name or an Excel table of the workbook, whose
+	// cells are used like those of Range.
+	Name string
+	// Formatted reads the text Excel displays for every cell, as formatted
+	// by its number format, and leaves all columns untyped. By default the
+	// stored values are read and typed columns derived from them.
+	Formatted bool
+}
+
+// xlsxRegion is a rectangle of cells of a sheet. Bounds are 1-based and
+// inclusive; a zero bottom or right leaves the region open in that direction.
+type xlsxRegion struct {
+	sheet         string
+	top, left     int
+	bottom, right int
+}
+
+func NewTableFromXlsx(name, filepath string, sheetName ...string) (*Table, error) {
+	var opts XLSXOptions
+	if len(sheetName) > 0 {
+		opts.Sheet = sheetName[0]
+	}
+	return NewTableFromXlsxWithOptions(name, filepath, opts)
+}
+
+// NewTableFromXlsxWithOptions loads the cells of an XLSX file selected by
+// opts.
+func NewTableFromXlsxWithOptions(name, filepath string, opts XLSXOptions) (*Table, error) {
+	f, err := openWorkbook(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return newTableFromWorkbook(name, f, opts)
+}
+
+func newTableFromXlsxReader(name string, r io.Reader, opts XLSXOptions) (*Table, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx file error: %w", err)
+	}
+	defer f.Close()
+
+	return newTableFromWorkbook(name, f, opts)
+}
+
+func openWorkbook(filepath string) (*excelize.File, error) {
+	file, compressed, err := openDecompressed(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx file error: %w", err)
+	}
+	defer file.Close()
+
+	var f *excelize.File
+	if compressed {
+		f, err = excelize.OpenReader(file)
+	} else {
+		f, err = excelize.OpenFile(filepath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx file error: %w", err)
+	}
+	return f, nil
+}
+
+func newTableFromWorkbook(name string, f *excelize.File, opts XLSXOptions) (*Table, error) {
+	region, err := resolveXlsxRegion(f, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := f.GetRows(region.sheet, excelize.Options{RawCellValue: !opts.Formatted})
+	if err != nil {
+		return nil, fmt.Errorf("read xlsx rows error: %w", err)
+	}
+	return newTableFromXlsxRows(name, f, region, rows, opts)
+}
+
+// newTableFromXlsxRows returns the table of the cells of region, where rows
+// are the rows of its sheet as read for opts.
+func newTableFromXlsxRows(name string, f *excelize.File, region xlsxRegion, rows [][]string, opts XLSXOptions) (*Table, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("xlsx file is empty")
+	}
+	if region.top > len(rows) {
+		return nil, fmt.Errorf("sheet %s has no header row at row %d", region.sheet, region.top)
+	}
+	rows = rows[region.top-1:]
+	if !opts.Formatted {
+		// Column names are read as Excel displays them.
+		for col := range rows[0] {
+			cell, err := excelize.CoordinatesToCellName(col+1, region.top)
+			if err != nil {
+				return nil, err
+			}
+			if rows[0][col], err = f.GetCellValue(region.sheet, cell); err != nil {
+				return nil, fmt.Errorf("read xlsx cell %s error: %w", cell, err)
+			}
+		}
+	}
+	if region.right == 0 {
+		// Without a range the table starts at the first column name, so
+		// that blank columns left of it are skipped.
+		for region.left <= len(rows[0]) && rows[0][region.left-1] == "" {
+			region.left++
+		}
+	}
+	if region.bottom > 0 && region.bottom-region.top+1 < len(rows) {
+		rows = rows[:region.bottom-region.top+1]
+	}
+
+	headers := region.cells(rows[0])
+	if region.right > 0 {
+		for len(headers) < region.right-region.left+1 {
+			headers = append(headers, "")
+		}
+	}
+	headerMap := make(map[string]int)
+	for i, header := range headers {
+		headerMap[strings.ToLower(header)] = i
+	}
+
+	var cells *xlsxCellReader
+	var types []ColumnType
+	var typed []bool
+	if !opts.Formatted {
+		var err error
+		if cells, err = newXlsxCellReader(f, region.sheet); err != nil {
+			return nil, err
+		}
+		types = make([]ColumnType, len(headers))
+		typed = make([]bool, len(headers))
+	}
+
+	dataRows := make([][]string, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		row = region.cells(row)
+		normalizedRow := make([]string, len(headers))
+		for col := range normalizedRow {
+			if col >= len(row) || row[col] == "" {
+				continue
+			}
+			if cells == nil {
+				normalizedRow[col] = row[col]
+				continue
+			}
+
+			value, typ, err := cells.value(region.left+col, region.top+1+i, row[col])
+			if err != nil {
+				return nil, err
+			}
+			normalizedRow[col] = value
+			if typed[col] {
+				types[col] = mergeColumnTypes(types[col], typ)
+			} else {
+				types[col], typed[col] = typ, true
+			}
+		}
+		dataRows = append(dataRows, normalizedRow)
+	}
+
+	return &Table{
+		Name:      name,
+		Headers:   headers,
+		Rows:      dataRows,
+		HeaderMap: headerMap,
+		Types:     types,
+	}, nil
+}
+
+// mergeColumnTypes returns the type of a column holding values of both types.
+func mergeColumnTypes(a, b ColumnType) ColumnType {
+	switch {
+	case a == b:
+		return a
+	case (a == IntegerColumn && b == FloatColumn) || (a == FloatColumn && b == IntegerColumn):
+		return FloatColumn
+	case (a == DateColumn && b == DateTimeColumn) || (a == DateTimeColumn && b == DateColumn):
+		return DateTimeColumn
+	default:
+		return StringColumn
+	}
+}
+
+// numFmtKind is what the number format of a cell makes of its number.
+type numFmtKind int
+
+const (
+	numFmtNumber numFmtKind = iota
+	numFmtDate
+	numFmtDateTime
+	numFmtTime
+)
+
+// xlsxCellReader converts the stored values of the cells of a sheet to cell
+// values, using the cell types and number formats of the workbook.
+type xlsxCellReader struct {
+	f        *excelize.File
+	sheet    string
+	date1904 bool
+	formats  map[int]numFmtKind
+}
+
+func newXlsxCellReader(f *excelize.File, sheet string) (*xlsxCellReader, error) {
+	props, err := f.GetWorkbookProps()
+	if err != nil {
+		return nil, fmt.Errorf("read xlsx workbook error: %w", err)
+	}
+	r := &xlsxCellReader{f: f, sheet: sheet, formats: make(map[int]numFmtKind)}
+	if props.Date1904 != nil {
+		r.date1904 = *props.Date1904
+	}
+	return r, nil
+}
+
+// value returns the cell value and type of the cell at col and row, whose
+// stored value is raw. Numbers formatted as dates or times are Excel date
+// serials, which are converted to DateFormat, DateTimeFormat or, for times of
+// day, 15:04:05.
+func (r *xlsxCellReader) value(col, row int, raw string) (string, ColumnType, error) {
+	cell, err := excelize.CoordinatesToCellName(col, row)
+	if err != nil {
+		return "", StringColumn, err
+	}
+	cellType, err := r.f.GetCellType(r.sheet, cell)
+	if err != nil {
+		return "", StringColumn, fmt.Errorf("read xlsx cell %s error: %w", cell, err)
+	}
+
+	switch cellType {
+	case excelize.CellTypeBool:
+		return strconv.FormatBool(raw == "1"), BooleanColumn, nil
+	case excelize.CellTypeDate:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, raw); err == nil {
+				return t.Format(DateTimeFormat), DateTimeColumn, nil
+			}
+		}
+		return raw, StringColumn, nil
+	case excelize.CellTypeUnset, excelize.CellTypeNumber:
+	default:
+		return raw, StringColumn, nil
+	}
+
+	number, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return raw, StringColumn, nil
+	}
+	kind, err := r.numFmtKind(cell)
+	if err != nil {
+		return "", StringColumn, err
+	}
+
+	if kind != numFmtNumber {
+		t, err := excelize.ExcelDateToTime(number, r.date1904)
+		if err != nil {
+			return raw, FloatColumn, nil
+		}
+		t = t.Round(time.Second)
+		switch {
+		case kind == numFmtTime:
+			return t.Format("15:04:05"), StringColumn, nil
+		case kind == numFmtDate && number == math.Trunc(number):
+			return t.Format(DateFormat), DateColumn, nil
+		default:
+			return t.Format(DateTimeFormat), DateTimeColumn, nil
+		}
+	}
+
+	// Excel keeps 15 significant digits, so the binary noise beyond them,
+	// as in 0.30000000000000004, is dropped.
+	number, _ = strconv.ParseFloat(strconv.FormatFloat(number, 'g', 15, 64), 64)
+	if number == math.Trunc(number) && math.Abs(number) < 1<<53 {
+		return strconv.FormatFloat(number, 'f', -1, 64), IntegerColumn, nil
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64), FloatColumn, nil
+}
+
+func (r *xlsxCellReader) numFmtKind(cell string) (numFmtKind, error) {
+	styleID, err := r.f.GetCellStyle(r.sheet, cell)
+	if err != nil {
+		return numFmtNumber, fmt.Errorf("read xlsx cell %s style error: %w", cell, err)
+	}
+	if kind, ok := r.formats[styleID]; ok {
+		return kind, nil
+	}
+
+	kind := numFmtNumber
+	if style, err := r.f.GetStyle(styleID); err == nil {
+		if style.CustomNumFmt != nil {
+			kind = classifyNumFmt(*style.CustomNumFmt)
+		} else {
+			kind = builtInNumFmtKind(style.NumFmt)
+		}
+	}
+	r.formats[styleID] = kind
+	return kind, nil
+}
+
+// builtInNumFmtKind classifies the built-in number formats, including the
+// date formats of East Asian locales.
+func builtInNumFmtKind(id int) numFmtKind {
+	switch {
+	case id >= 14 && id <= 17, id >= 27 && id <= 31, id >= 34 && id <= 36, id >= 50 && id <= 58:
+		return numFmtDate
+	case id == 22:
+		return numFmtDateTime
+	case id >= 18 && id <= 21, id == 32, id == 33, id >= 45 && id <= 47:
+		return numFmtTime
+	default:
+		return numFmtNumber
+	}
+}
+
+// classifyNumFmt classifies a custom number format code by the date and time
+// tokens outside its literal text. An m is a month unless hours or seconds
+// are shown, as in mm:ss.
+func classifyNumFmt(code string) numFmtKind {
+	var tokens strings.Builder
+	quoted := false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case quoted:
+			quoted = c != '"'
+		case c == '"':
+			quoted = true
+		case c == '\\' || c == '_' || c == '*':
+			i++
+		case c == '[':
+			end := strings.IndexByte(code[i:], ']')
+			if end < 0 {
+				end = len(code) - i
+			}
+			// Elapsed time such as [h] or [mm] counts as a time, other
+			// bracketed parts are colours, conditions and locales.
+			if part := strings.ToLower(code[i+1 : i+end]); part != "" && strings.Trim(part, string(part[0])) == "" && strings.Contains("hms", part[:1]) {
+				tokens.WriteByte('h')
+			}
+			i += end
+		case c == ';':
+			// Only the format of positive numbers is considered.
+			i = len(code)
+		default:
+			tokens.WriteByte(c)
+		}
+	}
+
+	format := strings.ToLower(tokens.String())
+	format = strings.ReplaceAll(strings.ReplaceAll(format, "am/pm", ""), "a/p", "")
+	hasTime := strings.ContainsAny(format, "hs")
+	hasDate := strings.ContainsAny(format, "yd") || (strings.Contains(format, "m") && !hasTime)
+	switch {
+	case hasDate && hasTime:
+		return numFmtDateTime
+	case hasDate:
+		return numFmtDate
+	case hasTime:
+		return numFmtTime
+	default:
+		return numFmtNumber
+	}
+}
+
+// cells returns the cells of row within the columns of the region.
+func (r xlsxRegion) cells(row []string) []string {
+	if r.left > len(row) {
+		return nil
+	}
+	row = row[r.left-1:]
+	if r.right > 0 && r.right-r.left+1 < len(row) {
+		row = row[:r.right-r.left+1]
+	}
+	return row
+}
+
+// resolveXlsxRegion returns the cells of the workbook opts select.
+func resolveXlsxRegion(f *excelize.File, opts XLSXOptions) (xlsxRegion, error) {
+	set := 0
+	for _, ok := range []bool{opts.HeaderRow != 0, opts.Range != "", opts.Name != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return xlsxRegion{}, fmt.Errorf("only one of header row, range and name can be set")
+	}
+	if opts.HeaderRow < 0 {
+		return xlsxRegion{}, fmt.Errorf("invalid header row %d", opts.HeaderRow)
+	}
+
+	sheet := opts.Sheet
+	if sheet == "" {
+		sheet = f.GetSheetList()[0]
+	}
+
+	var region xlsxRegion
+	var err error
+	switch {
+	case opts.Name != "":
+		region, err = namedXlsxRegion(f, opts.Name)
+	case opts.Range != "":
+		region, err = parseXlsxRange(opts.Range, sheet)
+	default:
+		region = xlsxRegion{sheet: sheet, top: 1, left: 1}
+		if opts.HeaderRow > 0 {
+			region.top = opts.HeaderRow
+		}
+	}
+	if err != nil {
+		return xlsxRegion{}, err
+	}
+
+	if index, err := f.GetSheetIndex(region.sheet); err != nil || index < 0 {
+		return xlsxRegion{}, fmt.Errorf("sheet %s not found, workbook has sheets %s",
+			region.sheet, strings.Join(f.GetSheetList(), ", "))
+	}
+	return region, nil
+}
+
+// namedXlsxRegion returns the cells of a defined name or, failing that, of an
+// Excel table. Both are matched case-insensitively, as Excel does.
+func namedXlsxRegion(f *excelize.File, name string) (xlsxRegion, error) {
+	for _, defined := range f.GetDefinedName() {
+		if strings.EqualFold(defined.Name, name) {
+			return parseXlsxRange(strings.TrimPrefix(defined.RefersTo, "="), "")
+		}
+	}
+
+	for _, sheet := range f.GetSheetList() {
+		tables, err := f.GetTables(sheet)
+		if err != nil {
+			return xlsxRegion{}, fmt.Errorf("read xlsx tables error: %w", err)
+		}
+		for _, table := range tables {
+			if !strings.EqualFold(table.Name, name) {
+				continue
+			}
+			if table.ShowHeaderRow != nil && !*table.ShowHeaderRow {
+				return xlsxRegion{}, fmt.Errorf("table %s has no header row", table.Name)
+			}
+			return parseXlsxRange(table.Range, sheet)
+		}
+	}
+	return xlsxRegion{}, fmt.Errorf("no defined name or table %s in workbook", name)
+}
+
+// parseXlsxRange parses an A1-style range such as 'My Sheet'!$B$3:$H$200.
+// sheet is used when the range does not name one.
+func parseXlsxRange(ref, sheet string) (xlsxRegion, error) {
+	cells := ref
+	if i := strings.LastIndex(ref, "!"); i >= 0 {
+		sheet, cells = ref[:i], ref[i+1:]
+		if len(sheet) >= 2 && sheet[0] == '\'' && sheet[len(sheet)-1] == '\'' {
+			sheet = strings.ReplaceAll(sheet[1:len(sheet)-1], "''", "'")
+		}
+	}
+	if sheet == "" {
+		return xlsxRegion{}, fmt.Errorf("invalid range %s: missing sheet name", ref)
+	}
+
+	start, end, ok := strings.Cut(strings.ReplaceAll(cells, "$", ""), ":")
+	if !ok {
+		end = start
+	}
+	left, top, err := excelize.CellNameToCoordinates(start)
+	if err != nil {
+		return xlsxRegion{}, fmt.Errorf("invalid range %s: %w", ref, err)
+	}
+	right, bottom, err := excelize.CellNameToCoordinates(end)
+	if err != nil {
+		return xlsxRegion{}, fmt.Errorf("invalid range %s: %w", ref, err)
+	}
+	if right < left {
+		left, right = right, left
+	}
+	if bottom < top {
+		top, bottom = bottom, top
+	}
+	return xlsxRegion{sheet: sheet, top: top, left: left, bottom: bottom, right: right}, nil
+}
+
+// CreateTablesFromWorkbook registers every worksheet of the XLSX file at
+// filepath as a table named prefix followed by the sheet name, in which
+// characters other than letters, digits and underscores become underscores.
+// Empty sheets are skipped. Either all tables are registered or none.
+func (e *Engine) CreateTablesFromWorkbook(prefix, filepath string) error {
+	if filepath == "" {
+		return fmt.Errorf("filepath cannot be empty")
+	}
+
+	f, err := openWorkbook(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create tables from XLSX: %w", err)
+	}
+	defer f.Close()
+
+	var tables []*Table
+	seen := make(map[string]string)
+	for _, sheet := range f.GetSheetList() {
+		alias := prefix + sanitizeSheetName(sheet)
+		if other, ok := seen[alias]; ok {
+			return fmt.Errorf("sheets %s and %s both map to table alias '%s'", other, sheet, alias)
+		}
+		seen[alias] = sheet
+
+		rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return fmt.Errorf("failed to create tables from XLSX: read xlsx rows error: %w", err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		region := xlsxRegion{sheet: sheet, top: 1, left: 1}
+		table, err := newTableFromXlsxRows(alias, f, region, rows, XLSXOptions{Sheet: sheet})
+		if err != nil {
+			return fmt.Errorf("failed to create table from XLSX sheet %s: %w", sheet, err)
+		}
+		if err := e.validateHeaders(table.Headers, fmt.Sprintf("sheet '%s' of file '%s'", sheet, filepath)); err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+
+	return e.addTables(tables)
+}
+
+func sanitizeSheetName(sheet string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, sheet)
+}
@@ -0,0 +1,194 @@
+package csvsql
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// writeXlsxTestFile writes a workbook whose Data sheet has a title above a
+// table starting at B3, with an integer, a formatted float, a date and a text
+// column, and returns its path. The workbook also has an empty sheet and an
+// Excel table named People on its Lists sheet.
+func writeXlsxTestFile(t *testing.T) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", "Data"); err != nil {
+		t.Fatal(err)
+	}
+	for _, sheet := range []string{"Empty", "Lists"} {
+		if _, err := f.NewSheet(sheet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows := map[string][]any{
+		"A1": {"Quarterly report"},
+		"B3": {"id", "amount", "day", "label"},
+		"B4": {1, 1234.5, 45000, "007"},
+		"B5": {2, 0.25, 45001, "a|b"},
+		"B6": {3, 10, 45002, "c"},
+	}
+	for cell, row := range rows {
+		if err := f.SetSheetRow("Data", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	format := "#,##0.00"
+	amount, err := f.NewStyle(&excelize.Style{CustomNumFmt: &format})
+	if err != nil {
+		t.Fatal(err)
+	}
+	date, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetCellStyle("Data", "C4", "C6", amount); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetCellStyle("Data", "D4", "D6", date); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetDefinedName(&excelize.DefinedName{Name: "Amounts", RefersTo: "Data!$C$3:$C$5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for cell, row := range map[string][]any{"A1": {"name", "age"}, "A2": {"alice", 30}, "A3": {"bob", 25}} {
+		if err := f.SetSheetRow("Lists", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.AddTable("Lists", &excelize.Table{Range: "A1:B3", Name: "People"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestXlsxRegions(t *testing.T) {
+	path := writeXlsxTestFile(t)
+	tests := []struct {
+		name    string
+		opts    XLSXOptions
+		headers []string
+		rows    [][]string
+	}{
+		{
+			name:    "header row",
+			opts:    XLSXOptions{HeaderRow: 3},
+			headers: []string{"id", "amount", "day", "label"},
+			rows:    [][]string{{"1", "1234.5", "2023-03-15", "007"}, {"2", "0.25", "2023-03-16", "a|b"}, {"3", "10", "2023-03-17", "c"}},
+		},
+		{
+			name:    "range",
+			opts:    XLSXOptions{Range: "Data!$C$3:D4"},
+			headers: []string{"amount", "day"},
+			rows:    [][]string{{"1234.5", "2023-03-15"}},
+		},
+		{
+			name:    "range of sheet",
+			opts:    XLSXOptions{Sheet: "Data", Range: "E3:F5"},
+			headers: []string{"label", ""},
+			rows:    [][]string{{"007", ""}, {"a|b", ""}},
+		},
+		{
+			name:    "defined name",
+			opts:    XLSXOptions{Name: "amounts"},
+			headers: []string{"amount"},
+			rows:    [][]string{{"1234.5"}, {"0.25"}},
+		},
+		{
+			name:    "table",
+			opts:    XLSXOptions{Name: "People"},
+			headers: []string{"name", "age"},
+			rows:    [][]string{{"alice", "30"}, {"bob", "25"}},
+		},
+		{
+			name:    "formatted",
+			opts:    XLSXOptions{HeaderRow: 3, Formatted: true},
+			headers: []string{"id", "amount", "day", "label"},
+			rows:    [][]string{{"1", "1,234.50", "03-15-23", "007"}, {"2", "0.25", "03-16-23", "a|b"}, {"3", "10.00", "03-17-23", "c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := NewTableFromXlsxWithOptions("t", path, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(table.Headers, tt.headers) {
+				t.Errorf("headers = %q, want %q", table.Headers, tt.headers)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) {
+				t.Errorf("rows = %q, want %q", table.Rows, tt.rows)
+			}
+		})
+	}
+
+	for _, opts := range []XLSXOptions{
+		{HeaderRow: 3, Range: "A1:B2"},
+		{HeaderRow: -1},
+		{HeaderRow: 10},
+		{Sheet: "Missing"},
+		{Range: "Missing!A1:B2"},
+		{Name: "Nothing"},
+	} {
+		if _, err := NewTableFromXlsxWithOptions("t", path, opts); err == nil {
+			t.Errorf("options %+v were accepted", opts)
+		}
+	}
+}
+
+func TestXlsxColumnTypes(t *testing.T) {
+	e := NewEngine()
+	err := e.CreateTableWithOptions("report", writeXlsxTestFile(t), TableOptions{XLSX: XLSXOptions{HeaderRow: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ColumnType{IntegerColumn, FloatColumn, DateColumn, StringColumn}
+	if got := e.tables["report"].Types; !reflect.DeepEqual(got, want) {
+		t.Errorf("types = %v, want %v", got, want)
+	}
+
+	// Date serials are read as dates, which sort as text.
+	q := mustBuild(t, NewQuery().Select("id").From("report").Where("day", ">=", "2023-03-16"))
+	assertColumn(t, mustQuery(t, e, q), 0, []string{"2", "3"})
+
+	formatted := NewEngine()
+	err = formatted.CreateTableWithOptions("report", writeXlsxTestFile(t), TableOptions{XLSX: XLSXOptions{HeaderRow: 3, Formatted: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatted.tables["report"].Types; got != nil {
+		t.Errorf("formatted types = %v, want none", got)
+	}
+}
+
+func TestCreateTablesFromWorkbook(t *testing.T) {
+	e := NewEngine()
+	if err := e.CreateTablesFromWorkbook("wb_", writeXlsxTestFile(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.tables["wb_Empty"]; ok {
+		t.Error("empty sheet was registered")
+	}
+
+	data := e.tables["wb_Data"]
+	if data == nil || !reflect.DeepEqual(data.Headers, []string{"Quarterly report"}) || len(data.Rows) != 5 {
+		t.Fatalf("Data sheet = %+v", data)
+	}
+	results := mustQuery(t, e, mustBuild(t, NewQuery().Select("name").From("wb_Lists").Where("age", ">", "26")))
+	assertColumn(t, results, 0, []string{"alice"})
+
+	if err := e.CreateTablesFromWorkbook("wb_", writeXlsxTestFile(t)); err == nil || !strings.Contains(err.Error(), "wb_") {
+		t.Errorf("registering the sheets again: error = %v, want a table name clash", err)
+	}
+}